@@ -10,6 +10,7 @@ import (
 
 	"github.com/anthdm/raptor/internal/api"
 	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/secrets"
 	"github.com/anthdm/raptor/internal/storage"
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/google/uuid"
@@ -32,15 +33,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	var (
-		user    = config.Get().Storage.User
-		pw      = config.Get().Storage.Password
-		dbname  = config.Get().Storage.Name
-		host    = config.Get().Storage.Host
-		port    = config.Get().Storage.Port
-		sslmode = config.Get().Storage.SSLMode
-	)
-	store, err := storage.NewSQLStore(user, pw, dbname, host, port, sslmode)
+	store, err := storage.New(config.Get().StorageDriver, config.Get().Storage)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -49,7 +42,12 @@ func main() {
 		seedEndpoint(store, modCache)
 	}
 
-	server := api.NewServer(store, store, modCache)
+	keyring, err := secrets.NewKeyringFromConfig(config.Get().Secrets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := api.NewServer(store, store, store, store, store, store, store, keyring, modCache)
 	fmt.Printf("api server running\t%s\n", config.GetApiUrl())
 	log.Fatal(server.Listen(config.Get().APIServerAddr))
 }
@@ -63,16 +61,13 @@ func seedEndpoint(store storage.Store, cache storage.ModCacher) {
 		ID:          uuid.MustParse("09248ef6-c401-4601-8928-5964d61f2c61"),
 		Runtime:     "js",
 		Name:        "Catfact parser",
+		Slug:        "catfact-parser",
 		Environment: map[string]string{"FOO": "bar"},
 		CreatedAT:   time.Now(),
 	}
 
 	deploy := types.NewDeployment(endpoint, b)
 	endpoint.ActiveDeploymentID = deploy.ID
-	endpoint.DeploymentHistory = append(endpoint.DeploymentHistory, &types.DeploymentHistory{
-		ID:        deploy.ID,
-		CreatedAT: deploy.CreatedAT,
-	})
 	store.CreateEndpoint(endpoint)
 	store.CreateDeployment(deploy)
 	err = store.UpdateEndpoint(endpoint.ID, storage.UpdateEndpointParams{
@@ -81,7 +76,7 @@ func seedEndpoint(store storage.Store, cache storage.ModCacher) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("endpoint seeded: %s/live/%s\n", config.GetWasmUrl(), endpoint.ID)
+	fmt.Printf("endpoint seeded: %s/live/%s\n", config.GetWasmUrl(), endpoint.URLRef())
 }
 
 func compile(ctx context.Context, cache wazero.CompilationCache, blob []byte) {
@@ -2,16 +2,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/anthdm/raptor/internal/api"
 	"github.com/anthdm/raptor/internal/client"
 	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/devserver"
+	"github.com/anthdm/raptor/internal/secrets"
+	"github.com/anthdm/raptor/internal/storage"
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/google/uuid"
 )
@@ -23,9 +36,24 @@ Raptor cli v0.0.1
 Usage: raptor COMMAND
 
 Commands:
-  endpoint			Create a new endpoint
+  endpoint			Create a new endpoint or delete one (endpoint delete)
   publish			Publish a specific deployment to your applications endpoint
-  deploy			Create a new deployment
+  rollback			Publish the previously active deployment of an endpoint again
+  traffic			Split the live traffic of an endpoint across deployments (set, show, clear or promote)
+  deploy			Create a new deployment or delete one (deploy delete)
+  env				Set, unset or list the environment variables of an endpoint (set, unset or list)
+  secret			Manage the encrypted secrets of an endpoint (set, unset, list, rotate or genkey)
+  domain			Manage the custom domains of an endpoint (add, list, verify or remove)
+  ratelimit			Set or show the rate limits of an endpoint (set or show)
+  concurrency			Set or show the concurrency limits of an endpoint (set or show)
+  account			Create an account, set its quota or show its usage (create, quota or usage)
+  token				Manage the API tokens of an account (create, list or revoke)
+  role				Manage the roles of API tokens on an endpoint (set, list or remove)
+  audit				Show the audit log of the mutations, optionally of an endpoint (--endpoint)
+  serve				Serve the code of a file locally and reload it when it changes
+  metrics			Show the request count, latency percentiles, error ratios and throughput of an endpoint
+  logs				Show or follow (--follow) the logs of an endpoint
+  migrate			Apply, revert or inspect the storage schema migrations (up, down or status)
   help				Show usage
 
 `)
@@ -61,7 +89,13 @@ func main() {
 		printUsage()
 	}
 
-	c := client.New(client.NewConfig().WithURL(config.GetApiUrl()))
+	// The API token of the environment takes precedence over the config, so
+	// the token of an account can be used without editing the config.
+	token := os.Getenv("RAPTOR_API_TOKEN")
+	if token == "" {
+		token = config.Get().APIToken
+	}
+	c := client.New(client.NewConfig().WithURL(config.GetApiUrl()).WithToken(token))
 	command := command{
 		client: c,
 	}
@@ -69,10 +103,38 @@ func main() {
 	switch args[0] {
 	case "publish":
 		command.handlePublish(args[1:])
+	case "rollback":
+		command.handleRollback(args[1:])
+	case "traffic":
+		command.handleTraffic(args[1:])
 	case "endpoint":
 		command.handleEndpoint(args[1:])
 	case "deploy":
 		command.handleDeploy(args[1:])
+	case "env":
+		command.handleEnv(args[1:])
+	case "secret":
+		command.handleSecret(args[1:])
+	case "domain":
+		command.handleDomain(args[1:])
+	case "ratelimit":
+		command.handleRateLimit(args[1:])
+	case "concurrency":
+		command.handleConcurrency(args[1:])
+	case "account":
+		command.handleAccount(args[1:])
+	case "token":
+		command.handleToken(args[1:])
+	case "role":
+		command.handleRole(args[1:])
+	case "audit":
+		command.handleAudit(args[1:])
+	case "migrate":
+		command.handleMigrate(args[1:])
+	case "metrics":
+		command.handleMetrics(args[1:])
+	case "logs":
+		command.handleLogs(args[1:])
 	case "serve":
 		if len(args) < 2 {
 			printUsage()
@@ -113,15 +175,179 @@ func (c command) handlePublish(args []string) {
 	fmt.Println(string(b))
 }
 
+func (c command) handleRollback(args []string) {
+	flagset := flag.NewFlagSet("rollback", flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint to roll back")
+	var steps int
+	flagset.IntVar(&steps, "steps", 1, "The number of publications to go back")
+	_ = flagset.Parse(args)
+
+	id := c.parseEndpointID(endpointID)
+
+	resp, err := c.client.Rollback(id, api.RollbackParams{Steps: steps})
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	b, err := json.MarshalIndent(resp, "", "    ")
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	fmt.Println(string(b))
+}
+
+func (c command) handleTraffic(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("traffic "+subcommand, flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint")
+	var routes stringList
+	flagset.Var(&routes, "route", "A deployment and the percentage of traffic it serves (e.g. --route <deploy-id>=5)")
+	var sticky string
+	flagset.StringVar(&sticky, "sticky", "", "The request header that assigns clients to a deployment, a cookie is used when empty")
+	var canary string
+	flagset.StringVar(&canary, "canary", "", "The deployment to promote or abort automatically")
+	var errorRate float64
+	flagset.Float64Var(&errorRate, "errorRate", 0.05, "The ratio of 5xx responses of the canary above which it is aborted")
+	var minRequests int
+	flagset.IntVar(&minRequests, "minRequests", 100, "The number of requests the canary serves before it is promoted or aborted")
+	var duration time.Duration
+	flagset.DurationVar(&duration, "duration", 10*time.Minute, "How long the canary serves traffic before it is promoted")
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+
+	switch subcommand {
+	case "show":
+		endpoint, err := c.client.GetEndpoint(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		printTrafficSplit(endpoint)
+	case "set":
+		params := api.TrafficSplitParams{StickyHeader: sticky}
+		for _, route := range routes {
+			deployID, weight, ok := strings.Cut(route, "=")
+			if !ok {
+				printErrorAndExit(fmt.Errorf("route arguments need to be in the format of --route <deploy-id>=<weight>"))
+			}
+			deploy, err := uuid.Parse(deployID)
+			if err != nil {
+				printErrorAndExit(fmt.Errorf("invalid deployment id given: %s", deployID))
+			}
+			percent, err := strconv.Atoi(weight)
+			if err != nil {
+				printErrorAndExit(fmt.Errorf("invalid weight given: %s", weight))
+			}
+			params.Routes = append(params.Routes, types.TrafficRoute{DeploymentID: deploy, Weight: percent})
+		}
+		if canary != "" {
+			canaryID, err := uuid.Parse(canary)
+			if err != nil {
+				printErrorAndExit(fmt.Errorf("invalid deployment id given: %s", canary))
+			}
+			params.Canary = &types.CanaryPolicy{
+				DeploymentID: canaryID,
+				MaxErrorRate: errorRate,
+				MinRequests:  minRequests,
+				Duration:     duration,
+			}
+		}
+		endpoint, err := c.client.SetTrafficSplit(id, params)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		printTrafficSplit(endpoint)
+	case "clear":
+		if err := c.client.DeleteTrafficSplit(id); err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Println("all live traffic is served by the active deployment")
+	case "promote":
+		resp, err := c.client.PromoteCanary(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		b, err := json.MarshalIndent(resp, "", "    ")
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Println(string(b))
+	default:
+		printErrorAndExit(fmt.Errorf("unknown traffic command: %s (set, show, clear or promote)", subcommand))
+	}
+}
+
+// parseEndpointID returns the id of the endpoint that is referenced by the
+// given id or slug.
+func (c command) parseEndpointID(ref string) uuid.UUID {
+	if id, err := uuid.Parse(ref); err == nil {
+		return id
+	}
+	if types.ValidateSlug(ref) != nil {
+		printErrorAndExit(fmt.Errorf("invalid endpoint id or slug given: %q", ref))
+	}
+	endpoint, err := c.client.GetEndpointBySlug(ref)
+	if err != nil {
+		printErrorAndExit(fmt.Errorf("could not find endpoint %s (%w)", ref, err))
+	}
+	return endpoint.ID
+}
+
+func printTrafficSplit(endpoint *types.Endpoint) {
+	split := endpoint.TrafficSplit
+	if split == nil {
+		fmt.Printf("all live traffic is served by the active deployment %s\n", endpoint.ActiveDeploymentID)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tWEIGHT\t")
+	for _, route := range split.Routes {
+		var labels []string
+		if route.DeploymentID == endpoint.ActiveDeploymentID {
+			labels = append(labels, "active")
+		}
+		if split.Canary != nil && route.DeploymentID == split.Canary.DeploymentID {
+			labels = append(labels, "canary")
+		}
+		fmt.Fprintf(w, "%s\t%d%%\t%s\n", route.DeploymentID, route.Weight, strings.Join(labels, ", "))
+	}
+	w.Flush()
+	if canary := split.Canary; canary != nil {
+		fmt.Printf("\ncanary is promoted after %s and %d requests, or aborted above a %.2f%% error rate\n",
+			canary.Duration, canary.MinRequests, canary.MaxErrorRate*100)
+	}
+}
+
 func (c command) handleEndpoint(args []string) {
+	if len(args) > 0 && args[0] == "delete" {
+		c.handleEndpointDelete(args[1:])
+		return
+	}
 	flagset := flag.NewFlagSet("endpoint", flag.ExitOnError)
 
 	var name string
 	flagset.StringVar(&name, "name", "", "The name of your endpoint")
+	var slug string
+	flagset.StringVar(&slug, "slug", "", "The slug of your endpoint in live URLs, derived from the name when empty")
 	var runtime string
 	flagset.StringVar(&runtime, "runtime", "", "The runtime of your endpoint (go or js)")
 	var env stringList
 	flagset.Var(&env, "env", "Environment variables for this endpoint")
+	var (
+		limits types.Limits
+		memory uint
+	)
+	flagset.UintVar(&memory, "memory", 0, "The maximum memory of an invocation in 64KiB pages")
+	flagset.DurationVar(&limits.Timeout, "timeout", 0, "The maximum duration of an invocation (e.g. 5s)")
+	flagset.Uint64Var(&limits.MaxCalls, "max-calls", 0, "The maximum number of function calls of an invocation")
+	rateLimits := rateLimitFlags(flagset)
+	concurrency := concurrencyFlags(flagset)
 	_ = flagset.Parse(args)
 
 	if !types.ValidRuntime(runtime) {
@@ -135,8 +361,13 @@ func (c command) handleEndpoint(args []string) {
 	params := api.CreateEndpointParams{
 		Runtime:     runtime,
 		Name:        name,
+		Slug:        slug,
 		Environment: makeEnvMap(env),
+		Limits:      limits,
+		RateLimits:  *rateLimits,
+		Concurrency: *concurrency,
 	}
+	params.Limits.MaxMemoryPages = uint32(memory)
 	endpoint, err := c.client.CreateEndpoint(params)
 	if err != nil {
 		printErrorAndExit(err)
@@ -148,19 +379,34 @@ func (c command) handleEndpoint(args []string) {
 	fmt.Println(string(b))
 }
 
+func (c command) handleEndpointDelete(args []string) {
+	flagset := flag.NewFlagSet("endpoint delete", flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "id", "", "The id or slug of the endpoint to delete")
+	_ = flagset.Parse(args)
+
+	id := c.parseEndpointID(endpointID)
+	if err := c.client.DeleteEndpoint(id); err != nil {
+		printErrorAndExit(err)
+	}
+	fmt.Printf("endpoint %s deleted with all its deployments, metrics and logs\n", id)
+}
+
 func (c command) handleDeploy(args []string) {
+	if len(args) > 0 && args[0] == "delete" {
+		c.handleDeployDelete(args[1:])
+		return
+	}
 	flagset := flag.NewFlagSet("deploy", flag.ExitOnError)
 
 	var endpointID string
-	flagset.StringVar(&endpointID, "endpoint", "", "The id of the endpoint to where you want to deploy")
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint to where you want to deploy")
 	var file string
 	flagset.StringVar(&file, "file", "", "The file location of your code that you want to deploy")
 	_ = flagset.Parse(args)
 
-	id, err := uuid.Parse(endpointID)
-	if err != nil {
-		printErrorAndExit(fmt.Errorf("invalid endpoint id given: %s", args[0]))
-	}
+	id := c.parseEndpointID(endpointID)
 	b, err := os.ReadFile(file)
 	if err != nil {
 		printErrorAndExit(err)
@@ -178,18 +424,732 @@ func (c command) handleDeploy(args []string) {
 	fmt.Printf("deploy preview: %s/preview/%s\n", config.GetWasmUrl(), deploy.ID)
 }
 
+func (c command) handleDeployDelete(args []string) {
+	flagset := flag.NewFlagSet("deploy delete", flag.ExitOnError)
+
+	var deployID string
+	flagset.StringVar(&deployID, "id", "", "The id of the deployment to delete")
+	var force bool
+	flagset.BoolVar(&force, "force", false, "Delete the deployment even when it is active")
+	_ = flagset.Parse(args)
+
+	id, err := uuid.Parse(deployID)
+	if err != nil {
+		printErrorAndExit(fmt.Errorf("invalid deployment id given: %s", deployID))
+	}
+	if err := c.client.DeleteDeployment(id, force); err != nil {
+		printErrorAndExit(err)
+	}
+	fmt.Printf("deployment %s deleted\n", id)
+}
+
+func (c command) handleMetrics(args []string) {
+	flagset := flag.NewFlagSet("metrics", flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint")
+	var deployID string
+	flagset.StringVar(&deployID, "deploy", "", "Only show the metrics of this deployment")
+	var since time.Duration
+	flagset.DurationVar(&since, "since", time.Hour, "The time range of the summary up until now")
+	var bucket time.Duration
+	flagset.DurationVar(&bucket, "bucket", 5*time.Minute, "The size of each bucket")
+	_ = flagset.Parse(args)
+
+	id := c.parseEndpointID(endpointID)
+	now := time.Now()
+	params := api.MetricsSummaryParams{
+		From:   now.Add(-since),
+		To:     now,
+		Bucket: bucket,
+	}
+	if deployID != "" {
+		deploy, err := uuid.Parse(deployID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid deployment id given: %s", deployID))
+		}
+		params.DeploymentID = deploy
+	}
+	summary, err := c.client.GetMetricsSummary(id, params)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+
+	fmt.Printf("endpoint %s from %s to %s\n\n", summary.EndpointID, summary.From.Format(time.RFC3339), summary.To.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tCOUNT\tP50\tP90\tP99\t4XX\t5XX\tREQ/S")
+	printAggregate(w, "total", summary.Total)
+	for _, deploy := range summary.Deployments {
+		fmt.Fprintf(w, "deployment %s\n", deploy.DeploymentID)
+		for _, b := range deploy.Buckets {
+			printAggregate(w, b.Start.Format(time.TimeOnly), b.MetricsAggregate)
+		}
+		printAggregate(w, "total", deploy.Total)
+	}
+	w.Flush()
+}
+
+func printAggregate(w io.Writer, label string, agg types.MetricsAggregate) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%.2f%%\t%.2f%%\t%.2f\n",
+		label,
+		agg.Count,
+		agg.P50,
+		agg.P90,
+		agg.P99,
+		agg.StatusRatios["4xx"]*100,
+		agg.StatusRatios["5xx"]*100,
+		agg.RequestsPerSecond,
+	)
+}
+
+func (c command) handleLogs(args []string) {
+	flagset := flag.NewFlagSet("logs", flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint")
+	var deployID string
+	flagset.StringVar(&deployID, "deploy", "", "Only show the logs of this deployment")
+	var requestID string
+	flagset.StringVar(&requestID, "request", "", "Only show the logs of this request")
+	var stream string
+	flagset.StringVar(&stream, "stream", "", "Only show the logs of this stream (stdout or stderr)")
+	var since time.Duration
+	flagset.DurationVar(&since, "since", 0, "Only show the logs of this duration up until now")
+	var limit int
+	flagset.IntVar(&limit, "limit", 100, "The number of latest logs to show")
+	var follow bool
+	flagset.BoolVar(&follow, "follow", false, "Keep streaming new logs")
+	_ = flagset.Parse(args)
+
+	id := c.parseEndpointID(endpointID)
+	params := api.LogsParams{
+		RequestID: requestID,
+		Stream:    stream,
+		Limit:     limit,
+	}
+	if since > 0 {
+		params.From = time.Now().Add(-since)
+	}
+	if deployID != "" {
+		deploy, err := uuid.Parse(deployID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid deployment id given: %s", deployID))
+		}
+		params.DeploymentID = deploy
+	}
+
+	if follow {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err := c.client.FollowLogs(ctx, id, params, func(log types.RuntimeLog) error {
+			printLog(log)
+			return nil
+		})
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		return
+	}
+	logs, err := c.client.GetLogs(id, params)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	for _, log := range logs {
+		printLog(log)
+	}
+}
+
+func printLog(log types.RuntimeLog) {
+	fmt.Printf("%s %s %s %s\n", log.Time.Local().Format(time.DateTime), log.RequestID, log.Stream, log.Line)
+}
+
+func (c command) handleMigrate(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	flagset := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	var steps int
+	flagset.IntVar(&steps, "steps", 1, "The number of migrations to revert when migrating down")
+	_ = flagset.Parse(args[1:])
+
+	migrator, err := storage.OpenMigrator(config.Get().StorageDriver, config.Get().Storage)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		for _, migration := range applied {
+			fmt.Printf("applied\t%04d_%s\n", migration.Version, migration.Name)
+		}
+		fmt.Printf("%d migration(s) applied\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		for _, migration := range reverted {
+			fmt.Printf("reverted\t%04d_%s\n", migration.Version, migration.Name)
+		}
+		fmt.Printf("%d migration(s) reverted\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("%04d_%s\tapplied at %s\n", status.Version, status.Name, status.AppliedAT.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", status.Version, status.Name)
+			}
+		}
+	default:
+		printErrorAndExit(fmt.Errorf("invalid migrate command %s, expected up, down or status", args[0]))
+	}
+}
+
 func (c command) handleServeEndpoint(args []string) {
-	fmt.Println("TODO")
+	flagset := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var file string
+	flagset.StringVar(&file, "file", "", "The file location of your code that you want to serve")
+	var runtime string
+	flagset.StringVar(&runtime, "runtime", "go", "The runtime of your code (go or js)")
+	var env stringList
+	flagset.Var(&env, "env", "Environment variables for your code")
+	var port int
+	flagset.IntVar(&port, "port", 8080, "The port to serve on")
+	_ = flagset.Parse(args)
+
+	if len(file) == 0 {
+		printErrorAndExit(fmt.Errorf("the file of your code is not provided. --file <file>"))
+	}
+	cfg := config.Get().Runtime
+	server, err := devserver.New(devserver.Config{
+		File:    file,
+		Runtime: runtime,
+		Env:     makeEnvMap(env),
+		Limits: types.Limits{
+			MaxMemoryPages: cfg.MaxMemoryPages,
+			Timeout:        time.Duration(cfg.Timeout),
+			MaxCalls:       cfg.MaxCalls,
+		},
+	})
+	if err != nil {
+		printErrorAndExit(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go server.Watch(ctx)
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: server,
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	fmt.Printf("serving %s on http://localhost:%d, reloading on changes\n", file, port)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		printErrorAndExit(err)
+	}
+}
+
+func (c command) handleEnv(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("env "+subcommand, flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "id", "", "The id or slug of the endpoint")
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+
+	var params api.UpdateEndpointParams
+	switch subcommand {
+	case "list":
+		endpoint, err := c.client.GetEndpoint(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		printEnv(endpoint.Environment)
+		return
+	case "set":
+		if flagset.NArg() == 0 {
+			printErrorAndExit(fmt.Errorf("usage: raptor env set --id <endpoint-id> FOO=bar [NAME=bob ...]"))
+		}
+		params.SetEnvironment = makeEnvMap(flagset.Args())
+	case "unset":
+		if flagset.NArg() == 0 {
+			printErrorAndExit(fmt.Errorf("usage: raptor env unset --id <endpoint-id> FOO [NAME ...]"))
+		}
+		params.UnsetEnvironment = flagset.Args()
+	default:
+		printErrorAndExit(fmt.Errorf("unknown env command: %s (set, unset or list)", subcommand))
+	}
+	endpoint, err := c.client.UpdateEndpoint(id, params)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	printEnv(endpoint.Environment)
+}
+
+// rateLimitFlags registers the flags of the rate limits of an endpoint on the
+// flagset.
+func rateLimitFlags(flagset *flag.FlagSet) *types.RateLimits {
+	var limits types.RateLimits
+	flagset.Float64Var(&limits.Endpoint.Rate, "rate", 0, "The maximum requests per second to the endpoint")
+	flagset.IntVar(&limits.Endpoint.Burst, "burst", 0, "The maximum burst of requests to the endpoint")
+	flagset.Float64Var(&limits.Client.Rate, "client-rate", 0, "The maximum requests per second of each client IP")
+	flagset.IntVar(&limits.Client.Burst, "client-burst", 0, "The maximum burst of requests of each client IP")
+	return &limits
+}
+
+func (c command) handleRateLimit(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("ratelimit "+subcommand, flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "id", "", "The id or slug of the endpoint")
+	limits := rateLimitFlags(flagset)
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+	var (
+		endpoint *types.Endpoint
+		err      error
+	)
+	switch subcommand {
+	case "show":
+		endpoint, err = c.client.GetEndpoint(id)
+	case "set":
+		// Zero values fall back to the defaults of the rate limit
+		// configuration of the wasm server.
+		endpoint, err = c.client.UpdateEndpoint(id, api.UpdateEndpointParams{RateLimits: limits})
+	default:
+		printErrorAndExit(fmt.Errorf("unknown ratelimit command: %s (set or show)", subcommand))
+	}
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	b, err := json.MarshalIndent(endpoint.RateLimits, "", "    ")
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	fmt.Println(string(b))
+}
+
+// concurrencyFlags registers the flags of the concurrency limits of an
+// endpoint on the flagset.
+func concurrencyFlags(flagset *flag.FlagSet) *types.Concurrency {
+	var concurrency types.Concurrency
+	flagset.IntVar(&concurrency.MaxConcurrent, "max-concurrent", 0, "The maximum concurrent invocations of the endpoint")
+	flagset.IntVar(&concurrency.MaxQueue, "max-queue", 0, "The maximum requests waiting for an invocation")
+	flagset.DurationVar(&concurrency.QueueTimeout, "queue-timeout", 0, "The maximum time a request waits for an invocation (e.g. 5s)")
+	return &concurrency
+}
+
+func (c command) handleConcurrency(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("concurrency "+subcommand, flag.ExitOnError)
+
+	var endpointID string
+	flagset.StringVar(&endpointID, "id", "", "The id or slug of the endpoint")
+	concurrency := concurrencyFlags(flagset)
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+	var (
+		endpoint *types.Endpoint
+		err      error
+	)
+	switch subcommand {
+	case "show":
+		endpoint, err = c.client.GetEndpoint(id)
+	case "set":
+		// Zero values fall back to the defaults of the concurrency
+		// configuration of the wasm server.
+		endpoint, err = c.client.UpdateEndpoint(id, api.UpdateEndpointParams{Concurrency: concurrency})
+	default:
+		printErrorAndExit(fmt.Errorf("unknown concurrency command: %s (set or show)", subcommand))
+	}
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	b, err := json.MarshalIndent(endpoint.Concurrency, "", "    ")
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	fmt.Println(string(b))
+}
+
+func (c command) handleDomain(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("domain "+subcommand, flag.ExitOnError)
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint")
+	var domainID string
+	flagset.StringVar(&domainID, "id", "", "The id of the domain")
+	var prefix string
+	flagset.StringVar(&prefix, "prefix", "", "The path prefix the endpoint claims, all paths when empty")
+	_ = flagset.Parse(args[1:])
+
+	switch subcommand {
+	case "add":
+		id := c.parseEndpointID(endpointID)
+		if flagset.NArg() != 1 {
+			printErrorAndExit(fmt.Errorf("usage: raptor domain add --endpoint <endpoint-id> [--prefix /api] HOSTNAME"))
+		}
+		params := api.CreateDomainParams{Hostname: flagset.Arg(0), PathPrefix: prefix}
+		domain, err := c.client.CreateDomain(id, params)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("domain %s%s added (%s)\n", domain.Hostname, domain.PathPrefix, domain.ID)
+		fmt.Println("verify the ownership of the domain by adding the following DNS record:")
+		fmt.Printf("\n%s\tTXT\t%q\n\n", domain.VerificationRecord(), domain.VerificationToken)
+		fmt.Printf("and run: raptor domain verify --id %s\n", domain.ID)
+	case "list":
+		id := c.parseEndpointID(endpointID)
+		domains, err := c.client.GetDomains(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDOMAIN\tVERIFIED")
+		for _, domain := range domains {
+			fmt.Fprintf(w, "%s\t%s%s\t%t\n", domain.ID, domain.Hostname, domain.PathPrefix, domain.Verified)
+		}
+		w.Flush()
+	case "verify", "remove":
+		id, err := uuid.Parse(domainID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid domain id given: %s", domainID))
+		}
+		if subcommand == "remove" {
+			if err := c.client.DeleteDomain(id); err != nil {
+				printErrorAndExit(err)
+			}
+			fmt.Printf("domain %s removed\n", id)
+			return
+		}
+		domain, err := c.client.VerifyDomain(id)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("could not verify domain, is the TXT record set? (%w)", err))
+		}
+		fmt.Printf("domain %s%s verified\n", domain.Hostname, domain.PathPrefix)
+	default:
+		printErrorAndExit(fmt.Errorf("unknown domain command: %s (add, list, verify or remove)", subcommand))
+	}
+}
+
+func (c command) handleAccount(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("account "+subcommand, flag.ExitOnError)
+	var (
+		name      string
+		accountID string
+		quota     types.Quota
+	)
+	flagset.StringVar(&name, "name", "", "The name of the account")
+	flagset.StringVar(&accountID, "id", "", "The id of the account")
+	flagset.Int64Var(&quota.MonthlyInvocations, "invocations", 0, "The maximum invocations per month")
+	flagset.DurationVar(&quota.MonthlyComputeTime, "compute-time", 0, "The maximum compute time per month (e.g. 10h)")
+	_ = flagset.Parse(args[1:])
+
+	switch subcommand {
+	case "create":
+		account, err := c.client.CreateAccount(api.CreateAccountParams{Name: name, Quota: quota})
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("account %s created (%s)\n", account.Name, account.ID)
+		fmt.Printf("create an API token with: raptor token create --account %s --name <name> --scope admin\n", account.ID)
+	case "quota":
+		id, err := uuid.Parse(accountID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid account id given: %s", accountID))
+		}
+		params := api.SetAccountQuotaParams{
+			MonthlyInvocations: quota.MonthlyInvocations,
+			MonthlyComputeTime: quota.MonthlyComputeTime,
+		}
+		account, err := c.client.SetAccountQuota(id, params)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("quota of account %s set to %d invocations and %s compute time per month\n",
+			account.ID, account.Quota.MonthlyInvocations, account.Quota.MonthlyComputeTime)
+	case "usage":
+		id, err := uuid.Parse(accountID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid account id given: %s", accountID))
+		}
+		usage, err := c.client.GetAccountUsage(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		b, err := json.MarshalIndent(usage, "", "    ")
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Println(string(b))
+	default:
+		printErrorAndExit(fmt.Errorf("unknown account command: %s (create, quota or usage)", subcommand))
+	}
+}
+
+func (c command) handleToken(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("token "+subcommand, flag.ExitOnError)
+	var accountID string
+	flagset.StringVar(&accountID, "account", "", "The id of the account")
+	var tokenID string
+	flagset.StringVar(&tokenID, "id", "", "The id of the API token")
+	var name string
+	flagset.StringVar(&name, "name", "", "The name of the API token")
+	var scopes stringList
+	flagset.Var(&scopes, "scope", "A scope of the API token (read, deploy, publish or admin), can be repeated")
+	_ = flagset.Parse(args[1:])
+
+	account, err := uuid.Parse(accountID)
+	if err != nil {
+		printErrorAndExit(fmt.Errorf("invalid account id given: %s", accountID))
+	}
+
+	switch subcommand {
+	case "create":
+		params := api.CreateAPITokenParams{Name: name, Scopes: scopes}
+		resp, err := c.client.CreateAPIToken(account, params)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("API token %s created (%s)\n", resp.APIToken.Name, resp.APIToken.ID)
+		fmt.Println("store the token safely, it will not be shown again:")
+		fmt.Printf("\n%s\n\n", resp.Token)
+	case "list":
+		tokens, err := c.client.GetAPITokens(account)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, token.Prefix, strings.Join(token.Scopes, ","), token.CreatedAT.Format(time.RFC3339))
+		}
+		w.Flush()
+	case "revoke":
+		id, err := uuid.Parse(tokenID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid token id given: %s", tokenID))
+		}
+		if err := c.client.DeleteAPIToken(account, id); err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("API token %s revoked\n", id)
+	default:
+		printErrorAndExit(fmt.Errorf("unknown token command: %s (create, list or revoke)", subcommand))
+	}
+}
+
+func (c command) handleRole(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	flagset := flag.NewFlagSet("role "+subcommand, flag.ExitOnError)
+	var endpointID string
+	flagset.StringVar(&endpointID, "endpoint", "", "The id or slug of the endpoint")
+	var tokenID string
+	flagset.StringVar(&tokenID, "token", "", "The id of the API token")
+	var role string
+	flagset.StringVar(&role, "role", "", "The role of the API token (viewer, developer, releaser or owner)")
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+
+	switch subcommand {
+	case "list":
+		roles, err := c.client.GetEndpointRoles(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TOKEN\tROLE\tCREATED")
+		for _, role := range roles {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", role.TokenID, role.Role, role.CreatedAT.Format(time.RFC3339))
+		}
+		w.Flush()
+	case "set", "remove":
+		token, err := uuid.Parse(tokenID)
+		if err != nil {
+			printErrorAndExit(fmt.Errorf("invalid token id given: %s", tokenID))
+		}
+		if subcommand == "remove" {
+			if err := c.client.DeleteEndpointRole(id, token); err != nil {
+				printErrorAndExit(err)
+			}
+			fmt.Printf("role of API token %s removed\n", token)
+			return
+		}
+		endpointRole, err := c.client.SetEndpointRole(id, token, api.SetEndpointRoleParams{Role: role})
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("API token %s is %s of endpoint %s\n", token, endpointRole.Role, id)
+	default:
+		printErrorAndExit(fmt.Errorf("unknown role command: %s (set, list or remove)", subcommand))
+	}
+}
+
+func (c command) handleAudit(args []string) {
+	flagset := flag.NewFlagSet("audit", flag.ExitOnError)
+	var params api.AuditParams
+	flagset.StringVar(&params.Endpoint, "endpoint", "", "The id or slug of the endpoint")
+	flagset.StringVar(&params.Action, "action", "", "Only show the events of the action, like deployment.publish")
+	flagset.IntVar(&params.Limit, "limit", 20, "The maximum number of events to show")
+	_ = flagset.Parse(args)
+
+	events, err := c.client.GetAudit(params)
+	if err != nil {
+		printErrorAndExit(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tACTION\tENDPOINT\tTARGET\tDETAIL\tSOURCE")
+	for _, event := range events {
+		var endpoint, target string
+		if event.EndpointID != uuid.Nil {
+			endpoint = event.EndpointID.String()
+		}
+		if event.TargetID != uuid.Nil {
+			target = event.TargetID.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.CreatedAT.Format(time.RFC3339), event.Actor, event.Action, endpoint, target, event.Detail, event.SourceIP)
+	}
+	w.Flush()
+}
+
+func (c command) handleSecret(args []string) {
+	if len(args) == 0 {
+		printUsage()
+	}
+	subcommand := args[0]
+	switch subcommand {
+	case "genkey":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Println(key)
+		return
+	case "rotate":
+		resp, err := c.client.RotateSecrets()
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("%d secrets re-encrypted with the current master key\n", resp.Rotated)
+		return
+	}
+
+	flagset := flag.NewFlagSet("secret "+subcommand, flag.ExitOnError)
+	var endpointID string
+	flagset.StringVar(&endpointID, "id", "", "The id or slug of the endpoint")
+	_ = flagset.Parse(args[1:])
+
+	id := c.parseEndpointID(endpointID)
+
+	switch subcommand {
+	case "list":
+		list, err := c.client.GetSecrets(id)
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tUPDATED")
+		for _, secret := range list {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", secret.Name, secret.Version, secret.UpdatedAT.Format(time.RFC3339))
+		}
+		w.Flush()
+	case "set":
+		// The value is read from stdin when it is not given, so it does not
+		// end up in the shell history.
+		if flagset.NArg() != 1 {
+			printErrorAndExit(fmt.Errorf("usage: raptor secret set --id <endpoint-id> NAME[=value]"))
+		}
+		name, value, ok := strings.Cut(flagset.Arg(0), "=")
+		if !ok {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				printErrorAndExit(err)
+			}
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+		secret, err := c.client.PutSecret(id, name, api.PutSecretParams{Value: value})
+		if err != nil {
+			printErrorAndExit(err)
+		}
+		fmt.Printf("secret %s set (version %d)\n", secret.Name, secret.Version)
+	case "unset":
+		if flagset.NArg() == 0 {
+			printErrorAndExit(fmt.Errorf("usage: raptor secret unset --id <endpoint-id> NAME [NAME ...]"))
+		}
+		for _, name := range flagset.Args() {
+			if err := c.client.DeleteSecret(id, name); err != nil {
+				printErrorAndExit(err)
+			}
+			fmt.Printf("secret %s deleted\n", name)
+		}
+	default:
+		printErrorAndExit(fmt.Errorf("unknown secret command: %s (set, unset, list, rotate or genkey)", subcommand))
+	}
+}
+
+func printEnv(env map[string]string) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, env[key])
+	}
 }
 
 func makeEnvMap(list []string) map[string]string {
 	m := make(map[string]string, len(list))
 	for _, value := range list {
-		parts := strings.Split(value, "=")
-		if len(parts) != 2 {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok {
 			printErrorAndExit(fmt.Errorf("env arguments need to be in the format of --env foo=bar --env name=bob"))
 		}
-		m[parts[0]] = parts[1]
+		m[key] = val
 	}
 	return m
 }
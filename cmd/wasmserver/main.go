@@ -4,16 +4,21 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/anthdm/hollywood/actor"
 	"github.com/anthdm/hollywood/cluster"
 	"github.com/anthdm/hollywood/remote"
 	"github.com/anthdm/raptor/internal/actrs"
 	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/runtime"
+	"github.com/anthdm/raptor/internal/secrets"
 	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/telemetry"
 )
 
 func main() {
@@ -27,15 +32,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	var (
-		user    = config.Get().Storage.User
-		pw      = config.Get().Storage.Password
-		dbname  = config.Get().Storage.Name
-		host    = config.Get().Storage.Host
-		port    = config.Get().Storage.Port
-		sslmode = config.Get().Storage.SSLMode
-	)
-	store, err := storage.NewSQLStore(user, pw, dbname, host, port, sslmode)
+	store, err := storage.New(config.Get().StorageDriver, config.Get().Storage)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -57,8 +54,32 @@ func main() {
 		ID:              config.Get().Cluster.ID,
 		ClusterProvider: cluster.NewSelfManagedProvider(),
 	})
-	c.RegisterKind(actrs.KindRuntime, actrs.NewRuntime(store, modCache), &cluster.KindConfig{})
-	c.Engine().Spawn(actrs.NewMetric, actrs.KindMetric, actor.WithID("1"))
+	pool := runtime.NewPool(runtime.PoolConfig{
+		MinSize:     config.Get().Runtime.PoolMinSize,
+		MaxSize:     config.Get().Runtime.PoolMaxSize,
+		IdleTimeout: time.Duration(config.Get().Runtime.PoolIdleTimeout),
+		// The LIVE runtimes of deleted endpoints and replaced deployments
+		// are released, together with the compiled modules of deleted
+		// endpoints.
+		IsActive: func(key runtime.PoolKey) bool {
+			endpoint, err := store.GetEndpoint(key.EndpointID)
+			return err == nil && endpoint.ActiveDeploymentID == key.DeploymentID
+		},
+		OnRelease: func(key runtime.PoolKey) {
+			if _, err := store.GetEndpoint(key.EndpointID); err != nil {
+				modCache.Delete(key.EndpointID)
+			}
+		},
+	})
+	defer pool.Close()
+	keyring, err := secrets.NewKeyringFromConfig(config.Get().Secrets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.RegisterKind(actrs.KindRuntime, actrs.NewRuntime(store, store, keyring, modCache, pool), &cluster.KindConfig{})
+	c.Engine().Spawn(actrs.NewMetric(store, metricStore), actrs.KindMetric, actor.WithID("1"))
+	c.Engine().Spawn(actrs.NewCanary(store, metricStore, store), actrs.KindCanary, actor.WithID("1"))
+	c.Engine().Spawn(actrs.NewLog(store, time.Duration(config.Get().Runtime.LogRetention)), actrs.KindLog, actor.WithID("1"))
 	c.Start()
 
 	server := actrs.NewWasmServer(
@@ -66,10 +87,22 @@ func main() {
 		c,
 		store,
 		metricStore,
+		store,
+		store,
 		modCache)
 	c.Engine().Spawn(server, actrs.KindWasmServer)
 	fmt.Printf("wasm server running\t%s\n", config.Get().WASMServerAddr)
 
+	// The metrics are not served on the public address of the wasm server.
+	if addr := config.Get().WASMTelemetryAddr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", telemetry.Handler())
+		go func() {
+			log.Fatal(http.ListenAndServe(addr, mux))
+		}()
+		fmt.Printf("wasm telemetry running\t%s\n", addr)
+	}
+
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
 	<-sigch
@@ -1,8 +1,13 @@
 // This should come from the official SDK. 
 // But there is no official SDK yet, so we keep it here.
-function respond(res, status) {
+function respond(res, status, headers = {}) {
+	for (const [key, value] of Object.entries(headers)) {
+		console.log(`raptor-header: ${key}: ${value}`)
+	}
 	console.log(res)
 	console.log(status)
 }
 
-respond("<h1>From my Raptor application</h1></br>some other stuff here</br>", 200)
\ No newline at end of file
+respond("<h1>From my Raptor application</h1></br>some other stuff here</br>", 200, {
+	"Content-Type": "text/html",
+})
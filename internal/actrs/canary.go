@@ -0,0 +1,125 @@
+package actrs
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+// The canary actor periodically evaluates the canary deployments of the
+// traffic splits of all endpoints against the runtime metrics they produced,
+// and promotes a healthy canary to the active deployment of its endpoint or
+// aborts a failing one by removing the traffic split. Both decisions are
+// recorded in the audit log with the system actor.
+
+const KindCanary = "canary"
+
+const canaryInterval = time.Second * 30
+
+type evaluateCanaries struct{}
+
+type Canary struct {
+	store       storage.Store
+	metricStore storage.MetricStore
+	auditStore  storage.AuditStore
+	repeater    actor.SendRepeater
+}
+
+func NewCanary(store storage.Store, metricStore storage.MetricStore, auditStore storage.AuditStore) actor.Producer {
+	return func() actor.Receiver {
+		return &Canary{
+			store:       store,
+			metricStore: metricStore,
+			auditStore:  auditStore,
+		}
+	}
+}
+
+func (c *Canary) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		c.repeater = ctx.SendRepeat(ctx.PID(), evaluateCanaries{}, canaryInterval)
+	case actor.Stopped:
+		c.repeater.Stop()
+	case evaluateCanaries:
+		c.evaluate(time.Now())
+	}
+}
+
+func (c *Canary) evaluate(now time.Time) {
+	endpoints, err := c.store.GetEndpoints(uuid.Nil)
+	if err != nil {
+		slog.Error("failed to get endpoints to evaluate canaries", "err", err)
+		return
+	}
+	for _, endpoint := range endpoints {
+		split := endpoint.TrafficSplit
+		if split == nil || split.Canary == nil {
+			continue
+		}
+		canary := split.Canary
+		counts, err := c.metricStore.GetRuntimeMetricCounts(endpoint.ID, storage.MetricFilter{
+			From:         split.CreatedAT,
+			DeploymentID: canary.DeploymentID,
+		})
+		if err != nil {
+			slog.Error("failed to get canary metrics", "err", err, "endpoint", endpoint.ID)
+			continue
+		}
+		decision, errorRate := canary.Evaluate(counts, split.CreatedAT, now)
+		var action string
+		switch decision {
+		case types.CanaryPromote:
+			// Publishing the canary removes the traffic split.
+			params := storage.UpdateEndpointParams{ActiveDeployID: canary.DeploymentID}
+			if err := c.store.UpdateEndpoint(endpoint.ID, params); err != nil {
+				slog.Error("failed to promote canary", "err", err, "endpoint", endpoint.ID)
+				continue
+			}
+			action = types.AuditCanaryPromote
+		case types.CanaryAbort:
+			if err := c.store.SetTrafficSplit(endpoint.ID, nil); err != nil {
+				slog.Error("failed to abort canary", "err", err, "endpoint", endpoint.ID)
+				continue
+			}
+			action = types.AuditCanaryAbort
+		default:
+			continue
+		}
+		detail := fmt.Sprintf("%d requests, error rate %.4f", counts.Count, errorRate)
+		c.audit(&endpoint, action, canary.DeploymentID, detail, now)
+		slog.Info("canary evaluated",
+			"decision", decision,
+			"endpoint", endpoint.ID,
+			"deployment", canary.DeploymentID,
+			"requests", counts.Count,
+			"error_rate", errorRate)
+	}
+}
+
+// audit records the automatic mutation of the endpoint, with its state before
+// the mutation and the state it has now.
+func (c *Canary) audit(before *types.Endpoint, action string, deployID uuid.UUID, detail string, now time.Time) {
+	event := &types.AuditEvent{
+		ID:         uuid.New(),
+		AccountID:  before.AccountID,
+		Actor:      types.ActorSystem,
+		Action:     action,
+		EndpointID: before.ID,
+		TargetID:   deployID,
+		Detail:     detail,
+		Before:     types.NewAuditState(before),
+		CreatedAT:  now.UTC(),
+	}
+	if after, err := c.store.GetEndpoint(before.ID); err == nil {
+		event.After = types.NewAuditState(after)
+	}
+	if err := c.auditStore.CreateAuditEvent(event); err != nil {
+		slog.Error("failed to record audit event", "action", action, "endpoint", before.ID, "err", err)
+	}
+}
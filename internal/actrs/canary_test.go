@@ -0,0 +1,130 @@
+package actrs
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+	"github.com/anthdm/raptor/internal/runtime"
+	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/anthdm/raptor/proto"
+	"github.com/google/uuid"
+)
+
+// trapWasm is a module whose _start traps with unreachable.
+var trapWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export _start
+	0x0a, 0x05, 0x01, 0x03, 0x00, 0x00, 0x0b, // code section: unreachable
+}
+
+func TestCanaryAbortsTrappingDeployment(t *testing.T) {
+	store := storage.NewMemoryStore()
+	account := types.NewAccount("canary")
+	if err := store.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := types.NewEndpoint("canary", "go", nil)
+	endpoint.AccountID = account.ID
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	active := types.NewDeployment(endpoint, trapWasm)
+	canary := types.NewDeployment(endpoint, trapWasm)
+	for _, deploy := range []*types.Deployment{active, canary} {
+		if err := store.CreateDeployment(deploy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.UpdateEndpoint(endpoint.ID, storage.UpdateEndpointParams{ActiveDeployID: active.ID}); err != nil {
+		t.Fatal(err)
+	}
+	split := &types.TrafficSplit{
+		Routes: []types.TrafficRoute{
+			{DeploymentID: active.ID, Weight: 50},
+			{DeploymentID: canary.ID, Weight: 50},
+		},
+		Canary: &types.CanaryPolicy{
+			DeploymentID: canary.ID,
+			MaxErrorRate: 0.5,
+			MinRequests:  1,
+			Duration:     time.Hour,
+		},
+		CreatedAT: time.Now().Add(-time.Minute),
+	}
+	if err := store.SetTrafficSplit(endpoint.ID, split); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := actor.NewEngine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := runtime.NewPool(runtime.PoolConfig{MaxSize: 1})
+	defer pool.Close()
+	metricPID := engine.Spawn(NewMetric(store, store), KindMetric, actor.WithID("1"))
+
+	pid := engine.Spawn(NewRuntime(store, store, nil, storage.NewDefaultModCache(), pool), KindRuntime)
+	res, err := engine.Request(pid, &proto.HTTPRequest{
+		ID:           uuid.NewString(),
+		URL:          "/",
+		Method:       http.MethodGet,
+		EndpointID:   endpoint.ID.String(),
+		DeploymentID: canary.ID.String(),
+		Runtime:      "go",
+		Canary:       true,
+	}, time.Second*5).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := res.(*proto.HTTPResponse)
+	if !ok || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a 500 response got %+v", res)
+	}
+
+	// Stopping the metric actor flushes the metric of the failed invocation.
+	var wg sync.WaitGroup
+	engine.Poison(metricPID, &wg)
+	wg.Wait()
+
+	usage, err := store.GetAccountUsage(account.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Invocations != 1 {
+		t.Fatalf("expected the failed invocation to count towards the usage got %+v", usage)
+	}
+
+	counts, err := store.GetRuntimeMetricCounts(endpoint.ID, storage.MetricFilter{DeploymentID: canary.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := split.Canary.Evaluate(counts, split.CreatedAT, time.Now()); decision != types.CanaryAbort {
+		t.Fatalf("expected decision %s got %s", types.CanaryAbort, decision)
+	}
+
+	(&Canary{store: store, metricStore: store, auditStore: store}).evaluate(time.Now())
+	endpoint, err = store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.TrafficSplit != nil {
+		t.Fatalf("expected the canary to be aborted got split %+v", endpoint.TrafficSplit)
+	}
+	if endpoint.ActiveDeploymentID != active.ID {
+		t.Fatalf("expected active deployment %s got %s", active.ID, endpoint.ActiveDeploymentID)
+	}
+
+	events, err := store.GetAuditEvents(storage.AuditFilter{EndpointID: endpoint.ID}, storage.Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != types.AuditCanaryAbort || events[0].Actor != types.ActorSystem || events[0].TargetID != canary.ID {
+		t.Fatalf("expected a canary abort event got %+v", events)
+	}
+}
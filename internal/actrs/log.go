@@ -0,0 +1,151 @@
+package actrs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+// The log actor is responsible for handling the logs that are being sent
+// from the runtimes locally from the same machine. Logs are buffered and
+// flushed into the log store in batches, logs older than the retention are
+// pruned periodically.
+
+const KindLog = "runtime_log"
+
+const (
+	logBatchSize     = 500
+	logFlushInterval = time.Second
+	logPruneInterval = time.Hour
+	// maxLogLines is the maximum number of lines that are kept per stream of
+	// a single invocation.
+	maxLogLines = 1000
+	// maxLogLineLength is the maximum length of a single line in bytes.
+	maxLogLineLength = 4096
+	// maxLogBytes is the maximum number of bytes of stderr that is buffered
+	// per invocation.
+	maxLogBytes = maxLogLines * maxLogLineLength
+	// maxStdoutBytes is the maximum number of bytes of stdout that is
+	// buffered per invocation. Guests that do not use the SDK print their
+	// response on stdout, so it is larger than the limit of the logs.
+	maxStdoutBytes = 4 * maxLogBytes
+)
+
+type (
+	flushLogs struct{}
+	pruneLogs struct{}
+)
+
+type Log struct {
+	store     storage.LogStore
+	retention time.Duration
+	buffer    []types.RuntimeLog
+	flusher   actor.SendRepeater
+	pruner    actor.SendRepeater
+}
+
+// NewLog returns a log actor that keeps the logs in the given store for the
+// given retention, a zero retention keeps them forever.
+func NewLog(store storage.LogStore, retention time.Duration) actor.Producer {
+	return func() actor.Receiver {
+		return &Log{
+			store:     store,
+			retention: retention,
+			buffer:    make([]types.RuntimeLog, 0, logBatchSize),
+		}
+	}
+}
+
+func (l *Log) Receive(c *actor.Context) {
+	switch msg := c.Message().(type) {
+	case actor.Started:
+		l.flusher = c.SendRepeat(c.PID(), flushLogs{}, logFlushInterval)
+		if l.retention > 0 {
+			l.pruner = c.SendRepeat(c.PID(), pruneLogs{}, logPruneInterval)
+		}
+	case actor.Stopped:
+		l.flusher.Stop()
+		if l.retention > 0 {
+			l.pruner.Stop()
+		}
+		l.flush()
+	case flushLogs:
+		l.flush()
+	case pruneLogs:
+		if err := l.store.DeleteRuntimeLogs(time.Now().Add(-l.retention)); err != nil {
+			slog.Error("failed to prune runtime logs", "err", err)
+		}
+	case []types.RuntimeLog:
+		l.buffer = append(l.buffer, msg...)
+		if len(l.buffer) >= logBatchSize {
+			l.flush()
+		}
+	}
+}
+
+// flush writes all buffered logs to the store. Logs that fail to be stored
+// are dropped so a failing store can not grow the buffer unbounded.
+func (l *Log) flush() {
+	if len(l.buffer) == 0 {
+		return
+	}
+	if err := l.store.CreateRuntimeLogs(l.buffer); err != nil {
+		slog.Error("failed to store runtime logs", "err", err, "count", len(l.buffer))
+	}
+	l.buffer = make([]types.RuntimeLog, 0, logBatchSize)
+}
+
+// limitedBuffer is a buffer that silently drops everything written after its
+// limit, so a guest can not exhaust the memory of the host by logging or by
+// writing responses.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+	// truncated reports whether anything was dropped.
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.Len(); n < len(p) {
+		b.Buffer.Write(p[:max(n, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// makeRuntimeLogs splits the output of a stream of an invocation in log lines.
+func makeRuntimeLogs(endpointID, deployID uuid.UUID, requestID, stream, output string) []types.RuntimeLog {
+	output = strings.TrimRight(output, "\n")
+	if len(output) == 0 {
+		return nil
+	}
+	var (
+		lines = strings.Split(output, "\n")
+		now   = time.Now()
+		logs  = make([]types.RuntimeLog, 0, min(len(lines), maxLogLines))
+	)
+	for _, line := range lines {
+		if len(logs) == maxLogLines {
+			break
+		}
+		if len(line) > maxLogLineLength {
+			line = line[:maxLogLineLength]
+		}
+		logs = append(logs, types.RuntimeLog{
+			EndpointID:   endpointID,
+			DeploymentID: deployID,
+			RequestID:    requestID,
+			Stream:       stream,
+			Line:         line,
+			Time:         now,
+		})
+	}
+	return logs
+}
@@ -0,0 +1,21 @@
+package actrs
+
+import "testing"
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 8}
+	for _, s := range []string{"1234", "5678"} {
+		if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("expected %d bytes written got %d (%v)", len(s), n, err)
+		}
+	}
+	if b.truncated {
+		t.Fatal("expected the buffer not to be truncated at its limit")
+	}
+	if n, err := b.Write([]byte("90")); err != nil || n != 2 {
+		t.Fatalf("expected the write over the limit to succeed got %d (%v)", n, err)
+	}
+	if b.String() != "12345678" || !b.truncated {
+		t.Fatalf("expected a truncated buffer got %q (truncated %v)", b.String(), b.truncated)
+	}
+}
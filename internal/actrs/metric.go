@@ -1,27 +1,120 @@
 package actrs
 
 import (
+	"log/slog"
+	"time"
+
 	"github.com/anthdm/hollywood/actor"
+	"github.com/anthdm/raptor/internal/storage"
 	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
 )
 
 // The metric actor is responsible for handling metrics that are being
-// sent from the runtimes locally from the same machine.
+// sent from the runtimes locally from the same machine. Metrics are
+// buffered and flushed into the metric store in batches. The metric actor
+// also adds up the usage of every invocation, previews and failed ones
+// included, to the usage of the account that owns the endpoint.
 
 const KindMetric = "runtime_metric"
 
-type Metric struct{}
+const (
+	metricBatchSize     = 100
+	metricFlushInterval = time.Second * 5
+)
+
+type flushMetrics struct{}
+
+// invocationUsage is sent by the runtimes for every invocation.
+type invocationUsage struct {
+	endpointID uuid.UUID
+	start      time.Time
+	duration   time.Duration
+}
+
+type usageKey struct {
+	accountID uuid.UUID
+	month     time.Time
+}
 
-func NewMetric() actor.Receiver {
-	return &Metric{}
+type Metric struct {
+	store       storage.Store
+	metricStore storage.MetricStore
+	buffer      []types.RuntimeMetric
+	usage       map[usageKey]types.Usage
+	// accounts caches the account of each endpoint, which never changes.
+	accounts map[uuid.UUID]uuid.UUID
+	repeater actor.SendRepeater
+}
+
+func NewMetric(store storage.Store, metricStore storage.MetricStore) actor.Producer {
+	return func() actor.Receiver {
+		return &Metric{
+			store:       store,
+			metricStore: metricStore,
+			buffer:      make([]types.RuntimeMetric, 0, metricBatchSize),
+			usage:       make(map[usageKey]types.Usage),
+			accounts:    make(map[uuid.UUID]uuid.UUID),
+		}
+	}
 }
 
-// TODO: Store metrics where they belong
 func (m *Metric) Receive(c *actor.Context) {
 	switch msg := c.Message().(type) {
 	case actor.Started:
+		m.repeater = c.SendRepeat(c.PID(), flushMetrics{}, metricFlushInterval)
 	case actor.Stopped:
+		m.repeater.Stop()
+		m.flush()
+	case flushMetrics:
+		m.flush()
 	case types.RuntimeMetric:
-		_ = msg
+		m.buffer = append(m.buffer, msg)
+		if len(m.buffer) >= metricBatchSize {
+			m.flush()
+		}
+	case invocationUsage:
+		m.addUsage(msg)
+	}
+}
+
+// addUsage buffers the usage of the invocation for the account of its
+// endpoint. Endpoints without an account are not metered.
+func (m *Metric) addUsage(msg invocationUsage) {
+	accountID, ok := m.accounts[msg.endpointID]
+	if !ok {
+		endpoint, err := m.store.GetEndpoint(msg.endpointID)
+		if err != nil {
+			slog.Warn("failed to get endpoint of invocation usage", "err", err, "endpoint", msg.endpointID)
+			return
+		}
+		accountID = endpoint.AccountID
+		m.accounts[msg.endpointID] = accountID
+	}
+	if accountID == uuid.Nil {
+		return
+	}
+	key := usageKey{accountID: accountID, month: types.MonthStart(msg.start)}
+	usage := m.usage[key]
+	usage.Invocations++
+	usage.ComputeTime += msg.duration
+	m.usage[key] = usage
+}
+
+// flush writes all buffered metrics to the store. Metrics that fail to be
+// stored are dropped so a failing store can not grow the buffer unbounded.
+func (m *Metric) flush() {
+	for key, usage := range m.usage {
+		if err := m.metricStore.AddAccountUsage(key.accountID, key.month, usage); err != nil {
+			slog.Error("failed to store account usage", "err", err, "account", key.accountID)
+		}
+	}
+	clear(m.usage)
+	if len(m.buffer) == 0 {
+		return
+	}
+	if err := m.metricStore.CreateRuntimeMetrics(m.buffer); err != nil {
+		slog.Error("failed to store runtime metrics", "err", err, "count", len(m.buffer))
 	}
+	m.buffer = make([]types.RuntimeMetric, 0, metricBatchSize)
 }
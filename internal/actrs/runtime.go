@@ -4,16 +4,18 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/anthdm/hollywood/actor"
+	"github.com/anthdm/raptor/internal/config"
 	"github.com/anthdm/raptor/internal/runtime"
+	"github.com/anthdm/raptor/internal/secrets"
 	"github.com/anthdm/raptor/internal/shared"
 	"github.com/anthdm/raptor/internal/spidermonkey"
 	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/telemetry"
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/anthdm/raptor/proto"
 	"github.com/google/uuid"
@@ -24,19 +26,33 @@ import (
 
 const KindRuntime = "runtime"
 
+// maxResponseBytes is the maximum number of bytes a guest can write with the
+// write_response host function per invocation.
+const maxResponseBytes = maxStdoutBytes
+
 // Runtime is an actor that can execute compiled WASM blobs in a distributed cluster.
+// A runtime actor handles a single request, the compiled modules and warm wasm
+// runtimes are kept in the pool that is shared by all runtime actors.
 type Runtime struct {
-	store    storage.Store
-	cache    storage.ModCacher
-	started  time.Time
-	deployID uuid.UUID
+	store       storage.Store
+	secretStore storage.SecretStore
+	keyring     *secrets.Keyring
+	cache       storage.ModCacher
+	pool        *runtime.Pool
+	started     time.Time
+	deployID    uuid.UUID
 }
 
-func NewRuntime(store storage.Store, cache storage.ModCacher) actor.Producer {
+// NewRuntime returns a runtime actor. The keyring decrypts the secrets of the
+// endpoints and can be nil when no secrets are used.
+func NewRuntime(store storage.Store, secretStore storage.SecretStore, keyring *secrets.Keyring, cache storage.ModCacher, pool *runtime.Pool) actor.Producer {
 	return func() actor.Receiver {
 		return &Runtime{
-			store: store,
-			cache: cache,
+			store:       store,
+			secretStore: secretStore,
+			keyring:     keyring,
+			cache:       cache,
+			pool:        pool,
 		}
 	}
 }
@@ -53,34 +69,90 @@ func (r *Runtime) Receive(c *actor.Context) {
 }
 
 func (r *Runtime) handleHTTPRequest(ctx *actor.Context, msg *proto.HTTPRequest) {
+	telemetry.RuntimeActivations.WithLabelValues(msg.Runtime).Inc()
 	r.deployID = uuid.MustParse(msg.DeploymentID)
+	endpointID, _ := uuid.Parse(msg.EndpointID)
+
+	var resp *proto.HTTPResponse
 	deploy, err := r.store.GetDeployment(r.deployID)
 	if err != nil {
 		slog.Warn("runtime could not find deploy from store", "err", err, "id", r.deployID)
-		respondError(ctx, http.StatusInternalServerError, "internal server error", msg.ID)
-		return
+		resp = errorResponse(http.StatusInternalServerError, "internal server error")
+	} else {
+		endpointID = deploy.EndpointID
+		resp = r.invoke(ctx, msg, deploy)
 	}
+	resp.RequestID = msg.ID
+
+	ctx.Respond(resp)
+
+	ctx.Engine().Poison(ctx.PID())
 
+	duration := time.Since(r.started)
+	pid := ctx.Engine().Registry.GetPID(KindMetric, "1")
+	// Every invocation counts towards the usage of the account.
+	ctx.Send(pid, invocationUsage{
+		endpointID: endpointID,
+		start:      r.started,
+		duration:   duration,
+	})
+
+	// only send metrics when its a request on LIVE. Failed invocations are
+	// recorded as well, the canary evaluation depends on them.
+	if !msg.Preview {
+		metric := types.RuntimeMetric{
+			ID:           uuid.New(),
+			StartTime:    r.started,
+			Duration:     duration,
+			DeploymentID: r.deployID,
+			EndpointID:   endpointID,
+			RequestURL:   msg.URL,
+			StatusCode:   int(resp.StatusCode),
+		}
+		ctx.Send(pid, metric)
+	}
+}
+
+// invoke runs the deployment with the request and returns the response of
+// the guest, or the error response of the failed invocation.
+func (r *Runtime) invoke(ctx *actor.Context, msg *proto.HTTPRequest, deploy *types.Deployment) *proto.HTTPResponse {
 	modCache, ok := r.cache.Get(deploy.EndpointID)
 	if !ok {
 		modCache = wazero.NewCompilationCache()
 		slog.Warn("no cache hit", "endpoint", deploy.EndpointID)
+		telemetry.CompileCacheMisses.Inc()
+	} else {
+		telemetry.CompileCacheHits.Inc()
+	}
+
+	env, err := r.environment(deploy.EndpointID, msg.Env)
+	if err != nil {
+		slog.Error("runtime could not decrypt secrets", "err", err, "endpoint", deploy.EndpointID)
+		return errorResponse(http.StatusInternalServerError, "internal server error")
 	}
 
 	b, err := prot.Marshal(msg)
 	if err != nil {
 		slog.Warn("failed to marshal incoming HTTP request", "err", err)
-		respondError(ctx, http.StatusInternalServerError, "internal server error", msg.ID)
-		return
+		return errorResponse(http.StatusInternalServerError, "internal server error")
 	}
 
 	in := bytes.NewReader(b)
-	out := &bytes.Buffer{}
+	out := &limitedBuffer{limit: maxStdoutBytes}
+	stderr := &limitedBuffer{limit: maxLogBytes}
+	response := &limitedBuffer{limit: maxResponseBytes}
 	args := runtime.InvokeArgs{
-		Env:   msg.Env,
-		In:    in,
-		Out:   out,
-		Cache: modCache,
+		Env:      env,
+		In:       in,
+		Out:      out,
+		Err:      stderr,
+		Response: response,
+		Cache:    modCache,
+		Limits: types.Limits{
+			MaxMemoryPages: msg.MaxMemoryPages,
+			Timeout:        time.Duration(msg.Timeout),
+			MaxCalls:       msg.MaxCalls,
+		}.WithDefaults(defaultLimits()),
 	}
 
 	switch msg.Runtime {
@@ -90,53 +162,107 @@ func (r *Runtime) handleHTTPRequest(ctx *actor.Context, msg *proto.HTTPRequest)
 		args.Blob = spidermonkey.WasmBlob
 		args.Args = []string{"", "-e", string(deploy.Blob)}
 	default:
-		err = fmt.Errorf("invalid runtime: %s", msg.Runtime)
+		slog.Warn("invalid runtime", "runtime", msg.Runtime, "deployment", deploy.ID)
+		return errorResponse(http.StatusInternalServerError, "internal server error")
 	}
 
-	err = runtime.Invoke(context.Background(), args)
+	key := runtime.PoolKey{
+		EndpointID:   deploy.EndpointID,
+		DeploymentID: deploy.ID,
+		// The runtimes of a canary are not kept warm and do not replace the
+		// runtimes of the active deployment.
+		Live: !msg.Preview && !msg.Canary,
+	}
+	err = r.pool.Invoke(context.Background(), key, args)
 	if err != nil {
+		sendLogs(ctx, deploy, msg.ID, out.String(), stderr.String())
 		slog.Error("runtime invoke error", "err", err)
-		respondError(ctx, http.StatusInternalServerError, "internal server error", msg.ID)
-		return
+		telemetry.InvokeErrors.WithLabelValues(msg.Runtime).Inc()
+		status, message := runtime.ErrorStatus(err)
+		return errorResponse(int32(status), message)
 	}
 
-	res, status, err := shared.ParseRuntimeHTTPResponse(out.String())
-	if err != nil {
-		respondError(ctx, http.StatusInternalServerError, "internal server error", msg.ID)
-		return
+	if response.truncated {
+		sendLogs(ctx, deploy, msg.ID, out.String(), stderr.String())
+		slog.Warn("guest response exceeds the response limit", "limit", maxResponseBytes, "deployment", deploy.ID)
+		return errorResponse(http.StatusInternalServerError, "response exceeds the size limit")
 	}
-	resp := &proto.HTTPResponse{
-		Response:   []byte(res),
-		RequestID:  msg.ID,
-		StatusCode: int32(status),
+	// A truncated response of the line protocol can not be parsed reliably.
+	if response.Len() == 0 && out.truncated {
+		sendLogs(ctx, deploy, msg.ID, out.String(), stderr.String())
+		slog.Warn("guest response exceeds the stdout limit", "limit", maxStdoutBytes, "deployment", deploy.ID)
+		return errorResponse(http.StatusInternalServerError, "response exceeds the stdout limit")
 	}
 
-	ctx.Respond(resp)
+	resp, logs, err := shared.ParseRuntimeResponse(response.Bytes(), out.String())
+	if err != nil {
+		sendLogs(ctx, deploy, msg.ID, out.String(), stderr.String())
+		slog.Warn("failed to parse runtime response", "err", err)
+		return errorResponse(http.StatusInternalServerError, "internal server error")
+	}
+	sendLogs(ctx, deploy, msg.ID, logs, stderr.String())
 
 	r.cache.Put(deploy.EndpointID, modCache)
 
-	ctx.Engine().Poison(ctx.PID())
+	return resp
+}
 
-	// only send metrics when its a request on LIVE
-	if !msg.Preview {
-		metric := types.RuntimeMetric{
-			ID:           uuid.New(),
-			StartTime:    r.started,
-			Duration:     time.Since(r.started),
-			DeploymentID: deploy.ID,
-			EndpointID:   deploy.EndpointID,
-			RequestURL:   msg.URL,
-			StatusCode:   status,
-		}
-		pid := ctx.Engine().Registry.GetPID(KindMetric, "1")
-		ctx.Send(pid, metric)
+// sendLogs sends the output the guest printed during the invocation to the
+// log actor.
+func sendLogs(ctx *actor.Context, deploy *types.Deployment, requestID, stdout, stderr string) {
+	logs := append(
+		makeRuntimeLogs(deploy.EndpointID, deploy.ID, requestID, types.LogStreamStdout, stdout),
+		makeRuntimeLogs(deploy.EndpointID, deploy.ID, requestID, types.LogStreamStderr, stderr)...)
+	if len(logs) == 0 {
+		return
 	}
+	pid := ctx.Engine().Registry.GetPID(KindLog, "1")
+	ctx.Send(pid, logs)
 }
 
-func respondError(ctx *actor.Context, code int32, msg string, id string) {
-	ctx.Respond(&proto.HTTPResponse{
+// defaultLimits returns the limits of the runtime config that are used for
+// the limits an endpoint does not set.
+func defaultLimits() types.Limits {
+	cfg := config.Get().Runtime
+	return types.Limits{
+		MaxMemoryPages: cfg.MaxMemoryPages,
+		Timeout:        time.Duration(cfg.Timeout),
+		MaxCalls:       cfg.MaxCalls,
+	}
+}
+
+func errorResponse(code int32, msg string) *proto.HTTPResponse {
+	return &proto.HTTPResponse{
 		Response:   []byte(msg),
 		StatusCode: code,
-		RequestID:  id,
-	})
+	}
+}
+
+// environment returns the environment of an invocation of the given endpoint,
+// which is the environment of the request with the decrypted secrets of the
+// endpoint added. The secrets are only added to the environment of the guest,
+// not to the request it reads on stdin.
+func (r *Runtime) environment(endpointID uuid.UUID, env map[string]string) (map[string]string, error) {
+	list, err := r.secretStore.GetSecrets(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return env, nil
+	}
+	if r.keyring == nil {
+		return nil, secrets.ErrNotConfigured
+	}
+	merged := make(map[string]string, len(env)+len(list))
+	for k, v := range env {
+		merged[k] = v
+	}
+	for _, secret := range list {
+		value, err := r.keyring.Open(secret)
+		if err != nil {
+			return nil, err
+		}
+		merged[secret.Name] = value
+	}
+	return merged, nil
 }
@@ -1,20 +1,62 @@
 package actrs
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/anthdm/hollywood/actor"
 	"github.com/anthdm/hollywood/cluster"
+	"github.com/anthdm/raptor/internal/concurrency"
+	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/ratelimit"
 	"github.com/anthdm/raptor/internal/shared"
 	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/telemetry"
+	"github.com/anthdm/raptor/internal/types"
 	"github.com/anthdm/raptor/proto"
 	"github.com/google/uuid"
 )
 
 const KindWasmServer = "wasm_server"
 
+// domainRefreshInterval is the interval at which the wasm server reloads the
+// domains from the store, so claimed, verified and removed domains are routed
+// without a restart.
+const domainRefreshInterval = time.Second * 10
+
+// quotaRefreshInterval is the interval at which the wasm server recomputes
+// the monthly usage of the accounts. Together with the flush interval of the
+// metrics it bounds how far an account can go over its quota.
+const quotaRefreshInterval = time.Second * 30
+
+// rateLimitPruneInterval is the interval at which the wasm server drops the
+// token buckets that are full again.
+const rateLimitPruneInterval = time.Minute
+
+// forwardGrace is the time the wasm server waits for the response of a
+// runtime on top of the timeout of the invocation, which covers compiling
+// the module and the round trip through the cluster.
+const forwardGrace = 5 * time.Second
+
+type (
+	refreshDomains  struct{}
+	refreshQuotas   struct{}
+	pruneRateLimits struct{}
+	// cancelResponse drops the pending response of a request that is no
+	// longer waited for.
+	cancelResponse struct{ requestID string }
+)
+
 type requestWithResponse struct {
 	request  *proto.HTTPRequest
 	response chan *proto.HTTPResponse
@@ -29,24 +71,40 @@ func newRequestWithResponse(request *proto.HTTPRequest) requestWithResponse {
 
 // WasmServer is an HTTP server that will proxy and route the request to the corresponding function.
 type WasmServer struct {
-	server      *http.Server
-	self        *actor.PID
-	store       storage.Store
-	metricStore storage.MetricStore
-	cache       storage.ModCacher
-	cluster     *cluster.Cluster
-	responses   map[string]chan *proto.HTTPResponse
+	server       *http.Server
+	self         *actor.PID
+	store        storage.Store
+	metricStore  storage.MetricStore
+	domainStore  storage.DomainStore
+	accountStore storage.AccountStore
+	cache        storage.ModCacher
+	cluster      *cluster.Cluster
+	responses    map[string]chan *proto.HTTPResponse
+	// domains is the routing table of the verified domains, it is read by
+	// the HTTP handlers and replaced by the actor.
+	domains atomic.Pointer[types.DomainTable]
+	// overQuota holds the accounts that exceeded their monthly quota, it is
+	// read by the HTTP handlers and replaced by the actor.
+	overQuota atomic.Pointer[map[uuid.UUID]bool]
+	limiter   *ratelimit.Limiter
+	// slots limits the concurrent invocations of each endpoint.
+	slots     *concurrency.Limiter
+	repeaters []actor.SendRepeater
 }
 
 // NewWasmServer return a new wasm server given a storage and a mod cache.
-func NewWasmServer(addr string, cluster *cluster.Cluster, store storage.Store, metricStore storage.MetricStore, cache storage.ModCacher) actor.Producer {
+func NewWasmServer(addr string, cluster *cluster.Cluster, store storage.Store, metricStore storage.MetricStore, domainStore storage.DomainStore, accountStore storage.AccountStore, cache storage.ModCacher) actor.Producer {
 	return func() actor.Receiver {
 		s := &WasmServer{
-			store:       store,
-			metricStore: metricStore,
-			cache:       cache,
-			cluster:     cluster,
-			responses:   make(map[string]chan *proto.HTTPResponse),
+			store:        store,
+			metricStore:  metricStore,
+			domainStore:  domainStore,
+			accountStore: accountStore,
+			cache:        cache,
+			cluster:      cluster,
+			responses:    make(map[string]chan *proto.HTTPResponse),
+			limiter:      ratelimit.New(),
+			slots:        concurrency.New(observeSlots),
 		}
 		server := &http.Server{
 			Handler: s,
@@ -62,19 +120,42 @@ func (s *WasmServer) Receive(c *actor.Context) {
 	case actor.Started:
 		s.initialize(c)
 	case actor.Stopped:
+		for _, repeater := range s.repeaters {
+			repeater.Stop()
+		}
+	case refreshDomains:
+		s.refreshDomains()
+	case refreshQuotas:
+		s.refreshQuotas()
+	case pruneRateLimits:
+		s.limiter.Prune()
 	case requestWithResponse:
 		s.responses[msg.request.ID] = msg.response
+		telemetry.WasmInflightRequests.Set(float64(len(s.responses)))
 		s.sendRequestToRuntime(msg.request)
 	case *proto.HTTPResponse:
 		if resp, ok := s.responses[msg.RequestID]; ok {
 			resp <- msg
 			delete(s.responses, msg.RequestID)
+			telemetry.WasmInflightRequests.Set(float64(len(s.responses)))
+		}
+	case cancelResponse:
+		if _, ok := s.responses[msg.requestID]; ok {
+			delete(s.responses, msg.requestID)
+			telemetry.WasmInflightRequests.Set(float64(len(s.responses)))
 		}
 	}
 }
 
 func (s *WasmServer) initialize(c *actor.Context) {
 	s.self = c.PID()
+	s.refreshDomains()
+	s.refreshQuotas()
+	s.repeaters = []actor.SendRepeater{
+		c.SendRepeat(s.self, refreshDomains{}, domainRefreshInterval),
+		c.SendRepeat(s.self, refreshQuotas{}, quotaRefreshInterval),
+		c.SendRepeat(s.self, pruneRateLimits{}, rateLimitPruneInterval),
+	}
 	go func() {
 		log.Fatal(s.server.ListenAndServe())
 	}()
@@ -87,6 +168,18 @@ func (s *WasmServer) sendRequestToRuntime(req *proto.HTTPRequest) {
 
 // TODO(anthdm): Handle the favicon.ico
 func (s *WasmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	// Requests to the verified domains of an endpoint are served by its LIVE
+	// deployments, whatever their path is.
+	if domain, ok := s.domains.Load().Match(r.Host, r.URL.Path); ok {
+		endpoint, err := s.store.GetEndpoint(domain.EndpointID)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, []byte(err.Error()))
+			return
+		}
+		s.serveLive(w, r, start, endpoint, domainCookiePath(domain))
+		return
+	}
 	path := strings.TrimPrefix(r.URL.Path, "/")
 	path = strings.TrimSuffix(path, "/")
 	pathParts := strings.Split(path, "/")
@@ -95,80 +188,368 @@ func (s *WasmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		writeResponse(w, http.StatusBadRequest, []byte("invalid request url"))
 		return
 	}
-	if pathParts[0] != "live" && pathParts[0] != "preview" {
+	switch pathParts[0] {
+	case "live":
+		// LIVE endpoints are referenced by their id or their slug.
+		endpoint, err := s.getEndpoint(pathParts[1])
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, []byte(err.Error()))
+			return
+		}
+		s.serveLive(w, r, start, endpoint, "/live/"+pathParts[1])
+	case "preview":
+		deployID, err := uuid.Parse(pathParts[1])
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
+			return
+		}
+		s.servePreview(w, r, start, deployID)
+	default:
 		writeResponse(w, http.StatusBadRequest, []byte("invalid request url"))
-		return
 	}
+}
 
-	requestID := uuid.NewString()
-	r.Header.Set("x-request-id", requestID)
-	req, err := shared.MakeProtoRequest(requestID, r)
+// getEndpoint returns the endpoint with the given id or slug.
+func (s *WasmServer) getEndpoint(ref string) (*types.Endpoint, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return s.store.GetEndpoint(id)
+	}
+	return s.store.GetEndpointBySlug(ref)
+}
+
+// serveLive serves the request with the active deployment of the endpoint,
+// unless the traffic split routes the client to another deployment. The
+// cookie path is the path of the bucket cookie of the traffic split.
+func (s *WasmServer) serveLive(w http.ResponseWriter, r *http.Request, start time.Time, endpoint *types.Endpoint, cookiePath string) {
+	if !endpoint.HasActiveDeploy() {
+		writeResponse(w, http.StatusNotFound, []byte("endpoint does not have any published deploy"))
+		return
+	}
+	if !s.allow(w, r, endpoint) {
+		return
+	}
+	req, err := makeRequest(r)
 	if err != nil {
 		writeResponse(w, http.StatusInternalServerError, []byte(err.Error()))
 		return
 	}
+	req.Runtime = endpoint.Runtime
+	req.EndpointID = endpoint.ID.String()
+	deployID := endpoint.ActiveDeploymentID
+	if split := endpoint.TrafficSplit; split != nil && len(split.Routes) > 0 {
+		deployID = split.Route(trafficBucket(w, r, endpoint, cookiePath))
+	}
+	req.DeploymentID = deployID.String()
+	req.Canary = deployID != endpoint.ActiveDeploymentID
+	req.Env = endpoint.Environment
+	req.Preview = false
+	setRequestLimits(req, endpoint.Limits)
+	s.forwardWithSlot(w, r, req, start, endpoint)
+}
 
+// servePreview serves the request with the given deployment, whether it is
+// published or not.
+func (s *WasmServer) servePreview(w http.ResponseWriter, r *http.Request, start time.Time, deployID uuid.UUID) {
+	deploy, err := s.store.GetDeployment(deployID)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
+		return
+	}
+	endpoint, err := s.store.GetEndpoint(deploy.EndpointID)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
+		return
+	}
+	if !s.allow(w, r, endpoint) {
+		return
+	}
+	req, err := makeRequest(r)
 	if err != nil {
 		writeResponse(w, http.StatusInternalServerError, []byte(err.Error()))
 		return
 	}
-	if pathParts[0] == "live" {
-		endpointID, err := uuid.Parse(pathParts[1])
-		if err != nil {
-			writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
-			return
+	req.Runtime = endpoint.Runtime
+	req.EndpointID = endpoint.ID.String()
+	req.DeploymentID = deploy.ID.String()
+	req.Env = endpoint.Environment
+	req.Preview = true
+	setRequestLimits(req, endpoint.Limits)
+	s.forwardWithSlot(w, r, req, start, endpoint)
+}
+
+// allow returns true when the request is within the rate limits of the
+// endpoint and the quota of its account. Otherwise it responds with 429 and
+// the time after which the request can be retried. Live and preview requests
+// share the limits of the endpoint.
+func (s *WasmServer) allow(w http.ResponseWriter, r *http.Request, endpoint *types.Endpoint) bool {
+	id := endpoint.ID.String()
+	if s.isOverQuota(endpoint.AccountID) {
+		telemetry.WasmRejectedRequests.WithLabelValues(id, "quota").Inc()
+		now := time.Now()
+		nextMonth := types.MonthStart(now).AddDate(0, 1, 0)
+		writeTooManyRequests(w, nextMonth.Sub(now), "monthly quota of the account exceeded")
+		return false
+	}
+	limits := endpoint.RateLimits.WithDefaults(defaultRateLimits())
+	// The client limit is checked first, so a client over its limit does
+	// not use up the requests of the other clients of the endpoint.
+	if ok, wait := s.limiter.Allow(id+"/"+clientIP(r), limits.Client); !ok {
+		telemetry.WasmRejectedRequests.WithLabelValues(id, "client_rate_limit").Inc()
+		writeTooManyRequests(w, wait, "rate limit of the client exceeded")
+		return false
+	}
+	if ok, wait := s.limiter.Allow(id, limits.Endpoint); !ok {
+		telemetry.WasmRejectedRequests.WithLabelValues(id, "endpoint_rate_limit").Inc()
+		writeTooManyRequests(w, wait, "rate limit of the endpoint exceeded")
+		return false
+	}
+	return true
+}
+
+// isOverQuota returns true when the account exceeded its monthly quota.
+func (s *WasmServer) isOverQuota(accountID uuid.UUID) bool {
+	overQuota := s.overQuota.Load()
+	return overQuota != nil && (*overQuota)[accountID]
+}
+
+// clientIP returns the IP address of the client of the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeTooManyRequests responds with 429 and a Retry-After header of the
+// given duration in whole seconds.
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeResponse(w, http.StatusTooManyRequests, []byte(msg))
+}
+
+// forwardWithSlot forwards the request once it got a slot of the concurrency
+// limit of the endpoint, waiting in its queue when all slots are taken. It
+// responds with 503 when the queue is full or the request timed out waiting.
+// Live and preview requests share the slots of the endpoint.
+func (s *WasmServer) forwardWithSlot(w http.ResponseWriter, r *http.Request, req *proto.HTTPRequest, start time.Time, endpoint *types.Endpoint) {
+	limit := endpoint.Concurrency.WithDefaults(defaultConcurrency())
+	release, err := s.slots.Acquire(r.Context(), req.EndpointID, limit)
+	if err != nil {
+		reason := "queue_full"
+		if errors.Is(err, concurrency.ErrQueueTimeout) {
+			reason = "queue_timeout"
 		}
-		endpoint, err := s.store.GetEndpoint(endpointID)
-		if err != nil {
-			writeResponse(w, http.StatusNotFound, []byte(err.Error()))
+		telemetry.WasmRejectedRequests.WithLabelValues(req.EndpointID, reason).Inc()
+		writeResponse(w, http.StatusServiceUnavailable, []byte(err.Error()))
+		return
+	}
+	defer release()
+	timeout := endpoint.Limits.WithDefaults(defaultLimits()).Timeout
+	s.forward(w, r, req, start, timeout)
+}
+
+// observeSlots exposes the active and queued requests of the concurrency
+// limit of an endpoint, the series of idle endpoints are removed.
+func observeSlots(endpointID string, active, queued int) {
+	if active == 0 && queued == 0 {
+		telemetry.WasmActiveInvocations.DeleteLabelValues(endpointID)
+		telemetry.WasmQueuedRequests.DeleteLabelValues(endpointID)
+		return
+	}
+	telemetry.WasmActiveInvocations.WithLabelValues(endpointID).Set(float64(active))
+	telemetry.WasmQueuedRequests.WithLabelValues(endpointID).Set(float64(queued))
+}
+
+// forward sends the request to a runtime and writes its response. It stops
+// waiting when the client goes away, and responds with 504 when the runtime
+// does not respond within the timeout of the invocation.
+func (s *WasmServer) forward(w http.ResponseWriter, r *http.Request, req *proto.HTTPRequest, start time.Time, timeout time.Duration) {
+	reqres := newRequestWithResponse(req)
+	s.cluster.Engine().Send(s.self, reqres)
+
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout+forwardGrace)
+		defer cancel()
+	}
+	var resp *proto.HTTPResponse
+	select {
+	case resp = <-reqres.response:
+	case <-ctx.Done():
+		s.cluster.Engine().Send(s.self, cancelResponse{requestID: req.ID})
+		if r.Context().Err() != nil {
 			return
 		}
-		if !endpoint.HasActiveDeploy() {
-			writeResponse(w, http.StatusNotFound, []byte("endpoint does not have any published deploy"))
-			return
+		slog.Warn("runtime did not respond in time", "endpoint", req.EndpointID, "request", req.ID)
+		resp = &proto.HTTPResponse{
+			Response:   []byte("runtime did not respond in time"),
+			StatusCode: http.StatusGatewayTimeout,
 		}
-		req.Runtime = endpoint.Runtime
-		req.EndpointID = endpointID.String()
-		// When serving LIVE endpoints we use the active deployment id.
-		req.DeploymentID = endpoint.ActiveDeploymentID.String()
-		req.Env = endpoint.Environment
-		req.Preview = false
 	}
-	if pathParts[0] == "preview" {
-		deployID, err := uuid.Parse(pathParts[1])
-		if err != nil {
-			writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
-			return
+
+	code := strconv.Itoa(int(resp.StatusCode))
+	telemetry.WasmRequests.WithLabelValues(req.EndpointID, req.Runtime, code).Inc()
+	telemetry.WasmRequestDuration.WithLabelValues(req.EndpointID, req.Runtime).Observe(time.Since(start).Seconds())
+
+	shared.WriteResponseHeader(w.Header(), resp.Header)
+	w.WriteHeader(int(resp.StatusCode))
+	w.Write(resp.Response)
+}
+
+func makeRequest(r *http.Request) (*proto.HTTPRequest, error) {
+	requestID := uuid.NewString()
+	r.Header.Set("x-request-id", requestID)
+	return shared.MakeProtoRequest(requestID, r)
+}
+
+// domainCookiePath returns the path of the bucket cookie of requests to the
+// domain.
+func domainCookiePath(domain *types.Domain) string {
+	if domain.PathPrefix == "" {
+		return "/"
+	}
+	return domain.PathPrefix
+}
+
+// refreshDomains reloads the routing table of the verified domains. The
+// table is only replaced when it was loaded, so a failing store keeps the
+// last known routes.
+func (s *WasmServer) refreshDomains() {
+	domains, err := s.domainStore.GetDomains(uuid.Nil)
+	if err != nil {
+		slog.Error("failed to refresh domains", "err", err)
+		return
+	}
+	table := types.NewDomainTable(domains)
+	if old := s.domains.Swap(table); old.Len() != table.Len() {
+		slog.Info("domains refreshed", "domains", table.Len())
+	}
+}
+
+// refreshQuotas recomputes which accounts exceeded their monthly quota. The
+// accounts are only replaced when all of them were loaded, so a failing store
+// keeps the last known state.
+func (s *WasmServer) refreshQuotas() {
+	endpoints, err := s.store.GetEndpoints(uuid.Nil)
+	if err != nil {
+		slog.Error("failed to refresh quotas", "err", err)
+		return
+	}
+	var (
+		defaults  = defaultQuota()
+		since     = types.MonthStart(time.Now())
+		overQuota = make(map[uuid.UUID]bool)
+		checked   = make(map[uuid.UUID]bool)
+	)
+	for _, endpoint := range endpoints {
+		// Endpoints created without authorization have no account and
+		// no quota.
+		id := endpoint.AccountID
+		if id == uuid.Nil || checked[id] {
+			continue
 		}
-		deploy, err := s.store.GetDeployment(deployID)
+		checked[id] = true
+		account, err := s.accountStore.GetAccount(id)
 		if err != nil {
-			writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
+			slog.Error("failed to refresh quotas", "account", id, "err", err)
 			return
 		}
-		endpoint, err := s.store.GetEndpoint(deploy.EndpointID)
+		quota := account.Quota.WithDefaults(defaults)
+		if quota.Unlimited() {
+			continue
+		}
+		usage, err := s.metricStore.GetAccountUsage(id, since)
 		if err != nil {
-			writeResponse(w, http.StatusBadRequest, []byte(err.Error()))
+			slog.Error("failed to refresh quotas", "account", id, "err", err)
 			return
 		}
-		req.Runtime = endpoint.Runtime
-		req.EndpointID = endpoint.ID.String()
-		// When serving PREVIEW endpoints, we just use the deployment id from the
-		// request.
-		req.DeploymentID = deploy.ID.String()
-		req.Env = endpoint.Environment
-		req.Preview = true
+		if quota.Exceeded(usage) {
+			overQuota[id] = true
+		}
 	}
+	s.overQuota.Store(&overQuota)
+}
 
-	reqres := newRequestWithResponse(req)
-	s.cluster.Engine().Send(s.self, reqres)
+// trafficCookie is the name of the cookie that keeps the traffic bucket of a
+// client that is not assigned by the sticky header of a traffic split.
+const trafficCookie = "raptor-bucket"
 
-	resp := <-reqres.response
+const trafficCookieMaxAge = 30 * 24 * 60 * 60
 
-	w.WriteHeader(int(resp.StatusCode))
-	w.Write(resp.Response)
+// trafficBucket returns the traffic bucket of the client of the request. A
+// client without the sticky header of the traffic split of the endpoint or a
+// bucket cookie is assigned to a random bucket that is set as cookie on the
+// given path.
+func trafficBucket(w http.ResponseWriter, r *http.Request, endpoint *types.Endpoint, cookiePath string) int {
+	if header := endpoint.TrafficSplit.StickyHeader; header != "" {
+		if key := r.Header.Get(header); key != "" {
+			return types.TrafficBucket(endpoint.ID.String() + "/" + key)
+		}
+	}
+	if cookie, err := r.Cookie(trafficCookie); err == nil {
+		bucket, err := strconv.Atoi(cookie.Value)
+		if err == nil && bucket >= 0 && bucket < types.TrafficBuckets {
+			return bucket
+		}
+	}
+	bucket := rand.Intn(types.TrafficBuckets)
+	http.SetCookie(w, &http.Cookie{
+		Name:     trafficCookie,
+		Value:    strconv.Itoa(bucket),
+		Path:     cookiePath,
+		MaxAge:   trafficCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return bucket
+}
+
+// setRequestLimits sets the resource limits of the endpoint on the request
+// that is forwarded to the runtime.
+func setRequestLimits(req *proto.HTTPRequest, limits types.Limits) {
+	req.MaxMemoryPages = limits.MaxMemoryPages
+	req.Timeout = int64(limits.Timeout)
+	req.MaxCalls = limits.MaxCalls
+}
+
+// defaultRateLimits returns the rate limits of the configuration that apply
+// to endpoints without their own.
+func defaultRateLimits() types.RateLimits {
+	cfg := config.Get().RateLimit
+	return types.RateLimits{
+		Endpoint: types.RateLimit{Rate: cfg.EndpointRate, Burst: cfg.EndpointBurst},
+		Client:   types.RateLimit{Rate: cfg.ClientRate, Burst: cfg.ClientBurst},
+	}
+}
+
+// defaultConcurrency returns the concurrency limits of the configuration that
+// apply to endpoints without their own.
+func defaultConcurrency() types.Concurrency {
+	cfg := config.Get().Concurrency
+	return types.Concurrency{
+		MaxConcurrent: cfg.MaxConcurrent,
+		MaxQueue:      cfg.MaxQueue,
+		QueueTimeout:  time.Duration(cfg.QueueTimeout),
+	}
+}
+
+// defaultQuota returns the quota of the configuration that applies to
+// accounts without their own.
+func defaultQuota() types.Quota {
+	cfg := config.Get().Quota
+	return types.Quota{
+		MonthlyInvocations: cfg.MonthlyInvocations,
+		MonthlyComputeTime: time.Duration(cfg.MonthlyComputeTime),
+	}
 }
 
 func writeResponse(w http.ResponseWriter, code int, b []byte) {
-	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(code)
 	w.Write(b)
 }
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+// audit records a mutation in the audit log, with the actor and the source IP
+// of the request. The mutation already happened, so failing to record it is
+// logged instead of failing the request.
+func (s *Server) audit(r *http.Request, event types.AuditEvent) {
+	event.ID = uuid.New()
+	event.Actor, event.TokenID = requestActor(r)
+	if event.AccountID == uuid.Nil {
+		event.AccountID = requestAccountID(r)
+	}
+	event.SourceIP = sourceIP(r)
+	event.CreatedAT = time.Now().UTC()
+	if err := s.auditStore.CreateAuditEvent(&event); err != nil {
+		slog.Error("failed to record audit event", "action", event.Action, "endpoint", event.EndpointID, "err", err)
+	}
+}
+
+// auditEndpoint records a mutation of the endpoint, with its state before the
+// mutation and the state it has now.
+func (s *Server) auditEndpoint(r *http.Request, action string, before *types.Endpoint, targetID uuid.UUID, detail string) {
+	event := types.AuditEvent{
+		Action:     action,
+		AccountID:  before.AccountID,
+		EndpointID: before.ID,
+		TargetID:   targetID,
+		Detail:     detail,
+		Before:     types.NewAuditState(before),
+	}
+	if after, err := s.store.GetEndpoint(before.ID); err == nil {
+		event.After = types.NewAuditState(after)
+	}
+	s.audit(r, event)
+}
+
+// requestActor returns the actor and the id of the API token of the request.
+func requestActor(r *http.Request) (string, uuid.UUID) {
+	id, ok := r.Context().Value(authKey{}).(*identity)
+	switch {
+	case !ok:
+		return types.ActorAnonymous, uuid.Nil
+	case id.token == nil:
+		return types.ActorOperator, uuid.Nil
+	default:
+		return id.token.Prefix, id.token.ID
+	}
+}
+
+// sourceIP returns the IP address of the client of the request.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trafficDetail describes the routes of a traffic split in the audit log.
+func trafficDetail(routes []types.TrafficRoute) string {
+	parts := make([]string, len(routes))
+	for i, route := range routes {
+		parts[i] = fmt.Sprintf("%s=%d", route.DeploymentID, route.Weight)
+	}
+	return strings.Join(parts, ",")
+}
+
+// AuditParams holds the query parameters of the audit log.
+type AuditParams struct {
+	// Endpoint is the id or slug of the endpoint.
+	Endpoint string
+	Action   string
+	Limit    int
+	Offset   int
+}
+
+// handleGetAudit returns the audit log of the account of the request, newest
+// first. The log can be filtered by the id or slug of an endpoint and by
+// action.
+func (s *Server) handleGetAudit(w http.ResponseWriter, r *http.Request) error {
+	p, err := parsePagination(r)
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	query := r.URL.Query()
+	filter := storage.AuditFilter{
+		AccountID: requestAccountID(r),
+		Action:    query.Get("action"),
+	}
+	if ref := query.Get("endpoint"); ref != "" {
+		// Deleted endpoints can only be referenced by their id, the events
+		// of other accounts are excluded by the account of the filter.
+		if id, err := uuid.Parse(ref); err == nil {
+			filter.EndpointID = id
+		} else {
+			endpoint, err := s.lookupEndpoint(r, ref)
+			if err != nil {
+				return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+			}
+			filter.EndpointID = endpoint.ID
+		}
+	}
+	events, err := s.auditStore.GetAuditEvents(filter, p)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,495 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errOperatorOnly = errors.New("only the operator token is allowed to do this")
+)
+
+type authKey struct{}
+
+// identity is the caller of an authorized request. The token is nil for the
+// operator, who authorized with the API token of the config and has access to
+// all accounts.
+type identity struct {
+	token *types.APIToken
+}
+
+// withAPIToken authorizes requests with the operator token or the API token
+// of an account, which is looked up by its hash.
+func (s *Server) withAPIToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse(errUnauthorized))
+			return
+		}
+		id := &identity{}
+		if s.operatorToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.operatorToken)) != 1 {
+			apiToken, err := s.accountStore.GetAPITokenByHash(types.HashAPIToken(token))
+			if err != nil {
+				writeJSON(w, http.StatusUnauthorized, ErrorResponse(errUnauthorized))
+				return
+			}
+			id.token = apiToken
+		}
+		ctx := context.WithValue(r.Context(), authKey{}, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestToken returns the API token of the account that made the request. It
+// returns nil when authorization is disabled or the request was made by the
+// operator.
+func requestToken(r *http.Request) *types.APIToken {
+	id, ok := r.Context().Value(authKey{}).(*identity)
+	if !ok {
+		return nil
+	}
+	return id.token
+}
+
+// requestAccountID returns the id of the account that made the request, or
+// uuid.Nil when the request is not limited to an account.
+func requestAccountID(r *http.Request) uuid.UUID {
+	if token := requestToken(r); token != nil {
+		return token.AccountID
+	}
+	return uuid.Nil
+}
+
+// canAccess returns true when the request is allowed to access the resources
+// of the given account.
+func canAccess(r *http.Request, accountID uuid.UUID) bool {
+	account := requestAccountID(r)
+	return account == uuid.Nil || account == accountID
+}
+
+// requireScope only passes requests made with an API token that grants the
+// given scope.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := requestToken(r); token != nil && !token.HasScope(scope) {
+				err := fmt.Errorf("api token does not have the %s scope", scope)
+				writeJSON(w, http.StatusForbidden, ErrorResponse(err))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireOperator only passes requests that are not limited to an account.
+func requireOperator(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) != nil {
+			writeJSON(w, http.StatusForbidden, ErrorResponse(errOperatorOnly))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CreateAccountParams holds all the necessary fields to create a new account.
+type CreateAccountParams struct {
+	Name string `json:"name"`
+	// Monthly quota of the account, zero values use the defaults of the
+	// quota configuration.
+	Quota types.Quota `json:"quota"`
+}
+
+func (p CreateAccountParams) validate() error {
+	if len(p.Name) < 3 || len(p.Name) > 100 {
+		return fmt.Errorf("name of the account should be longer than 3 and less than 100 characters")
+	}
+	return validateQuota(p.Quota)
+}
+
+func validateQuota(quota types.Quota) error {
+	if quota.MonthlyInvocations < 0 || quota.MonthlyComputeTime < 0 {
+		return fmt.Errorf("quota can not be negative")
+	}
+	return nil
+}
+
+func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) error {
+	var params CreateAccountParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	defer r.Body.Close()
+
+	if err := params.validate(); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	account := types.NewAccount(params.Name)
+	account.Quota = params.Quota
+	if err := s.accountStore.CreateAccount(account); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:    types.AuditAccountCreate,
+		AccountID: account.ID,
+		TargetID:  account.ID,
+		Detail:    account.Name,
+	})
+	return writeJSON(w, http.StatusOK, account)
+}
+
+// parseAccount returns the account of the id URL parameter when the request
+// is allowed to access it.
+func (s *Server) parseAccount(r *http.Request) (*types.Account, error) {
+	ref := chi.URLParam(r, "id")
+	id, err := uuid.Parse(ref)
+	if err != nil || !canAccess(r, id) {
+		return nil, fmt.Errorf("could not find account (%s)", ref)
+	}
+	return s.accountStore.GetAccount(id)
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, account)
+}
+
+// SetAccountQuotaParams holds the monthly quota of an account, zero values
+// use the defaults of the quota configuration.
+type SetAccountQuotaParams struct {
+	MonthlyInvocations int64         `json:"monthly_invocations"`
+	MonthlyComputeTime time.Duration `json:"monthly_compute_time"`
+}
+
+// handleSetAccountQuota replaces the monthly quota of an account. The wasm
+// server picks up the new quota with the next refresh of the usage.
+func (s *Server) handleSetAccountQuota(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params SetAccountQuotaParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	defer r.Body.Close()
+
+	quota := types.Quota{
+		MonthlyInvocations: params.MonthlyInvocations,
+		MonthlyComputeTime: params.MonthlyComputeTime,
+	}
+	if err := validateQuota(quota); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if err := s.accountStore.SetAccountQuota(account.ID, quota); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:    types.AuditAccountQuota,
+		AccountID: account.ID,
+		TargetID:  account.ID,
+		Detail:    fmt.Sprintf("invocations=%d,compute_time=%s", quota.MonthlyInvocations, quota.MonthlyComputeTime),
+	})
+	account.Quota = quota
+	return writeJSON(w, http.StatusOK, account)
+}
+
+// AccountUsageResponse holds the usage of an account in the current calendar
+// month and the quota it is limited by.
+type AccountUsageResponse struct {
+	AccountID uuid.UUID `json:"account_id"`
+	// Since is the start of the current calendar month (UTC).
+	Since time.Time   `json:"since"`
+	Usage types.Usage `json:"usage"`
+	// Quota is the quota of the account with the defaults of the quota
+	// configuration applied, zero values do not limit the usage.
+	Quota    types.Quota `json:"quota"`
+	Exceeded bool        `json:"exceeded"`
+}
+
+func (s *Server) handleGetAccountUsage(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	since := types.MonthStart(time.Now())
+	usage, err := s.metricStore.GetAccountUsage(account.ID, since)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	cfg := config.Get().Quota
+	quota := account.Quota.WithDefaults(types.Quota{
+		MonthlyInvocations: cfg.MonthlyInvocations,
+		MonthlyComputeTime: time.Duration(cfg.MonthlyComputeTime),
+	})
+	return writeJSON(w, http.StatusOK, AccountUsageResponse{
+		AccountID: account.ID,
+		Since:     since,
+		Usage:     usage,
+		Quota:     quota,
+		Exceeded:  quota.Exceeded(usage),
+	})
+}
+
+// CreateAPITokenParams holds all the necessary fields to create a new API
+// token for an account.
+type CreateAPITokenParams struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (p CreateAPITokenParams) validate() error {
+	if len(p.Name) < 3 || len(p.Name) > 100 {
+		return fmt.Errorf("name of the token should be longer than 3 and less than 100 characters")
+	}
+	return types.ValidateScopes(p.Scopes)
+}
+
+// CreateAPITokenResponse holds the created API token and the token itself,
+// which is not returned again.
+type CreateAPITokenResponse struct {
+	Token    string          `json:"token"`
+	APIToken *types.APIToken `json:"api_token"`
+}
+
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params CreateAPITokenParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	defer r.Body.Close()
+
+	if err := params.validate(); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	apiToken, token := types.NewAPIToken(account.ID, params.Name, params.Scopes)
+	if err := s.accountStore.CreateAPIToken(apiToken); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:    types.AuditTokenCreate,
+		AccountID: account.ID,
+		TargetID:  apiToken.ID,
+		Detail:    fmt.Sprintf("%s (%s)", apiToken.Name, strings.Join(apiToken.Scopes, ", ")),
+	})
+	return writeJSON(w, http.StatusOK, CreateAPITokenResponse{Token: token, APIToken: apiToken})
+}
+
+func (s *Server) handleGetAPITokens(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	tokens, err := s.accountStore.GetAPITokens(account.ID)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, tokens)
+}
+
+// handleDeleteAPIToken revokes an API token, after which it no longer
+// authorizes requests.
+func (s *Server) handleDeleteAPIToken(w http.ResponseWriter, r *http.Request) error {
+	account, err := s.parseAccount(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if err := s.accountStore.DeleteAPIToken(account.ID, tokenID); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:    types.AuditTokenDelete,
+		AccountID: account.ID,
+		TargetID:  tokenID,
+	})
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: tokenID})
+}
+
+// endpointResolver returns the endpoint a request acts on.
+type endpointResolver func(r *http.Request) (*types.Endpoint, error)
+
+// endpointOfDeployment returns the endpoint of the deployment of the id URL
+// parameter.
+func (s *Server) endpointOfDeployment(r *http.Request) (*types.Endpoint, error) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err
+	}
+	deploy, err := s.store.GetDeployment(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.getEndpoint(r, deploy.EndpointID)
+}
+
+// endpointOfDomain returns the endpoint of the domain of the id URL
+// parameter.
+func (s *Server) endpointOfDomain(r *http.Request) (*types.Endpoint, error) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err
+	}
+	domain, err := s.domainStore.GetDomain(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.getEndpoint(r, domain.EndpointID)
+}
+
+// endpointRole returns the role of the request on the endpoint. Tokens with
+// the admin scope are owners of all endpoints of their account. Other tokens
+// have the role they are granted on the endpoint. Without a granted role,
+// they are developers of endpoints without any roles and viewers of endpoints
+// with roles, so changing what is served LIVE always takes a granted role.
+func (s *Server) endpointRole(r *http.Request, endpoint *types.Endpoint) (string, error) {
+	token := requestToken(r)
+	if token == nil || token.HasScope(types.ScopeAdmin) {
+		return types.RoleOwner, nil
+	}
+	if role, err := s.accountStore.GetEndpointRole(endpoint.ID, token.ID); err == nil {
+		return role.Role, nil
+	}
+	roles, err := s.accountStore.GetEndpointRoles(endpoint.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(roles) == 0 {
+		return types.RoleDeveloper, nil
+	}
+	return types.RoleViewer, nil
+}
+
+// requireRole only passes requests that have at least the given role on the
+// endpoint they act on.
+func (s *Server) requireRole(role string, resolve endpointResolver) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			endpoint, err := resolve(r)
+			if err != nil {
+				writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+				return
+			}
+			have, err := s.endpointRole(r, endpoint)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+				return
+			}
+			if !types.RoleAllows(have, role) {
+				err := fmt.Errorf("the %s role is required on endpoint %s, api token has the %s role", role, endpoint.ID, have)
+				writeJSON(w, http.StatusForbidden, ErrorResponse(err))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) handleGetEndpointRoles(w http.ResponseWriter, r *http.Request) error {
+	endpointID, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	roles, err := s.accountStore.GetEndpointRoles(endpointID)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, roles)
+}
+
+// SetEndpointRoleParams holds the role to grant an API token on an endpoint.
+type SetEndpointRoleParams struct {
+	Role string `json:"role"`
+}
+
+// handleSetEndpointRole grants an API token of the account that owns the
+// endpoint a role on the endpoint.
+func (s *Server) handleSetEndpointRole(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := s.parseEndpoint(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	var params SetEndpointRoleParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	defer r.Body.Close()
+
+	if err := types.ValidateRole(params.Role); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if endpoint.AccountID == uuid.Nil {
+		err := fmt.Errorf("endpoint %s is not owned by an account", endpoint.ID)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	tokens, err := s.accountStore.GetAPITokens(endpoint.AccountID)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	if !slices.ContainsFunc(tokens, func(t *types.APIToken) bool { return t.ID == tokenID }) {
+		err := fmt.Errorf("could not find api token (%s)", tokenID)
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	role := types.NewEndpointRole(endpoint.ID, tokenID, params.Role)
+	if err := s.accountStore.SetEndpointRole(role); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditRoleSet,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		TargetID:   tokenID,
+		Detail:     role.Role,
+	})
+	return writeJSON(w, http.StatusOK, role)
+}
+
+func (s *Server) handleDeleteEndpointRole(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := s.parseEndpoint(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if err := s.accountStore.DeleteEndpointRole(endpoint.ID, tokenID); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditRoleDelete,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		TargetID:   tokenID,
+	})
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: tokenID})
+}
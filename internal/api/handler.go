@@ -3,8 +3,12 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+
+	"github.com/anthdm/raptor/internal/storage"
 )
 
 var (
@@ -37,3 +41,29 @@ func writeJSON(w http.ResponseWriter, status int, v any) error {
 	w.WriteHeader(status)
 	return json.NewEncoder(w).Encode(v)
 }
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePagination parses the limit and offset query parameters of the given
+// request.
+func parsePagination(r *http.Request) (storage.Pagination, error) {
+	p := storage.Pagination{Limit: defaultPageLimit}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return p, fmt.Errorf("limit should be a number between 1 and %d", maxPageLimit)
+		}
+		p.Limit = limit
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, fmt.Errorf("offset should be a positive number")
+		}
+		p.Offset = offset
+	}
+	return p, nil
+}
@@ -5,29 +5,68 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/secrets"
 	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/telemetry"
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 )
 
 // Server serves the public run API.
 type Server struct {
-	router      *chi.Mux
-	store       storage.Store
-	metricStore storage.MetricStore
-	cache       storage.ModCacher
+	router       *chi.Mux
+	store        storage.Store
+	metricStore  storage.MetricStore
+	logStore     storage.LogStore
+	secretStore  storage.SecretStore
+	domainStore  storage.DomainStore
+	accountStore storage.AccountStore
+	auditStore   storage.AuditStore
+	// keyring encrypts the secrets, it is nil when no master key is
+	// configured.
+	keyring *secrets.Keyring
+	cache   storage.ModCacher
+	// followInterval is the interval at which new logs are polled when
+	// following the logs of an endpoint.
+	followInterval time.Duration
+	// lookupTXT resolves the TXT records that verify the ownership of
+	// domains.
+	lookupTXT func(name string) ([]string, error)
+	// authorization requires every request to carry an API token. The
+	// operator token has access to all accounts, it is empty when only the
+	// API tokens of accounts are accepted.
+	authorization bool
+	operatorToken string
 }
 
-// NewServer returns a new server given a Store interface.
-func NewServer(store storage.Store, metricStore storage.MetricStore, cache storage.ModCacher) *Server {
+// NewServer returns a new server given a Store interface. The keyring can be
+// nil, in which case secrets can not be used.
+func NewServer(store storage.Store, metricStore storage.MetricStore, logStore storage.LogStore, secretStore storage.SecretStore, domainStore storage.DomainStore, accountStore storage.AccountStore, auditStore storage.AuditStore, keyring *secrets.Keyring, cache storage.ModCacher) *Server {
 	return &Server{
-		store:       store,
-		cache:       cache,
-		metricStore: metricStore,
+		store:          store,
+		cache:          cache,
+		metricStore:    metricStore,
+		logStore:       logStore,
+		secretStore:    secretStore,
+		domainStore:    domainStore,
+		accountStore:   accountStore,
+		auditStore:     auditStore,
+		keyring:        keyring,
+		followInterval: defaultFollowInterval,
+		lookupTXT:      net.LookupTXT,
+		authorization:  config.Get().Authorization,
+		operatorToken:  config.Get().APIToken,
 	}
 }
 
@@ -39,16 +78,57 @@ func (s *Server) Listen(addr string) error {
 
 func (s *Server) initRouter() {
 	s.router = chi.NewRouter()
-	if config.Get().Authorization {
+	s.router.Use(withMetrics)
+	if s.authorization {
 		s.router.Use(s.withAPIToken)
 	}
+	var (
+		deploy   = s.router.With(requireScope(types.ScopeDeploy))
+		publish  = s.router.With(requireScope(types.ScopePublish))
+		admin    = s.router.With(requireScope(types.ScopeAdmin))
+		operator = s.router.With(requireOperator)
+		// The roles on the endpoint of the id URL parameter.
+		developer = s.requireRole(types.RoleDeveloper, s.parseEndpoint)
+		releaser  = s.requireRole(types.RoleReleaser, s.parseEndpoint)
+		owner     = s.requireRole(types.RoleOwner, s.parseEndpoint)
+	)
 	s.router.Get("/status", handleStatus)
+	s.router.Handle("/metrics", telemetry.Handler())
 	s.router.Get("/endpoint/{id}", makeAPIHandler(s.handleGetEndpoint))
 	s.router.Get("/endpoint", makeAPIHandler(s.handleGetEndpoints))
 	s.router.Get("/endpoint/{id}/metrics", makeAPIHandler(s.handleGetEndpointMetrics))
-	s.router.Post("/endpoint", makeAPIHandler(s.handleCreateEndpoint))
-	s.router.Post("/endpoint/{id}/deployment", makeAPIHandler(s.handleCreateDeployment))
-	s.router.Post("/publish/{id}", makeAPIHandler(s.handlePublish))
+	s.router.Get("/endpoint/{id}/metrics/summary", makeAPIHandler(s.handleGetEndpointMetricsSummary))
+	s.router.Get("/endpoint/{id}/deployment", makeAPIHandler(s.handleGetDeployments))
+	s.router.Get("/endpoint/{id}/logs", makeAPIHandler(s.handleGetEndpointLogs))
+	deploy.Post("/endpoint", makeAPIHandler(s.handleCreateEndpoint))
+	deploy.With(developer).Post("/endpoint/{id}/deployment", makeAPIHandler(s.handleCreateDeployment))
+	publish.With(s.requireRole(types.RoleReleaser, s.endpointOfDeployment)).Post("/publish/{id}", makeAPIHandler(s.handlePublish))
+	publish.With(releaser).Post("/endpoint/{id}/rollback", makeAPIHandler(s.handleRollback))
+	publish.With(releaser).Put("/endpoint/{id}/traffic", makeAPIHandler(s.handleSetTrafficSplit))
+	publish.With(releaser).Delete("/endpoint/{id}/traffic", makeAPIHandler(s.handleDeleteTrafficSplit))
+	publish.With(releaser).Post("/endpoint/{id}/traffic/promote", makeAPIHandler(s.handlePromoteCanary))
+	deploy.With(releaser).Patch("/endpoint/{id}", makeAPIHandler(s.handleUpdateEndpoint))
+	s.router.Get("/endpoint/{id}/secrets", makeAPIHandler(s.handleGetSecrets))
+	deploy.With(releaser).Put("/endpoint/{id}/secrets/{name}", makeAPIHandler(s.handlePutSecret))
+	deploy.With(releaser).Delete("/endpoint/{id}/secrets/{name}", makeAPIHandler(s.handleDeleteSecret))
+	operator.Post("/secrets/rotate", makeAPIHandler(s.handleRotateSecrets))
+	s.router.Get("/endpoint/{id}/domains", makeAPIHandler(s.handleGetDomains))
+	admin.With(owner).Post("/endpoint/{id}/domains", makeAPIHandler(s.handleCreateDomain))
+	admin.With(s.requireRole(types.RoleOwner, s.endpointOfDomain)).Post("/domain/{id}/verify", makeAPIHandler(s.handleVerifyDomain))
+	admin.With(s.requireRole(types.RoleOwner, s.endpointOfDomain)).Delete("/domain/{id}", makeAPIHandler(s.handleDeleteDomain))
+	s.router.Get("/endpoint/{id}/roles", makeAPIHandler(s.handleGetEndpointRoles))
+	admin.With(owner).Put("/endpoint/{id}/roles/{tokenID}", makeAPIHandler(s.handleSetEndpointRole))
+	admin.With(owner).Delete("/endpoint/{id}/roles/{tokenID}", makeAPIHandler(s.handleDeleteEndpointRole))
+	admin.With(owner).Delete("/endpoint/{id}", makeAPIHandler(s.handleDeleteEndpoint))
+	deploy.With(s.requireRole(types.RoleReleaser, s.endpointOfDeployment)).Delete("/deployment/{id}", makeAPIHandler(s.handleDeleteDeployment))
+	s.router.Get("/audit", makeAPIHandler(s.handleGetAudit))
+	operator.Post("/account", makeAPIHandler(s.handleCreateAccount))
+	s.router.Get("/account/{id}", makeAPIHandler(s.handleGetAccount))
+	operator.Put("/account/{id}/quota", makeAPIHandler(s.handleSetAccountQuota))
+	s.router.Get("/account/{id}/usage", makeAPIHandler(s.handleGetAccountUsage))
+	admin.Get("/account/{id}/tokens", makeAPIHandler(s.handleGetAPITokens))
+	admin.Post("/account/{id}/tokens", makeAPIHandler(s.handleCreateAPIToken))
+	admin.Delete("/account/{id}/tokens/{tokenID}", makeAPIHandler(s.handleDeleteAPIToken))
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -60,26 +140,159 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// maxMemoryPages is the number of 64KiB pages of the 4GiB address space of a
+// wasm module.
+const maxMemoryPages = 65536
+
 // CreateEndpointParams holds all the necessary fields to create a new run application.
 type CreateEndpointParams struct {
 	// Name of the endpoint
 	Name string `json:"name"`
+	// Slug of the endpoint in live URLs, derived from the name when empty.
+	Slug string `json:"slug,omitempty"`
 	// Runtime on which the code will be invoked. (go or js for now)
 	Runtime string `json:"runtime"`
 	// A map of environment variables
 	Environment map[string]string `json:"environment"`
+	// Resource limits of each invocation, zero values use the defaults of
+	// the runtime configuration.
+	Limits types.Limits `json:"limits"`
+	// Rate limits of the requests to the endpoint, zero values use the
+	// defaults of the rate limit configuration.
+	RateLimits types.RateLimits `json:"rate_limits"`
+	// Concurrency limits of the invocations of the endpoint, zero values use
+	// the defaults of the concurrency configuration.
+	Concurrency types.Concurrency `json:"concurrency"`
 }
 
 func (p CreateEndpointParams) validate() error {
+	if err := validateEndpointName(p.Name); err != nil {
+		return err
+	}
+	if p.Slug != "" {
+		if err := types.ValidateSlug(p.Slug); err != nil {
+			return err
+		}
+	}
+	if err := validateEnvironment(p.Environment); err != nil {
+		return err
+	}
+	if _, ok := types.Runtimes[p.Runtime]; !ok {
+		return fmt.Errorf("invalid runtime given: %s", p.Runtime)
+	}
+	if p.Limits.MaxMemoryPages > maxMemoryPages {
+		return fmt.Errorf("max memory pages can be maximum %d", maxMemoryPages)
+	}
+	if p.Limits.Timeout < 0 {
+		return fmt.Errorf("timeout can not be negative")
+	}
+	return validateRateLimits(p.RateLimits)
+}
+
+func validateRateLimits(limits types.RateLimits) error {
+	if limits.Endpoint.Rate < 0 || limits.Endpoint.Burst < 0 {
+		return fmt.Errorf("endpoint rate limit can not be negative")
+	}
+	if limits.Client.Rate < 0 || limits.Client.Burst < 0 {
+		return fmt.Errorf("client rate limit can not be negative")
+	}
+	return nil
+}
+
+func validateConcurrency(c types.Concurrency) error {
+	if c.MaxConcurrent < 0 || c.MaxQueue < 0 || c.QueueTimeout < 0 {
+		return fmt.Errorf("concurrency limits can not be negative")
+	}
+	return nil
+}
+
+func validateEndpointName(name string) error {
 	minlen, maxlen := 3, 50
-	if len(p.Name) < minlen {
+	if len(name) < minlen {
 		return fmt.Errorf("endpoint name should be at least %d characters long", minlen)
 	}
-	if len(p.Name) > maxlen {
+	if len(name) > maxlen {
 		return fmt.Errorf("endpoint name can be maximum %d characters long", maxlen)
 	}
-	if _, ok := types.Runtimes[p.Runtime]; !ok {
-		return fmt.Errorf("invalid runtime given: %s", p.Runtime)
+	return nil
+}
+
+func validateEnvironment(env map[string]string) error {
+	for key := range env {
+		if err := validateEnvKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateEnvKey(key string) error {
+	if len(key) == 0 {
+		return fmt.Errorf("environment variable name can not be empty")
+	}
+	if strings.ContainsAny(key, "=\x00") {
+		return fmt.Errorf("invalid environment variable name: %q", key)
+	}
+	return nil
+}
+
+// UpdateEndpointParams holds the fields of an endpoint that can be updated.
+// Omitted fields are left unchanged.
+type UpdateEndpointParams struct {
+	// Name of the endpoint
+	Name string `json:"name,omitempty"`
+	// Slug of the endpoint in live URLs, the old slug stops resolving.
+	Slug string `json:"slug,omitempty"`
+	// Environment replaces all environment variables of the endpoint, an
+	// empty map removes them.
+	Environment map[string]string `json:"environment"`
+	// SetEnvironment sets the given environment variables and keeps the
+	// others.
+	SetEnvironment map[string]string `json:"set_environment,omitempty"`
+	// UnsetEnvironment removes the given environment variables.
+	UnsetEnvironment []string `json:"unset_environment,omitempty"`
+	// RateLimits replaces the rate limits of the endpoint.
+	RateLimits *types.RateLimits `json:"rate_limits,omitempty"`
+	// Concurrency replaces the concurrency limits of the endpoint.
+	Concurrency *types.Concurrency `json:"concurrency,omitempty"`
+}
+
+func (p UpdateEndpointParams) validate() error {
+	merge := len(p.SetEnvironment) > 0 || len(p.UnsetEnvironment) > 0
+	if p.Environment != nil && merge {
+		return fmt.Errorf("environment can not be replaced and merged in the same update")
+	}
+	if len(p.Name) == 0 && len(p.Slug) == 0 && p.Environment == nil && p.RateLimits == nil && p.Concurrency == nil && !merge {
+		return fmt.Errorf("no fields to update given")
+	}
+	if len(p.Name) > 0 {
+		if err := validateEndpointName(p.Name); err != nil {
+			return err
+		}
+	}
+	if len(p.Slug) > 0 {
+		if err := types.ValidateSlug(p.Slug); err != nil {
+			return err
+		}
+	}
+	if err := validateEnvironment(p.Environment); err != nil {
+		return err
+	}
+	if err := validateEnvironment(p.SetEnvironment); err != nil {
+		return err
+	}
+	for _, key := range p.UnsetEnvironment {
+		if err := validateEnvKey(key); err != nil {
+			return err
+		}
+	}
+	if p.RateLimits != nil {
+		if err := validateRateLimits(*p.RateLimits); err != nil {
+			return err
+		}
+	}
+	if p.Concurrency != nil {
+		return validateConcurrency(*p.Concurrency)
 	}
 	return nil
 }
@@ -96,19 +309,109 @@ func (s *Server) handleCreateEndpoint(w http.ResponseWriter, r *http.Request) er
 	}
 
 	endpoint := types.NewEndpoint(params.Name, params.Runtime, params.Environment)
+	endpoint.Limits = params.Limits
+	endpoint.RateLimits = params.RateLimits
+	endpoint.Concurrency = params.Concurrency
+	endpoint.AccountID = requestAccountID(r)
+	if params.Slug != "" {
+		if _, err := s.store.GetEndpointBySlug(params.Slug); err == nil {
+			err := fmt.Errorf("slug %s is already taken", params.Slug)
+			return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+		}
+		endpoint.Slug = params.Slug
+	} else {
+		endpoint.Slug = s.uniqueSlug(types.Slugify(params.Name))
+	}
 	if err := s.store.CreateEndpoint(endpoint); err != nil {
 		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
 	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditEndpointCreate,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		Detail:     endpoint.Name,
+		After:      types.NewAuditState(endpoint),
+	})
 	return writeJSON(w, http.StatusOK, endpoint)
 }
 
+// maxSlugSuffix is the highest number that is appended to a derived slug to
+// make it unique.
+const maxSlugSuffix = 100
+
+// uniqueSlug returns the given slug, or the slug with the lowest number
+// appended that is not taken by another endpoint.
+func (s *Server) uniqueSlug(slug string) string {
+	candidate := slug
+	for i := 2; i <= maxSlugSuffix; i++ {
+		if _, err := s.store.GetEndpointBySlug(candidate); err != nil {
+			return candidate
+		}
+		suffix := "-" + strconv.Itoa(i)
+		candidate = types.TruncateSlug(slug, types.MaxSlugLength-len(suffix)) + suffix
+	}
+	// Give up on numbering and make the slug unique with random characters.
+	suffix := "-" + uuid.NewString()[:8]
+	return types.TruncateSlug(slug, types.MaxSlugLength-len(suffix)) + suffix
+}
+
+// parseEndpointID returns the id of the endpoint of the request, which is
+// referenced by its id or its slug in the id URL parameter.
+func (s *Server) parseEndpointID(r *http.Request) (uuid.UUID, error) {
+	endpoint, err := s.parseEndpoint(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return endpoint.ID, nil
+}
+
+// parseEndpoint returns the endpoint of the id URL parameter, which is the id
+// or the slug of the endpoint, when it is owned by the account of the
+// request.
+func (s *Server) parseEndpoint(r *http.Request) (*types.Endpoint, error) {
+	return s.lookupEndpoint(r, chi.URLParam(r, "id"))
+}
+
+// lookupEndpoint returns the endpoint with the given id or slug when it is
+// owned by the account of the request.
+func (s *Server) lookupEndpoint(r *http.Request, ref string) (*types.Endpoint, error) {
+	var (
+		endpoint *types.Endpoint
+		err      error
+	)
+	if id, perr := uuid.Parse(ref); perr == nil {
+		endpoint, err = s.store.GetEndpoint(id)
+	} else {
+		endpoint, err = s.store.GetEndpointBySlug(ref)
+	}
+	if err != nil || !canAccess(r, endpoint.AccountID) {
+		return nil, fmt.Errorf("could not find endpoint (%s)", ref)
+	}
+	return endpoint, nil
+}
+
+// getEndpoint returns the endpoint with the given id when it is owned by the
+// account of the request.
+func (s *Server) getEndpoint(r *http.Request, id uuid.UUID) (*types.Endpoint, error) {
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil || !canAccess(r, endpoint.AccountID) {
+		return nil, fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	return endpoint, nil
+}
+
+// liveURL returns the URL on which the endpoint serves its live traffic.
+func liveURL(endpoint *types.Endpoint) string {
+	return fmt.Sprintf("%s/live/%s", config.GetWasmUrl(), endpoint.URLRef())
+}
+
 // CreateDeploymentParams holds all the necessary fields to deploy a new function.
 type CreateDeploymentParams struct{}
 
 func (s *Server) handleCreateDeployment(w http.ResponseWriter, r *http.Request) error {
-	endpointID, err := uuid.Parse(chi.URLParam(r, "id"))
+	endpointID, err := s.parseEndpointID(r)
 	if err != nil {
-		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
 	endpoint, err := s.store.GetEndpoint(endpointID)
 	if err != nil {
@@ -123,23 +426,50 @@ func (s *Server) handleCreateDeployment(w http.ResponseWriter, r *http.Request)
 	if err := s.store.CreateDeployment(deploy); err != nil {
 		return writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse(err))
 	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditDeployCreate,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		TargetID:   deploy.ID,
+	})
 	return writeJSON(w, http.StatusOK, deploy)
 }
 
 func (s *Server) handleGetEndpoint(w http.ResponseWriter, r *http.Request) error {
-	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	id, err := s.parseEndpointID(r)
 	if err != nil {
-		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
 	endpoint, err := s.store.GetEndpoint(id)
 	if err != nil {
 		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
+	history, err := s.store.GetDeploymentHistory(id, storage.Pagination{Limit: defaultPageLimit})
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	endpoint.DeploymentHistory = history
 	return writeJSON(w, http.StatusOK, endpoint)
 }
 
+func (s *Server) handleGetDeployments(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	p, err := parsePagination(r)
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	history, err := s.store.GetDeploymentHistory(id, p)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, history)
+}
+
 func (s *Server) handleGetEndpoints(w http.ResponseWriter, r *http.Request) error {
-	endpoints, err := s.store.GetEndpoints()
+	endpoints, err := s.store.GetEndpoints(requestAccountID(r))
 	if err != nil {
 		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
@@ -166,9 +496,9 @@ func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
 	}
-	endpoint, err := s.store.GetEndpoint(deploy.EndpointID)
+	endpoint, err := s.getEndpoint(r, deploy.EndpointID)
 	if err != nil {
-		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
 
 	currentDeploymentID := endpoint.ActiveDeploymentID
@@ -189,42 +519,914 @@ func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) error {
 	if err := s.store.UpdateEndpoint(deploy.EndpointID, updateParams); err != nil {
 		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
 	}
-
-	s.cache.Delete(currentDeploymentID)
+	s.auditEndpoint(r, types.AuditDeployPublish, endpoint, deploy.ID, "")
 
 	resp := PublishResponse{
 		DeploymentID: deploy.ID,
-		URL:          fmt.Sprintf("%s/live/%s", config.GetWasmUrl(), endpoint.ID),
+		URL:          liveURL(endpoint),
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleUpdateEndpoint(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params UpdateEndpointParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	if err := params.validate(); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if params.Slug != "" {
+		if other, err := s.store.GetEndpointBySlug(params.Slug); err == nil && other.ID != id {
+			err := fmt.Errorf("slug %s is already taken", params.Slug)
+			return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+		}
+	}
+	// The live requests read the endpoint from the store, so the update takes
+	// effect on the next request. The store merges the set and unset
+	// environment variables, so concurrent updates are not lost.
+	updateParams := storage.UpdateEndpointParams{
+		Name:             params.Name,
+		Slug:             params.Slug,
+		Environment:      params.Environment,
+		SetEnvironment:   params.SetEnvironment,
+		UnsetEnvironment: params.UnsetEnvironment,
+		RateLimits:       params.RateLimits,
+		Concurrency:      params.Concurrency,
+	}
+	if err := s.store.UpdateEndpoint(id, updateParams); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditEndpointUpdate, endpoint, uuid.Nil, "")
+	endpoint, err = s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	history, err := s.store.GetDeploymentHistory(id, storage.Pagination{Limit: defaultPageLimit})
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	endpoint.DeploymentHistory = history
+	return writeJSON(w, http.StatusOK, endpoint)
+}
+
+// maxSecretSize is the maximum size of the value of a secret in bytes.
+const maxSecretSize = 64 << 10
+
+// PutSecretParams holds the value of a secret. The value is write-only, it is
+// never returned by the API.
+type PutSecretParams struct {
+	Value string `json:"value"`
+}
+
+// RotateSecretsResponse is the response of re-encrypting the secrets with
+// the current master key.
+type RotateSecretsResponse struct {
+	Rotated int `json:"rotated"`
+}
+
+func (s *Server) handleGetSecrets(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if _, err := s.store.GetEndpoint(id); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	list, err := s.secretStore.GetSecrets(id)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) error {
+	if s.keyring == nil {
+		return writeJSON(w, http.StatusNotImplemented, ErrorResponse(secrets.ErrNotConfigured))
+	}
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	name := chi.URLParam(r, "name")
+	if err := validateEnvKey(name); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	var params PutSecretParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	if len(params.Value) > maxSecretSize {
+		err := fmt.Errorf("secret value can be maximum %d bytes", maxSecretSize)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	secret := &types.Secret{EndpointID: id, Name: name}
+	if err := s.keyring.Seal(secret, params.Value); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	if err := s.secretStore.PutSecret(secret); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	slog.Info("secret set", "endpoint", id, "name", name, "version", secret.Version, "remote", r.RemoteAddr)
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditSecretPut,
+		AccountID:  endpoint.AccountID,
+		EndpointID: id,
+		Detail:     name,
+	})
+	return writeJSON(w, http.StatusOK, secret)
+}
+
+func (s *Server) handleDeleteSecret(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := s.parseEndpoint(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	name := chi.URLParam(r, "name")
+	if err := s.secretStore.DeleteSecret(endpoint.ID, name); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	slog.Info("secret deleted", "endpoint", endpoint.ID, "name", name, "remote", r.RemoteAddr)
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditSecretDelete,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		Detail:     name,
+	})
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: endpoint.ID})
+}
+
+// handleRotateSecrets re-encrypts the secrets of all endpoints that were
+// encrypted with a previous master key, after which the previous master keys
+// can be removed from the config.
+func (s *Server) handleRotateSecrets(w http.ResponseWriter, r *http.Request) error {
+	if s.keyring == nil {
+		return writeJSON(w, http.StatusNotImplemented, ErrorResponse(secrets.ErrNotConfigured))
+	}
+	endpoints, err := s.store.GetEndpoints(uuid.Nil)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	var resp RotateSecretsResponse
+	for _, endpoint := range endpoints {
+		list, err := s.secretStore.GetSecrets(endpoint.ID)
+		if err != nil {
+			return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+		}
+		for _, secret := range list {
+			rotated, err := s.keyring.Rotate(secret)
+			if err != nil {
+				return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+			}
+			if !rotated {
+				continue
+			}
+			if err := s.secretStore.UpdateSecretValue(secret); err != nil {
+				return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+			}
+			resp.Rotated++
+		}
+	}
+	slog.Info("secrets rotated", "rotated", resp.Rotated, "remote", r.RemoteAddr)
+	s.audit(r, types.AuditEvent{
+		Action: types.AuditSecretsRotate,
+		Detail: fmt.Sprintf("%d secrets rotated", resp.Rotated),
+	})
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+// RollbackParams holds the number of publications to go back, the previously
+// active deployment when zero.
+type RollbackParams struct {
+	Steps int `json:"steps"`
+}
+
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params RollbackParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	if params.Steps < 0 {
+		err := fmt.Errorf("steps can not be negative")
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if params.Steps == 0 {
+		params.Steps = 1
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	publications, err := s.store.GetPublications(id)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	deployID, err := rollbackTarget(publications, endpoint.ActiveDeploymentID, params.Steps)
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+
+	updateParams := storage.UpdateEndpointParams{
+		ActiveDeployID: deployID,
+	}
+	if err := s.store.UpdateEndpoint(id, updateParams); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditEndpointRollback, endpoint, deployID, "")
+	// The wasm server reads the active deployment from the store, so the next
+	// LIVE request is served by the rolled back deployment. Its runtime pool
+	// releases the runtimes of the replaced deployment on that request, or
+	// when its IsActive check notices the rollback.
+
+	resp := PublishResponse{
+		DeploymentID: deployID,
+		URL:          liveURL(endpoint),
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+// rollbackTarget returns the deployment that was active the given number of
+// publications before the active deployment. Republishing the same deployment
+// in a row counts as a single publication.
+func rollbackTarget(publications []*types.Publication, activeID uuid.UUID, steps int) (uuid.UUID, error) {
+	var history []uuid.UUID
+	for _, publication := range publications {
+		if n := len(history); n > 0 && history[n-1] == publication.DeploymentID {
+			continue
+		}
+		history = append(history, publication.DeploymentID)
+	}
+	// The active deployment is the last publication, unless it got deleted.
+	if n := len(history); activeID != uuid.Nil && (n == 0 || history[n-1] != activeID) {
+		history = append(history, activeID)
+	}
+	i := len(history) - 1 - steps
+	if activeID == uuid.Nil {
+		i++
+	}
+	if i < 0 {
+		return uuid.Nil, fmt.Errorf("no deployment was published %d step(s) before the active deployment", steps)
+	}
+	if history[i] == activeID {
+		return uuid.Nil, fmt.Errorf("deploy %s already active", activeID)
+	}
+	return history[i], nil
+}
+
+// maxTrafficRoutes is the maximum number of deployments a traffic split
+// routes to.
+const maxTrafficRoutes = 10
+
+// TrafficSplitParams holds the weighted routes of the live traffic of an
+// endpoint. The weights are percentages and need to add up to 100.
+type TrafficSplitParams struct {
+	Routes []types.TrafficRoute `json:"routes"`
+	// StickyHeader is the name of the request header that assigns clients to
+	// a deployment, clients are assigned with a cookie when empty.
+	StickyHeader string `json:"sticky_header"`
+	// Canary promotes or aborts the canary deployment automatically.
+	Canary *types.CanaryPolicy `json:"canary"`
+}
+
+func (p TrafficSplitParams) validate(endpoint *types.Endpoint) error {
+	if !endpoint.HasActiveDeploy() {
+		return fmt.Errorf("endpoint %s does not have any published deploy", endpoint.ID)
+	}
+	if len(p.Routes) == 0 {
+		return fmt.Errorf("traffic split needs at least 1 route")
+	}
+	if len(p.Routes) > maxTrafficRoutes {
+		return fmt.Errorf("traffic split can have maximum %d routes", maxTrafficRoutes)
+	}
+	var (
+		total int
+		seen  = make(map[uuid.UUID]bool)
+	)
+	for _, route := range p.Routes {
+		if route.Weight < 0 || route.Weight > types.TrafficBuckets {
+			return fmt.Errorf("route weight should be between 0 and %d", types.TrafficBuckets)
+		}
+		if seen[route.DeploymentID] {
+			return fmt.Errorf("deploy %s is routed more than once", route.DeploymentID)
+		}
+		seen[route.DeploymentID] = true
+		total += route.Weight
+	}
+	if total != types.TrafficBuckets {
+		return fmt.Errorf("route weights should add up to %d got %d", types.TrafficBuckets, total)
+	}
+	if canary := p.Canary; canary != nil {
+		split := types.TrafficSplit{Routes: p.Routes}
+		if !split.RoutesTo(canary.DeploymentID) {
+			return fmt.Errorf("canary deploy %s does not receive any traffic", canary.DeploymentID)
+		}
+		if canary.DeploymentID == endpoint.ActiveDeploymentID {
+			return fmt.Errorf("canary deploy %s is already active", canary.DeploymentID)
+		}
+		if canary.MaxErrorRate < 0 || canary.MaxErrorRate > 1 {
+			return fmt.Errorf("canary max error rate should be between 0 and 1")
+		}
+		if canary.MinRequests < 0 || canary.Duration < 0 {
+			return fmt.Errorf("canary min requests and duration can not be negative")
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleSetTrafficSplit(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params TrafficSplitParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if err := params.validate(endpoint); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	for _, route := range params.Routes {
+		deploy, err := s.store.GetDeployment(route.DeploymentID)
+		if err != nil {
+			return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+		}
+		if deploy.EndpointID != endpoint.ID {
+			err := fmt.Errorf("deploy %s does not belong to endpoint %s", deploy.ID, endpoint.ID)
+			return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+		}
+	}
+
+	split := &types.TrafficSplit{
+		Routes:       params.Routes,
+		StickyHeader: params.StickyHeader,
+		Canary:       params.Canary,
+		CreatedAT:    time.Now().UTC(),
+	}
+	if err := s.store.SetTrafficSplit(id, split); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditTrafficSet, endpoint, uuid.Nil, trafficDetail(split.Routes))
+	endpoint.TrafficSplit = split
+	return writeJSON(w, http.StatusOK, endpoint)
+}
+
+func (s *Server) handleDeleteTrafficSplit(w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := s.parseEndpoint(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if err := s.store.SetTrafficSplit(endpoint.ID, nil); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditTrafficDelete, endpoint, uuid.Nil, "")
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: endpoint.ID})
+}
+
+// handlePromoteCanary publishes the canary of the traffic split of the
+// endpoint, which is the deployment of its canary policy or the only routed
+// deployment that is not active.
+func (s *Server) handlePromoteCanary(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	split := endpoint.TrafficSplit
+	if split == nil {
+		err := fmt.Errorf("endpoint %s does not have a traffic split", id)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	var canaries []uuid.UUID
+	if split.Canary != nil {
+		canaries = append(canaries, split.Canary.DeploymentID)
+	} else {
+		for _, route := range split.Routes {
+			if route.Weight > 0 && route.DeploymentID != endpoint.ActiveDeploymentID {
+				canaries = append(canaries, route.DeploymentID)
+			}
+		}
+	}
+	if len(canaries) != 1 {
+		err := fmt.Errorf("traffic split of endpoint %s does not have a single canary to promote", id)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+
+	// Publishing the canary removes the traffic split.
+	updateParams := storage.UpdateEndpointParams{
+		ActiveDeployID: canaries[0],
+	}
+	if err := s.store.UpdateEndpoint(id, updateParams); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditTrafficPromote, endpoint, canaries[0], "")
+
+	resp := PublishResponse{
+		DeploymentID: canaries[0],
+		URL:          liveURL(endpoint),
 	}
 	return writeJSON(w, http.StatusOK, resp)
 }
 
+// hostnameRegexp matches fully qualified hostnames, wildcards are not
+// supported.
+var hostnameRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// CreateDomainParams holds the hostname and the optional path prefix an
+// endpoint claims.
+type CreateDomainParams struct {
+	Hostname   string `json:"hostname"`
+	PathPrefix string `json:"path_prefix"`
+}
+
+func (p CreateDomainParams) validate() error {
+	hostname := types.NormalizeHostname(p.Hostname)
+	if len(hostname) > 253 || !hostnameRegexp.MatchString(hostname) {
+		return fmt.Errorf("invalid hostname: %q", p.Hostname)
+	}
+	if strings.ContainsAny(p.PathPrefix, "?#") || strings.Contains(p.PathPrefix, "//") {
+		return fmt.Errorf("invalid path prefix: %q", p.PathPrefix)
+	}
+	return nil
+}
+
+func (s *Server) handleGetDomains(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if _, err := s.store.GetEndpoint(id); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	domains, err := s.domainStore.GetDomains(id)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, domains)
+}
+
+// handleCreateDomain claims a domain for the endpoint. The domain is only
+// routed to the endpoint after its ownership is verified.
+func (s *Server) handleCreateDomain(w http.ResponseWriter, r *http.Request) error {
+	id, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	var params CreateDomainParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(ErrDecodeRequestBody))
+	}
+	if err := params.validate(); err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	endpoint, err := s.store.GetEndpoint(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	domain := types.NewDomain(id, params.Hostname, params.PathPrefix)
+	domains, err := s.domainStore.GetDomains(uuid.Nil)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	// Unverified claims of other endpoints do not block the claim, only
+	// one of them can be verified.
+	for _, d := range domains {
+		if d.Blocks(id, domain.Hostname, domain.PathPrefix, domain.CreatedAT) {
+			err := fmt.Errorf("domain %s%s is already claimed", domain.Hostname, domain.PathPrefix)
+			return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+		}
+	}
+	if err := s.domainStore.CreateDomain(domain); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditDomainCreate,
+		AccountID:  endpoint.AccountID,
+		EndpointID: id,
+		TargetID:   domain.ID,
+		Detail:     domain.Hostname + domain.PathPrefix,
+	})
+	return writeJSON(w, http.StatusOK, domain)
+}
+
+// handleVerifyDomain verifies the ownership of a domain by looking up its
+// verification TXT record.
+func (s *Server) handleVerifyDomain(w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	domain, err := s.domainStore.GetDomain(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	endpoint, err := s.getEndpoint(r, domain.EndpointID)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if domain.Verified {
+		return writeJSON(w, http.StatusOK, domain)
+	}
+	if domain.Expired(time.Now()) {
+		err := fmt.Errorf("the claim of domain %s%s expired, claim it again", domain.Hostname, domain.PathPrefix)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	domains, err := s.domainStore.GetDomains(uuid.Nil)
+	if err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	for _, d := range domains {
+		if d.ID != domain.ID && d.Verified && d.Hostname == domain.Hostname && d.PathPrefix == domain.PathPrefix {
+			err := fmt.Errorf("domain %s%s is already verified by another endpoint", domain.Hostname, domain.PathPrefix)
+			return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+		}
+	}
+	// A missing record is the caller's to fix, other lookup failures are the
+	// resolver's and can be retried.
+	records, err := s.lookupTXT(domain.VerificationRecord())
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		err := fmt.Errorf("could not look up TXT record %s: %w", domain.VerificationRecord(), err)
+		return writeJSON(w, http.StatusBadGateway, ErrorResponse(err))
+	}
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.VerificationToken {
+			found = true
+			break
+		}
+	}
+	if !found {
+		err := fmt.Errorf("could not find TXT record %s with value %s", domain.VerificationRecord(), domain.VerificationToken)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if err := s.domainStore.VerifyDomain(id); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditDomainVerify,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		TargetID:   domain.ID,
+		Detail:     domain.Hostname + domain.PathPrefix,
+	})
+	domain.Verified = true
+	return writeJSON(w, http.StatusOK, domain)
+}
+
+func (s *Server) handleDeleteDomain(w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	domain, err := s.domainStore.GetDomain(id)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	endpoint, err := s.getEndpoint(r, domain.EndpointID)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if err := s.domainStore.DeleteDomain(id); err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	s.audit(r, types.AuditEvent{
+		Action:     types.AuditDomainDelete,
+		AccountID:  endpoint.AccountID,
+		EndpointID: endpoint.ID,
+		TargetID:   domain.ID,
+		Detail:     domain.Hostname + domain.PathPrefix,
+	})
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: id})
+}
+
+// DeleteResponse is the response of deleting an endpoint, a deployment or
+// another resource.
+type DeleteResponse struct {
+	ID uuid.UUID `json:"id"`
+}
+
+func (s *Server) handleDeleteEndpoint(w http.ResponseWriter, r *http.Request) error {
+	endpointID, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	endpoint, err := s.store.GetEndpoint(endpointID)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if err := s.store.DeleteEndpoint(endpointID); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditEndpointDelete, endpoint, uuid.Nil, endpoint.Name)
+	// The wasm server releases the runtimes and the compiled modules of the
+	// deleted endpoint once its runtime pool notices the deletion.
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: endpointID})
+}
+
+// handleDeleteDeployment deletes a deployment. The active deployment of an
+// endpoint is only deleted when forced with the force query parameter, which
+// leaves the endpoint without a LIVE deployment.
+func (s *Server) handleDeleteDeployment(w http.ResponseWriter, r *http.Request) error {
+	deployID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	deploy, err := s.store.GetDeployment(deployID)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	endpoint, err := s.getEndpoint(r, deploy.EndpointID)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if endpoint.ActiveDeploymentID == deploy.ID && !force {
+		err := fmt.Errorf("deploy %s is active on endpoint %s, use force to delete it anyway", deploy.ID, endpoint.ID)
+		return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+	}
+	if split := endpoint.TrafficSplit; split != nil && split.RoutesTo(deploy.ID) {
+		if !force {
+			err := fmt.Errorf("deploy %s is part of the traffic split of endpoint %s, use force to delete it anyway", deploy.ID, endpoint.ID)
+			return writeJSON(w, http.StatusConflict, ErrorResponse(err))
+		}
+		if err := s.store.SetTrafficSplit(endpoint.ID, nil); err != nil {
+			return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+		}
+	}
+	if err := s.store.DeleteDeployment(deployID); err != nil {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(err))
+	}
+	s.auditEndpoint(r, types.AuditDeployDelete, endpoint, deployID, "")
+	return writeJSON(w, http.StatusOK, DeleteResponse{ID: deployID})
+}
+
 func (s *Server) handleGetEndpointMetrics(w http.ResponseWriter, r *http.Request) error {
-	endpointID, err := uuid.Parse(chi.URLParam(r, "id"))
+	endpointID, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	filter, err := parseMetricFilter(r)
 	if err != nil {
 		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
 	}
-	metrics, err := s.metricStore.GetRuntimeMetrics(endpointID)
+	metrics, err := s.metricStore.GetRuntimeMetrics(endpointID, filter)
 	if err != nil {
 		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
 	}
 	return writeJSON(w, http.StatusOK, metrics)
 }
 
-var errUnauthorized = errors.New("unauthorized")
+// MetricsSummaryParams holds the query parameters of the metrics summary of
+// an endpoint.
+type MetricsSummaryParams struct {
+	From         time.Time
+	To           time.Time
+	Bucket       time.Duration
+	DeploymentID uuid.UUID
+}
+
+const (
+	defaultSummaryRange  = time.Hour
+	defaultSummaryBucket = time.Minute
+	maxSummaryBuckets    = 1440
+)
+
+func (s *Server) handleGetEndpointMetricsSummary(w http.ResponseWriter, r *http.Request) error {
+	endpointID, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	filter, err := parseMetricFilter(r)
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-defaultSummaryRange)
+	}
+	if !filter.From.Before(filter.To) {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(fmt.Errorf("from should be before to")))
+	}
+	bucket := defaultSummaryBucket
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		if bucket, err = time.ParseDuration(v); err != nil || bucket < time.Second {
+			return writeJSON(w, http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid bucket given: %s", v)))
+		}
+	}
+	if filter.To.Sub(filter.From)/bucket > maxSummaryBuckets {
+		err := fmt.Errorf("the time range can be split in maximum %d buckets", maxSummaryBuckets)
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+
+	summary, err := s.metricStore.GetRuntimeMetricsSummary(endpointID, filter, bucket)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	return writeJSON(w, http.StatusOK, summary)
+}
+
+const (
+	defaultMetricsLimit = 100
+	maxMetricsLimit     = 1000
+)
+
+// parseMetricFilter parses the from, to (RFC3339), deployment, status and
+// limit query parameters of the given request.
+func parseMetricFilter(r *http.Request) (storage.MetricFilter, error) {
+	var (
+		query  = r.URL.Query()
+		filter = storage.MetricFilter{Limit: defaultMetricsLimit}
+		err    error
+	)
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid from time given: %s", v)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid to time given: %s", v)
+		}
+	}
+	if v := query.Get("deployment"); v != "" {
+		if filter.DeploymentID, err = uuid.Parse(v); err != nil {
+			return filter, fmt.Errorf("invalid deployment id given: %s", v)
+		}
+	}
+	if v := query.Get("status"); v != "" {
+		if filter.StatusCode, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid status code given: %s", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxMetricsLimit {
+			return filter, fmt.Errorf("limit should be a number between 1 and %d", maxMetricsLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// LogsParams holds the query parameters of the logs of an endpoint.
+type LogsParams struct {
+	From         time.Time
+	To           time.Time
+	DeploymentID uuid.UUID
+	RequestID    string
+	Stream       string
+	Limit        int
+}
+
+const (
+	defaultLogsLimit      = 100
+	maxLogsLimit          = 1000
+	defaultFollowInterval = time.Second
+)
 
-func (s *Server) withAPIToken(h http.Handler) http.Handler {
+func (s *Server) handleGetEndpointLogs(w http.ResponseWriter, r *http.Request) error {
+	endpointID, err := s.parseEndpointID(r)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		return writeJSON(w, http.StatusBadRequest, ErrorResponse(err))
+	}
+	logs, err := s.logStore.GetRuntimeLogs(endpointID, filter)
+	if err != nil {
+		return writeJSON(w, http.StatusNotFound, ErrorResponse(err))
+	}
+	if r.URL.Query().Get("follow") != "true" {
+		return writeJSON(w, http.StatusOK, logs)
+	}
+	return s.followLogs(w, r, endpointID, filter, logs)
+}
+
+// followLogs streams the given logs followed by the logs that are stored
+// afterwards as newline delimited JSON, until the client disconnects.
+func (s *Server) followLogs(w http.ResponseWriter, r *http.Request, endpointID uuid.UUID, filter storage.LogFilter, logs []types.RuntimeLog) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return writeJSON(w, http.StatusInternalServerError, ErrorResponse(errors.New("streaming is not supported")))
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(s.followInterval)
+	defer ticker.Stop()
+
+	var (
+		enc = json.NewEncoder(w)
+		err error
+	)
+	filter.Limit = maxLogsLimit
+	for {
+		for _, log := range logs {
+			if err := enc.Encode(log); err != nil {
+				return err
+			}
+			filter.AfterSeq = log.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+		if logs, err = s.logStore.GetRuntimeLogs(endpointID, filter); err != nil {
+			return err
+		}
+	}
+}
+
+func parseLogFilter(r *http.Request) (storage.LogFilter, error) {
+	var (
+		query  = r.URL.Query()
+		filter = storage.LogFilter{
+			RequestID: query.Get("request"),
+			Limit:     defaultLogsLimit,
+		}
+		err error
+	)
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid from time given: %s", v)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid to time given: %s", v)
+		}
+	}
+	if v := query.Get("deployment"); v != "" {
+		if filter.DeploymentID, err = uuid.Parse(v); err != nil {
+			return filter, fmt.Errorf("invalid deployment id given: %s", v)
+		}
+	}
+	if v := query.Get("stream"); v != "" {
+		if v != types.LogStreamStdout && v != types.LogStreamStderr {
+			return filter, fmt.Errorf("invalid stream given: %s", v)
+		}
+		filter.Stream = v
+	}
+	if v := query.Get("after"); v != "" {
+		if filter.AfterSeq, err = strconv.ParseInt(v, 10, 64); err != nil || filter.AfterSeq < 0 {
+			return filter, fmt.Errorf("invalid after sequence given: %s", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLogsLimit {
+			return filter, fmt.Errorf("limit should be a number between 1 and %d", maxLogsLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// withMetrics records the count and latency of every request per route.
+func withMetrics(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if len(authHeader) < 10 {
-			writeJSON(w, http.StatusUnauthorized, ErrorResponse(errUnauthorized))
-			return
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		h.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
 		}
-		apiToken := authHeader[7:]
-		if apiToken != config.Get().APIToken {
-			writeJSON(w, http.StatusUnauthorized, ErrorResponse(errUnauthorized))
-			return
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
 		}
-		h.ServeHTTP(w, r)
+		telemetry.APIRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		telemetry.APIRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
 	})
 }
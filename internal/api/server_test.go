@@ -1,19 +1,1205 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/anthdm/raptor/internal/secrets"
+	"github.com/anthdm/raptor/internal/storage"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
 )
 
+func newTestServer() *Server {
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	keyring, err := secrets.NewKeyring(key)
+	if err != nil {
+		panic(err)
+	}
+	var (
+		store = storage.NewMemoryStore()
+		cache = storage.NewDefaultModCache()
+		s     = NewServer(store, store, store, store, store, store, store, keyring, cache)
+	)
+	s.initRouter()
+	return s
+}
+
+func doRequest(t *testing.T, s *Server, method, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func doTokenRequest(t *testing.T, s *Server, token, method, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func createTestEndpoint(t *testing.T, s *Server) *types.Endpoint {
+	t.Helper()
+	b, _ := json.Marshal(CreateEndpointParams{
+		Name:        "My endpoint",
+		Runtime:     "go",
+		Environment: map[string]string{"FOO": "bar"},
+	})
+	rr := doRequest(t, s, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil {
+		t.Fatal(err)
+	}
+	return &endpoint
+}
+
 func TestCreateEndpoint(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	if endpoint.Name != "My endpoint" {
+		t.Fatalf("expected name %s got %s", "My endpoint", endpoint.Name)
+	}
+	if endpoint.Environment["FOO"] != "bar" {
+		t.Fatalf("expected env FOO=bar got %v", endpoint.Environment)
+	}
+
+	b, _ := json.Marshal(CreateEndpointParams{Name: "My endpoint", Runtime: "rust"})
+	rr := doRequest(t, s, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid runtime got %d", rr.Code)
+	}
+
+	b, _ = json.Marshal(CreateEndpointParams{
+		Name:    "My endpoint",
+		Runtime: "go",
+		Limits:  types.Limits{MaxMemoryPages: maxMemoryPages + 1},
+	})
+	rr = doRequest(t, s, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid limits got %d", rr.Code)
+	}
 }
 
 func TestGetEndpoint(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+
+	rr := doRequest(t, s, http.MethodGet, "/endpoint/"+endpoint.ID.String(), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	var e types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != endpoint.ID {
+		t.Fatalf("expected endpoint %s got %s", endpoint.ID, e.ID)
+	}
+
+	rr = doRequest(t, s, http.MethodGet, "/endpoint/"+uuid.NewString(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 got %d", rr.Code)
+	}
+}
+
+func TestEndpointSlug(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	if endpoint.Slug != "my-endpoint" {
+		t.Fatalf("expected slug my-endpoint got %s", endpoint.Slug)
+	}
+	if other := createTestEndpoint(t, s); other.Slug != "my-endpoint-2" {
+		t.Fatalf("expected slug my-endpoint-2 got %s", other.Slug)
+	}
+
+	create := func(params CreateEndpointParams) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(params)
+		return doRequest(t, s, http.MethodPost, "/endpoint", b)
+	}
+	if rr := create(CreateEndpointParams{Name: "Other", Runtime: "go", Slug: "my-endpoint"}); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for taken slug got %d", rr.Code)
+	}
+	if rr := create(CreateEndpointParams{Name: "Other", Runtime: "go", Slug: "Not A Slug"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid slug got %d", rr.Code)
+	}
+
+	rr := doRequest(t, s, http.MethodGet, "/endpoint/my-endpoint", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var e types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != endpoint.ID {
+		t.Fatalf("expected endpoint %s got %s", endpoint.ID, e.ID)
+	}
+	rr = doRequest(t, s, http.MethodGet, "/endpoint/unknown-slug/deployment", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for unknown slug got %d", rr.Code)
+	}
+
+	update := func(slug string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(UpdateEndpointParams{Slug: slug})
+		return doRequest(t, s, http.MethodPatch, "/endpoint/my-endpoint", b)
+	}
+	if rr := update("my-endpoint-2"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for taken slug got %d", rr.Code)
+	}
+	if rr := update("catfacts"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	rr = doRequest(t, s, http.MethodGet, "/endpoint/catfacts", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the new slug got %d", rr.Code)
+	}
 }
 
 func TestCreateDeploy(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	rr := doRequest(t, s, http.MethodPost, target, []byte("wasm blob"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var deploy types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+		t.Fatal(err)
+	}
+	if deploy.EndpointID != endpoint.ID {
+		t.Fatalf("expected endpoint id %s got %s", endpoint.ID, deploy.EndpointID)
+	}
+
+	b, _ := json.Marshal(PublishParams{DeploymentID: deploy.ID})
+	rr = doRequest(t, s, http.MethodPost, "/publish/"+deploy.ID.String(), b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	e, err := s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ActiveDeploymentID != deploy.ID {
+		t.Fatalf("expected active deployment %s got %s", deploy.ID, e.ActiveDeploymentID)
+	}
 }
 
 func TestGetDeploy(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	for i := 0; i < 3; i++ {
+		rr := doRequest(t, s, http.MethodPost, target, []byte(fmt.Sprintf("wasm blob %d", i)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+	}
+
+	rr := doRequest(t, s, http.MethodGet, target+"?limit=2", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var history []types.DeploymentHistory
+	if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 deployments got %d", len(history))
+	}
+
+	rr = doRequest(t, s, http.MethodGet, target+"?limit=0", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid limit got %d", rr.Code)
+	}
+
+	rr = doRequest(t, s, http.MethodGet, "/endpoint/"+endpoint.ID.String(), nil)
+	var e types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.DeploymentHistory) != 3 {
+		t.Fatalf("expected 3 deployments in the endpoint history got %d", len(e.DeploymentHistory))
+	}
 }
 
-func TestRollback(t *testing.T) {}
+func TestUpdateEndpoint(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := "/endpoint/" + endpoint.ID.String()
+	update := func(params UpdateEndpointParams) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(params)
+		return doRequest(t, s, http.MethodPatch, target, b)
+	}
+
+	rr := update(UpdateEndpointParams{
+		Name:             "Renamed endpoint",
+		SetEnvironment:   map[string]string{"BAZ": "qux"},
+		UnsetEnvironment: []string{"FOO"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var e types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "Renamed endpoint" {
+		t.Fatalf("expected name %s got %s", "Renamed endpoint", e.Name)
+	}
+	if len(e.Environment) != 1 || e.Environment["BAZ"] != "qux" {
+		t.Fatalf("expected env BAZ=qux got %v", e.Environment)
+	}
+
+	rr = update(UpdateEndpointParams{Environment: map[string]string{}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	stored, err := s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Environment) != 0 {
+		t.Fatalf("expected env to be replaced got %v", stored.Environment)
+	}
+	if stored.Name != "Renamed endpoint" {
+		t.Fatalf("expected name to be kept got %s", stored.Name)
+	}
+
+	limits := types.RateLimits{Endpoint: types.RateLimit{Rate: 100}, Client: types.RateLimit{Rate: 1, Burst: 5}}
+	if rr := update(UpdateEndpointParams{RateLimits: &limits}); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if stored, _ := s.store.GetEndpoint(endpoint.ID); stored.RateLimits != limits {
+		t.Fatalf("expected rate limits %+v got %+v", limits, stored.RateLimits)
+	}
+	concurrency := types.Concurrency{MaxConcurrent: 8, MaxQueue: 32, QueueTimeout: time.Second}
+	if rr := update(UpdateEndpointParams{Concurrency: &concurrency}); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if stored, _ := s.store.GetEndpoint(endpoint.ID); stored.Concurrency != concurrency {
+		t.Fatalf("expected concurrency %+v got %+v", concurrency, stored.Concurrency)
+	}
+
+	invalid := []UpdateEndpointParams{
+		{},
+		{Name: "a"},
+		{SetEnvironment: map[string]string{"A=B": "C"}},
+		{Environment: map[string]string{"A": "B"}, UnsetEnvironment: []string{"C"}},
+		{RateLimits: &types.RateLimits{Client: types.RateLimit{Rate: -1}}},
+		{Concurrency: &types.Concurrency{MaxQueue: -1}},
+	}
+	for _, params := range invalid {
+		if rr := update(params); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %+v got %d", params, rr.Code)
+		}
+	}
+
+	b, _ := json.Marshal(UpdateEndpointParams{Name: "Unknown endpoint"})
+	rr = doRequest(t, s, http.MethodPatch, "/endpoint/"+uuid.NewString(), b)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 got %d", rr.Code)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/secrets", endpoint.ID)
+
+	b, _ := json.Marshal(PutSecretParams{Value: "s3cr3t"})
+	for i := 1; i <= 2; i++ {
+		rr := doRequest(t, s, http.MethodPut, target+"/API_KEY", b)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+		var secret types.Secret
+		if err := json.NewDecoder(rr.Body).Decode(&secret); err != nil {
+			t.Fatal(err)
+		}
+		if secret.Version != i {
+			t.Fatalf("expected version %d got %d", i, secret.Version)
+		}
+	}
+	rr := doRequest(t, s, http.MethodPut, target+"/INVALID=NAME", b)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid name got %d", rr.Code)
+	}
+
+	rr = doRequest(t, s, http.MethodGet, target, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if strings.Contains(rr.Body.String(), "s3cr3t") {
+		t.Fatal("expected the secret value to never be returned")
+	}
+	var list []types.Secret
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "API_KEY" {
+		t.Fatalf("expected secret API_KEY got %+v", list)
+	}
+	stored, err := s.secretStore.GetSecrets(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.keyring.Open(stored[0]); err != nil || value != "s3cr3t" {
+		t.Fatalf("expected the stored secret to decrypt to s3cr3t got %q (%v)", value, err)
+	}
+
+	rr = doRequest(t, s, http.MethodPost, "/secrets/rotate", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var rotate RotateSecretsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&rotate); err != nil {
+		t.Fatal(err)
+	}
+	if rotate.Rotated != 0 {
+		t.Fatalf("expected no secrets to rotate with the current key got %d", rotate.Rotated)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, target+"/API_KEY", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	rr = doRequest(t, s, http.MethodDelete, target+"/API_KEY", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for deleted secret got %d", rr.Code)
+	}
+
+	s.keyring = nil
+	rr = doRequest(t, s, http.MethodPut, target+"/API_KEY", b)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501 without master key got %d", rr.Code)
+	}
+}
+
+func TestTrafficSplit(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	var deploys []types.Deployment
+	for i := 0; i < 2; i++ {
+		rr := doRequest(t, s, http.MethodPost, target, []byte(fmt.Sprintf("wasm blob %d", i)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+		var deploy types.Deployment
+		if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+			t.Fatal(err)
+		}
+		deploys = append(deploys, deploy)
+	}
+	stable, canary := deploys[0], deploys[1]
+	split := func(params TrafficSplitParams) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(params)
+		return doRequest(t, s, http.MethodPut, "/endpoint/"+endpoint.ID.String()+"/traffic", b)
+	}
+	params := TrafficSplitParams{
+		Routes: []types.TrafficRoute{
+			{DeploymentID: stable.ID, Weight: 95},
+			{DeploymentID: canary.ID, Weight: 5},
+		},
+		Canary: &types.CanaryPolicy{DeploymentID: canary.ID, MaxErrorRate: 0.05},
+	}
+	if rr := split(params); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without an active deployment got %d", rr.Code)
+	}
+
+	b, _ := json.Marshal(PublishParams{DeploymentID: stable.ID})
+	rr := doRequest(t, s, http.MethodPost, "/publish/"+stable.ID.String(), b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+
+	invalid := []TrafficSplitParams{
+		{},
+		{Routes: []types.TrafficRoute{{DeploymentID: stable.ID, Weight: 90}}},
+		{Routes: []types.TrafficRoute{{DeploymentID: stable.ID, Weight: 50}, {DeploymentID: stable.ID, Weight: 50}}},
+		{Routes: []types.TrafficRoute{{DeploymentID: stable.ID, Weight: 50}, {DeploymentID: uuid.New(), Weight: 50}}},
+		{Routes: params.Routes, Canary: &types.CanaryPolicy{DeploymentID: stable.ID}},
+		{Routes: params.Routes, Canary: &types.CanaryPolicy{DeploymentID: canary.ID, MaxErrorRate: 2}},
+	}
+	for _, p := range invalid {
+		if rr := split(p); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %+v got %d", p, rr.Code)
+		}
+	}
+
+	rr = split(params)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	e, err := s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrafficSplit == nil || e.TrafficSplit.Route(99) != canary.ID {
+		t.Fatalf("expected the last bucket to be routed to the canary got %+v", e.TrafficSplit)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, "/deployment/"+canary.ID.String(), nil)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a routed deployment got %d", rr.Code)
+	}
+
+	rr = doRequest(t, s, http.MethodPost, "/endpoint/"+endpoint.ID.String()+"/traffic/promote", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	e, err = s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ActiveDeploymentID != canary.ID || e.TrafficSplit != nil {
+		t.Fatalf("expected the canary to be published without a split got %s %+v", e.ActiveDeploymentID, e.TrafficSplit)
+	}
+
+	params.Canary = nil
+	params.Routes[0].DeploymentID, params.Routes[1].DeploymentID = canary.ID, stable.ID
+	if rr := split(params); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	rr = doRequest(t, s, http.MethodDelete, "/endpoint/"+endpoint.ID.String()+"/traffic", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	e, err = s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrafficSplit != nil {
+		t.Fatalf("expected the traffic split to be removed got %+v", e.TrafficSplit)
+	}
+}
+
+func TestDomains(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/domains", endpoint.ID)
+
+	b, _ := json.Marshal(CreateDomainParams{Hostname: "*.example.com"})
+	rr := doRequest(t, s, http.MethodPost, target, b)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid hostname got %d", rr.Code)
+	}
+	b, _ = json.Marshal(CreateDomainParams{Hostname: "API.example.com", PathPrefix: "v1"})
+	rr = doRequest(t, s, http.MethodPost, target, b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var domain types.Domain
+	if err := json.NewDecoder(rr.Body).Decode(&domain); err != nil {
+		t.Fatal(err)
+	}
+	if domain.Hostname != "api.example.com" || domain.PathPrefix != "/v1" || domain.Verified {
+		t.Fatalf("unexpected domain: %+v", domain)
+	}
+	rr = doRequest(t, s, http.MethodPost, target, b)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for claimed domain got %d", rr.Code)
+	}
+	// An unverified claim does not block the claims of other endpoints.
+	squatter := createTestEndpoint(t, s)
+	rr = doRequest(t, s, http.MethodPost, fmt.Sprintf("/endpoint/%s/domains", squatter.ID), b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for an unverified domain got %d: %s", rr.Code, rr.Body)
+	}
+	var claim types.Domain
+	if err := json.NewDecoder(rr.Body).Decode(&claim); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		records   = map[string][]string{}
+		lookupErr error
+	)
+	s.lookupTXT = func(name string) ([]string, error) {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if _, ok := records[name]; !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return records[name], nil
+	}
+	verify := fmt.Sprintf("/domain/%s/verify", domain.ID)
+	rr = doRequest(t, s, http.MethodPost, verify, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without verification record got %d", rr.Code)
+	}
+	lookupErr = &net.DNSError{Err: "server misbehaving", Name: "_raptor-challenge.api.example.com", IsTemporary: true}
+	rr = doRequest(t, s, http.MethodPost, verify, nil)
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502 for a failed lookup got %d", rr.Code)
+	}
+	lookupErr = nil
+	records["_raptor-challenge.api.example.com"] = []string{"v=spf1 -all", domain.VerificationToken}
+	rr = doRequest(t, s, http.MethodPost, verify, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = doRequest(t, s, http.MethodGet, target, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var domains []types.Domain
+	if err := json.NewDecoder(rr.Body).Decode(&domains); err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 1 || !domains[0].Verified {
+		t.Fatalf("expected 1 verified domain got %+v", domains)
+	}
+
+	// The claim of another endpoint can not be verified, nor can the
+	// verified domain be claimed again.
+	rr = doRequest(t, s, http.MethodPost, fmt.Sprintf("/endpoint/%s/domains", squatter.ID), b)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a verified domain got %d", rr.Code)
+	}
+	records["_raptor-challenge.api.example.com"] = append(records["_raptor-challenge.api.example.com"], claim.VerificationToken)
+	rr = doRequest(t, s, http.MethodPost, fmt.Sprintf("/domain/%s/verify", claim.ID), nil)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 when verifying a verified domain got %d", rr.Code)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, "/domain/"+domain.ID.String(), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	rr = doRequest(t, s, http.MethodDelete, "/domain/"+domain.ID.String(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for deleted domain got %d", rr.Code)
+	}
+}
+
+func TestDeleteEndpoint(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	rr := doRequest(t, s, http.MethodPost, target, []byte("wasm blob"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var deploy types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, "/endpoint/"+endpoint.ID.String(), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	rr = doRequest(t, s, http.MethodGet, "/endpoint/"+endpoint.ID.String(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 after delete got %d", rr.Code)
+	}
+	if _, err := s.store.GetDeployment(deploy.ID); err == nil {
+		t.Fatalf("expected deployment %s to be deleted with its endpoint", deploy.ID)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, "/endpoint/"+endpoint.ID.String(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for deleted endpoint got %d", rr.Code)
+	}
+}
+
+func TestDeleteDeployment(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	rr := doRequest(t, s, http.MethodPost, target, []byte("wasm blob"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var deploy types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(PublishParams{DeploymentID: deploy.ID})
+	rr = doRequest(t, s, http.MethodPost, "/publish/"+deploy.ID.String(), b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = doRequest(t, s, http.MethodDelete, "/deployment/"+deploy.ID.String(), nil)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for the active deployment got %d", rr.Code)
+	}
+	rr = doRequest(t, s, http.MethodDelete, "/deployment/"+deploy.ID.String()+"?force=true", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if _, err := s.store.GetDeployment(deploy.ID); err == nil {
+		t.Fatalf("expected deployment %s to be deleted", deploy.ID)
+	}
+	e, err := s.store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ActiveDeploymentID != uuid.Nil {
+		t.Fatalf("expected no active deployment got %s", e.ActiveDeploymentID)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	s := newTestServer()
+	endpoint := createTestEndpoint(t, s)
+	target := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	var deploys []types.Deployment
+	for i := 0; i < 3; i++ {
+		rr := doRequest(t, s, http.MethodPost, target, []byte(fmt.Sprintf("wasm blob %d", i)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+		var deploy types.Deployment
+		if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+			t.Fatal(err)
+		}
+		deploys = append(deploys, deploy)
+	}
+	rollback := func(params RollbackParams) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(params)
+		return doRequest(t, s, http.MethodPost, "/endpoint/"+endpoint.ID.String()+"/rollback", b)
+	}
+	expectActive := func(deploy types.Deployment) {
+		t.Helper()
+		e, err := s.store.GetEndpoint(endpoint.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ActiveDeploymentID != deploy.ID {
+			t.Fatalf("expected active deployment %s got %s", deploy.ID, e.ActiveDeploymentID)
+		}
+	}
+
+	publish := func(deploy types.Deployment) {
+		b, _ := json.Marshal(PublishParams{DeploymentID: deploy.ID})
+		rr := doRequest(t, s, http.MethodPost, "/publish/"+deploy.ID.String(), b)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+	}
+	publish(deploys[0])
+	if rr := rollback(RollbackParams{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without a previous deployment got %d", rr.Code)
+	}
+	publish(deploys[1])
+	publish(deploys[2])
+
+	rr := rollback(RollbackParams{})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var resp PublishResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.DeploymentID != deploys[1].ID {
+		t.Fatalf("expected rollback to %s got %s", deploys[1].ID, resp.DeploymentID)
+	}
+	if !strings.HasSuffix(resp.URL, "/live/"+endpoint.Slug) {
+		t.Fatalf("expected the live url of the endpoint got %s", resp.URL)
+	}
+	expectActive(deploys[1])
+
+	// Rolling back again returns to the deployment that was active before the
+	// rollback.
+	if rr := rollback(RollbackParams{}); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	expectActive(deploys[2])
+
+	// The publications are now 0, 1, 2, 1, 2.
+	if rr := rollback(RollbackParams{Steps: 4}); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	expectActive(deploys[0])
+
+	if rr := rollback(RollbackParams{Steps: 10}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for too many steps got %d", rr.Code)
+	}
+	rr = doRequest(t, s, http.MethodPost, "/endpoint/"+uuid.NewString()+"/rollback", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 got %d", rr.Code)
+	}
+}
+
+// newAuthTestServer returns a test server that requires API tokens, with
+// "operator" as operator token.
+func newAuthTestServer() *Server {
+	s := newTestServer()
+	s.authorization = true
+	s.operatorToken = "operator"
+	s.initRouter()
+	return s
+}
+
+// createTestAPIToken stores a new API token of the account and returns the
+// token.
+func createTestAPIToken(t *testing.T, s *Server, accountID uuid.UUID, scopes ...string) (*types.APIToken, string) {
+	t.Helper()
+	apiToken, token := types.NewAPIToken(accountID, "test", scopes)
+	if err := s.accountStore.CreateAPIToken(apiToken); err != nil {
+		t.Fatal(err)
+	}
+	return apiToken, token
+}
+
+func TestAPITokens(t *testing.T) {
+	s := newAuthTestServer()
+
+	rr := doRequest(t, s, http.MethodGet, "/endpoint", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without token got %d", rr.Code)
+	}
+	createAccount := func(name string) types.Account {
+		b, _ := json.Marshal(CreateAccountParams{Name: name})
+		rr := doTokenRequest(t, s, "operator", http.MethodPost, "/account", b)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+		var account types.Account
+		if err := json.NewDecoder(rr.Body).Decode(&account); err != nil {
+			t.Fatal(err)
+		}
+		return account
+	}
+	createToken := func(token string, account types.Account, scopes ...string) string {
+		b, _ := json.Marshal(CreateAPITokenParams{Name: "test", Scopes: scopes})
+		target := fmt.Sprintf("/account/%s/tokens", account.ID)
+		rr := doTokenRequest(t, s, token, http.MethodPost, target, b)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+		var resp CreateAPITokenResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Token
+	}
+	acme, other := createAccount("acme"), createAccount("other")
+	admin := createToken("operator", acme, types.ScopeAdmin)
+	reader := createToken(admin, acme, types.ScopeRead)
+	otherAdmin := createToken("operator", other, types.ScopeAdmin)
+
+	b, _ := json.Marshal(CreateAccountParams{Name: "evil"})
+	rr = doTokenRequest(t, s, admin, http.MethodPost, "/account", b)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for account token got %d", rr.Code)
+	}
+	b, _ = json.Marshal(CreateEndpointParams{Name: "tenant", Runtime: "go"})
+	rr = doTokenRequest(t, s, reader, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 without deploy scope got %d", rr.Code)
+	}
+	rr = doTokenRequest(t, s, admin, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.AccountID != acme.ID {
+		t.Fatalf("expected endpoint of account %s got %s", acme.ID, endpoint.AccountID)
+	}
+
+	target := fmt.Sprintf("/endpoint/%s", endpoint.Slug)
+	if rr := doTokenRequest(t, s, reader, http.MethodGet, target, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doTokenRequest(t, s, otherAdmin, http.MethodGet, target, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for endpoint of other account got %d", rr.Code)
+	}
+	if rr := doTokenRequest(t, s, otherAdmin, http.MethodDelete, target, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for endpoint of other account got %d", rr.Code)
+	}
+	for token, want := range map[string]int{otherAdmin: 0, admin: 1, "operator": 1} {
+		rr := doTokenRequest(t, s, token, http.MethodGet, "/endpoint", nil)
+		var endpoints []types.Endpoint
+		if err := json.NewDecoder(rr.Body).Decode(&endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if len(endpoints) != want {
+			t.Fatalf("expected %d endpoints got %d", want, len(endpoints))
+		}
+	}
+
+	tokens := fmt.Sprintf("/account/%s/tokens", acme.ID)
+	if rr := doTokenRequest(t, s, otherAdmin, http.MethodGet, tokens, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for tokens of other account got %d", rr.Code)
+	}
+	rr = doTokenRequest(t, s, admin, http.MethodGet, tokens, nil)
+	var list []types.APIToken
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 tokens got %d", len(list))
+	}
+	for _, token := range list {
+		if !strings.HasPrefix(reader, token.Prefix) {
+			continue
+		}
+		target := fmt.Sprintf("%s/%s", tokens, token.ID)
+		if rr := doTokenRequest(t, s, admin, http.MethodDelete, target, nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+	}
+	if rr := doTokenRequest(t, s, reader, http.MethodGet, "/endpoint", nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 for revoked token got %d", rr.Code)
+	}
+}
+
+func TestEndpointRoles(t *testing.T) {
+	s := newAuthTestServer()
+	account := types.NewAccount("acme")
+	if err := s.accountStore.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	_, admin := createTestAPIToken(t, s, account.ID, types.ScopeAdmin)
+	dev, devToken := createTestAPIToken(t, s, account.ID, types.ScopeDeploy, types.ScopePublish)
+	releaser, releaserToken := createTestAPIToken(t, s, account.ID, types.ScopeDeploy, types.ScopePublish)
+	_, otherToken := createTestAPIToken(t, s, account.ID, types.ScopeDeploy, types.ScopePublish)
+
+	b, _ := json.Marshal(CreateEndpointParams{Name: "roles", Runtime: "go"})
+	rr := doTokenRequest(t, s, admin, http.MethodPost, "/endpoint", b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil {
+		t.Fatal(err)
+	}
+	deployTarget := fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID)
+	// Without any roles on the endpoint, tokens are developers: they can
+	// deploy but not publish or change the environment.
+	rr = doTokenRequest(t, s, otherToken, http.MethodPost, deployTarget, []byte("wasm blob"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var unroled types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&unroled); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(PublishParams{DeploymentID: unroled.ID})
+	if rr := doTokenRequest(t, s, otherToken, http.MethodPost, "/publish/"+unroled.ID.String(), b); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for publishing without roles got %d", rr.Code)
+	}
+	b, _ = json.Marshal(UpdateEndpointParams{Environment: map[string]string{"FOO": "bar"}})
+	if rr := doTokenRequest(t, s, otherToken, http.MethodPatch, "/endpoint/"+endpoint.ID.String(), b); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for changing the environment without roles got %d", rr.Code)
+	}
+
+	for token, role := range map[uuid.UUID]string{dev.ID: types.RoleDeveloper, releaser.ID: types.RoleReleaser} {
+		b, _ := json.Marshal(SetEndpointRoleParams{Role: role})
+		target := fmt.Sprintf("/endpoint/%s/roles/%s", endpoint.ID, token)
+		if rr := doTokenRequest(t, s, devToken, http.MethodPut, target, b); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected status 403 without admin scope got %d", rr.Code)
+		}
+		if rr := doTokenRequest(t, s, admin, http.MethodPut, target, b); rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+		}
+	}
+	b, _ = json.Marshal(SetEndpointRoleParams{Role: "admin"})
+	target := fmt.Sprintf("/endpoint/%s/roles/%s", endpoint.ID, dev.ID)
+	if rr := doTokenRequest(t, s, admin, http.MethodPut, target, b); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid role got %d", rr.Code)
+	}
+
+	rr = doTokenRequest(t, s, devToken, http.MethodPost, deployTarget, []byte("wasm blob"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var deploy types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+		t.Fatal(err)
+	}
+	if rr := doTokenRequest(t, s, otherToken, http.MethodPost, deployTarget, []byte("wasm blob")); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for token without role got %d", rr.Code)
+	}
+
+	b, _ = json.Marshal(PublishParams{DeploymentID: deploy.ID})
+	rr = doTokenRequest(t, s, devToken, http.MethodPost, "/publish/"+deploy.ID.String(), b)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for developer got %d", rr.Code)
+	}
+	var errResp errorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+		t.Fatalf("expected an error response got %s", rr.Body)
+	}
+	env, _ := json.Marshal(UpdateEndpointParams{Environment: map[string]string{"FOO": "bar"}})
+	if rr := doTokenRequest(t, s, devToken, http.MethodPatch, "/endpoint/"+endpoint.ID.String(), env); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for developer got %d", rr.Code)
+	}
+	if rr := doTokenRequest(t, s, releaserToken, http.MethodPatch, "/endpoint/"+endpoint.ID.String(), env); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doTokenRequest(t, s, releaserToken, http.MethodPost, "/publish/"+deploy.ID.String(), b); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = doTokenRequest(t, s, devToken, http.MethodGet, fmt.Sprintf("/endpoint/%s/roles", endpoint.ID), nil)
+	var roles []types.EndpointRole
+	if err := json.NewDecoder(rr.Body).Decode(&roles); err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("expected 2 roles got %d", len(roles))
+	}
+	if rr := doTokenRequest(t, s, admin, http.MethodDelete, target, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doTokenRequest(t, s, devToken, http.MethodPost, deployTarget, []byte("wasm blob")); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 after removing the role got %d", rr.Code)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	s := newAuthTestServer()
+	account, other := types.NewAccount("acme"), types.NewAccount("other")
+	for _, a := range []*types.Account{account, other} {
+		if err := s.accountStore.CreateAccount(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiToken, token := createTestAPIToken(t, s, account.ID, types.ScopeAdmin)
+	_, otherToken := createTestAPIToken(t, s, other.ID, types.ScopeAdmin)
+
+	b, _ := json.Marshal(CreateEndpointParams{Name: "audited", Runtime: "go", Environment: map[string]string{"FOO": "bar"}})
+	rr := doTokenRequest(t, s, token, http.MethodPost, "/endpoint", b)
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil {
+		t.Fatal(err)
+	}
+	rr = doTokenRequest(t, s, token, http.MethodPost, fmt.Sprintf("/endpoint/%s/deployment", endpoint.ID), []byte("wasm blob"))
+	var deploy types.Deployment
+	if err := json.NewDecoder(rr.Body).Decode(&deploy); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(PublishParams{DeploymentID: deploy.ID})
+	if rr := doTokenRequest(t, s, token, http.MethodPost, "/publish/"+deploy.ID.String(), b); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	b, _ = json.Marshal(UpdateEndpointParams{Environment: map[string]string{"BAR": "baz"}})
+	if rr := doTokenRequest(t, s, token, http.MethodPatch, "/endpoint/"+endpoint.ID.String(), b); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	// Failed mutations are not recorded.
+	b, _ = json.Marshal(PublishParams{DeploymentID: deploy.ID})
+	if rr := doTokenRequest(t, s, token, http.MethodPost, "/publish/"+deploy.ID.String(), b); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for active deploy got %d", rr.Code)
+	}
+
+	rr = doTokenRequest(t, s, token, http.MethodGet, "/audit?endpoint="+endpoint.Slug, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var events []types.AuditEvent
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, len(events))
+	for i, event := range events {
+		actions[i] = event.Action
+		if event.Actor != apiToken.Prefix || event.TokenID != apiToken.ID || event.SourceIP != "192.0.2.1" || event.AccountID != account.ID {
+			t.Fatalf("unexpected actor of event: %+v", event)
+		}
+	}
+	want := []string{types.AuditEndpointUpdate, types.AuditDeployPublish, types.AuditDeployCreate, types.AuditEndpointCreate}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected actions %v got %v", want, actions)
+	}
+	update, publish := events[0], events[1]
+	if publish.TargetID != deploy.ID || publish.Before.ActiveDeploymentID != uuid.Nil || publish.After.ActiveDeploymentID != deploy.ID {
+		t.Fatalf("unexpected publish event: %+v", publish)
+	}
+	if strings.Join(update.Before.EnvKeys, ",") != "FOO" || strings.Join(update.After.EnvKeys, ",") != "BAR" {
+		t.Fatalf("unexpected env keys of update event: %+v %+v", update.Before, update.After)
+	}
+
+	rr = doTokenRequest(t, s, otherToken, http.MethodGet, "/audit?endpoint="+endpoint.ID.String(), nil)
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events of another account got %d", len(events))
+	}
+	if rr := doTokenRequest(t, s, otherToken, http.MethodGet, "/audit?endpoint="+endpoint.Slug, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for endpoint of another account got %d", rr.Code)
+	}
+	rr = doTokenRequest(t, s, "operator", http.MethodGet, "/audit?action="+types.AuditDeployCreate, nil)
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].TargetID != deploy.ID {
+		t.Fatalf("expected the deployment event got %+v", events)
+	}
+}
+
+func TestAccountQuota(t *testing.T) {
+	s := newAuthTestServer()
+
+	b, _ := json.Marshal(CreateAccountParams{Name: "acme", Quota: types.Quota{MonthlyInvocations: -1}})
+	if rr := doTokenRequest(t, s, "operator", http.MethodPost, "/account", b); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a negative quota got %d", rr.Code)
+	}
+	b, _ = json.Marshal(CreateAccountParams{Name: "acme", Quota: types.Quota{MonthlyInvocations: 100}})
+	rr := doTokenRequest(t, s, "operator", http.MethodPost, "/account", b)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var account types.Account
+	if err := json.NewDecoder(rr.Body).Decode(&account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Quota.MonthlyInvocations != 100 {
+		t.Fatalf("expected quota of 100 invocations got %+v", account.Quota)
+	}
+	_, admin := createTestAPIToken(t, s, account.ID, types.ScopeAdmin)
+	_, reader := createTestAPIToken(t, s, account.ID, types.ScopeRead)
+
+	target := fmt.Sprintf("/account/%s/quota", account.ID)
+	b, _ = json.Marshal(SetAccountQuotaParams{MonthlyInvocations: 2, MonthlyComputeTime: time.Hour})
+	if rr := doTokenRequest(t, s, admin, http.MethodPut, target, b); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for account token got %d", rr.Code)
+	}
+	if rr := doTokenRequest(t, s, "operator", http.MethodPut, target, b); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	negative, _ := json.Marshal(SetAccountQuotaParams{MonthlyComputeTime: -time.Second})
+	if rr := doTokenRequest(t, s, "operator", http.MethodPut, target, negative); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a negative quota got %d", rr.Code)
+	}
+
+	month := types.MonthStart(time.Now())
+	for _, at := range []time.Time{month, month.AddDate(0, 0, 1), month.Add(-time.Second)} {
+		if err := s.metricStore.AddAccountUsage(account.ID, at, types.Usage{Invocations: 1, ComputeTime: time.Second}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rr = doTokenRequest(t, s, reader, http.MethodGet, fmt.Sprintf("/account/%s/usage", account.ID), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var usage AccountUsageResponse
+	if err := json.NewDecoder(rr.Body).Decode(&usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Usage.Invocations != 2 || usage.Usage.ComputeTime != 2*time.Second {
+		t.Fatalf("expected the usage of the current month got %+v", usage.Usage)
+	}
+	if usage.Quota.MonthlyInvocations != 2 || !usage.Exceeded {
+		t.Fatalf("expected the quota to be exceeded got %+v", usage)
+	}
+	rr = doTokenRequest(t, s, reader, http.MethodGet, fmt.Sprintf("/account/%s/usage", uuid.New()), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for another account got %d", rr.Code)
+	}
+}
+
+func TestMetricsExposition(t *testing.T) {
+	s := newTestServer()
+	doRequest(t, s, http.MethodGet, "/status", nil)
+
+	rr := doRequest(t, s, http.MethodGet, "/metrics", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rr.Code)
+	}
+	expected := `raptor_api_requests_total{code="200",method="GET",route="/status"}`
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Fatalf("expected metrics to contain %s", expected)
+	}
+}
+
+func TestGetEndpointLogs(t *testing.T) {
+	s := newTestServer()
+	s.followInterval = time.Millisecond * 10
+	endpoint := types.NewEndpoint("logs", "go", nil)
+	if err := s.store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	endpointID := endpoint.ID
+	newLog := func(stream, line string) types.RuntimeLog {
+		return types.RuntimeLog{
+			EndpointID:   endpointID,
+			DeploymentID: uuid.New(),
+			RequestID:    "request",
+			Stream:       stream,
+			Line:         line,
+			Time:         time.Now(),
+		}
+	}
+	err := s.logStore.CreateRuntimeLogs([]types.RuntimeLog{
+		newLog(types.LogStreamStdout, "first"),
+		newLog(types.LogStreamStderr, "second"),
+		newLog(types.LogStreamStdout, "third"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := fmt.Sprintf("/endpoint/%s/logs", endpointID)
+	rr := doRequest(t, s, http.MethodGet, target+"?stream=stdout&limit=1", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", rr.Code, rr.Body)
+	}
+	var logs []types.RuntimeLog
+	if err := json.NewDecoder(rr.Body).Decode(&logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Line != "third" {
+		t.Fatalf("expected the newest stdout line got %+v", logs)
+	}
+
+	rr = doRequest(t, s, http.MethodGet, target+"?stream=foo", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid stream got %d", rr.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		s.logStore.CreateRuntimeLogs([]types.RuntimeLog{newLog(types.LogStreamStdout, "fourth")})
+	}()
+	req := httptest.NewRequest(http.MethodGet, target+"?follow=true", nil).WithContext(ctx)
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+
+	var lines []string
+	dec := json.NewDecoder(rr.Body)
+	for dec.More() {
+		var log types.RuntimeLog
+		if err := dec.Decode(&log); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, log.Line)
+	}
+	if strings.Join(lines, ",") != "first,second,third,fourth" {
+		t.Fatalf("expected the followed logs in order got %v", lines)
+	}
+}
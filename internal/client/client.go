@@ -2,10 +2,15 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/anthdm/raptor/internal/api"
 	"github.com/anthdm/raptor/internal/types"
@@ -13,7 +18,8 @@ import (
 )
 
 type Config struct {
-	url string
+	url   string
+	token string
 }
 
 func NewConfig() Config {
@@ -27,6 +33,12 @@ func (c Config) WithURL(url string) Config {
 	return c
 }
 
+// WithToken sets the API token that authorizes the requests of the client.
+func (c Config) WithToken(token string) Config {
+	c.token = token
+	return c
+}
+
 type Client struct {
 	*http.Client
 
@@ -40,6 +52,14 @@ func New(config Config) *Client {
 	}
 }
 
+// Do sends the request with the API token of the client, if any.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.config.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.token)
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) Publish(params api.PublishParams) (*api.PublishResponse, error) {
 	b, err := json.Marshal(params)
 	if err != nil {
@@ -66,6 +86,84 @@ func (c *Client) Publish(params api.PublishParams) (*api.PublishResponse, error)
 	return &publishResponse, nil
 }
 
+func (c *Client) Rollback(endpointID uuid.UUID, params api.RollbackParams) (*api.PublishResponse, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/endpoint/%s/rollback", c.config.url, endpointID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var publishResponse api.PublishResponse
+	if err := json.NewDecoder(resp.Body).Decode(&publishResponse); err != nil {
+		return nil, err
+	}
+	return &publishResponse, nil
+}
+
+func (c *Client) SetTrafficSplit(endpointID uuid.UUID, params api.TrafficSplitParams) (*types.Endpoint, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/endpoint/%s/traffic", c.config.url, endpointID)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+func (c *Client) DeleteTrafficSplit(endpointID uuid.UUID) error {
+	url := fmt.Sprintf("%s/endpoint/%s/traffic", c.config.url, endpointID)
+	return c.delete(url)
+}
+
+func (c *Client) PromoteCanary(endpointID uuid.UUID) (*api.PublishResponse, error) {
+	url := fmt.Sprintf("%s/endpoint/%s/traffic/promote", c.config.url, endpointID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var publishResponse api.PublishResponse
+	if err := json.NewDecoder(resp.Body).Decode(&publishResponse); err != nil {
+		return nil, err
+	}
+	return &publishResponse, nil
+}
+
 func (c *Client) CreateEndpoint(params api.CreateEndpointParams) (*types.Endpoint, error) {
 	b, err := json.Marshal(params)
 	if err != nil {
@@ -92,6 +190,75 @@ func (c *Client) CreateEndpoint(params api.CreateEndpointParams) (*types.Endpoin
 	return &endpoint, nil
 }
 
+func (c *Client) GetEndpoint(endpointID uuid.UUID) (*types.Endpoint, error) {
+	url := fmt.Sprintf("%s/endpoint/%s", c.config.url, endpointID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+func (c *Client) GetEndpointBySlug(slug string) (*types.Endpoint, error) {
+	path := fmt.Sprintf("/endpoint/%s", url.PathEscape(slug))
+	url := c.config.url + path
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+func (c *Client) UpdateEndpoint(endpointID uuid.UUID, params api.UpdateEndpointParams) (*types.Endpoint, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/endpoint/%s", c.config.url, endpointID)
+	req, err := http.NewRequest("PATCH", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var endpoint types.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
 func (c *Client) CreateDeployment(endpointID uuid.UUID, blob io.Reader, params api.CreateDeploymentParams) (*types.Deployment, error) {
 	url := fmt.Sprintf("%s/endpoint/%s/deployment", c.config.url, endpointID)
 	req, err := http.NewRequest("POST", url, blob)
@@ -132,3 +299,508 @@ func (c *Client) ListEndpoints() ([]types.Endpoint, error) {
 	resp.Body.Close()
 	return endpoints, nil
 }
+
+func (c *Client) GetMetricsSummary(endpointID uuid.UUID, params api.MetricsSummaryParams) (*types.MetricsSummary, error) {
+	query := url.Values{}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339))
+	}
+	if params.Bucket > 0 {
+		query.Set("bucket", params.Bucket.String())
+	}
+	if params.DeploymentID != uuid.Nil {
+		query.Set("deployment", params.DeploymentID.String())
+	}
+	url := fmt.Sprintf("%s/endpoint/%s/metrics/summary?%s", c.config.url, endpointID, query.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var summary types.MetricsSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return &summary, nil
+}
+
+func (c *Client) GetSecrets(endpointID uuid.UUID) ([]types.Secret, error) {
+	url := fmt.Sprintf("%s/endpoint/%s/secrets", c.config.url, endpointID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var secrets []types.Secret
+	if err := json.NewDecoder(resp.Body).Decode(&secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (c *Client) PutSecret(endpointID uuid.UUID, name string, params api.PutSecretParams) (*types.Secret, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/endpoint/%s/secrets/%s", endpointID, url.PathEscape(name))
+	url := c.config.url + path
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var secret types.Secret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func (c *Client) DeleteSecret(endpointID uuid.UUID, name string) error {
+	path := fmt.Sprintf("/endpoint/%s/secrets/%s", endpointID, url.PathEscape(name))
+	url := c.config.url + path
+	return c.delete(url)
+}
+
+func (c *Client) RotateSecrets() (*api.RotateSecretsResponse, error) {
+	url := fmt.Sprintf("%s/secrets/rotate", c.config.url)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var rotateResponse api.RotateSecretsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotateResponse); err != nil {
+		return nil, err
+	}
+	return &rotateResponse, nil
+}
+
+func (c *Client) GetDomains(endpointID uuid.UUID) ([]types.Domain, error) {
+	url := fmt.Sprintf("%s/endpoint/%s/domains", c.config.url, endpointID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var domains []types.Domain
+	if err := json.NewDecoder(resp.Body).Decode(&domains); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (c *Client) CreateDomain(endpointID uuid.UUID, params api.CreateDomainParams) (*types.Domain, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/endpoint/%s/domains", c.config.url, endpointID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var domain types.Domain
+	if err := json.NewDecoder(resp.Body).Decode(&domain); err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *Client) VerifyDomain(domainID uuid.UUID) (*types.Domain, error) {
+	url := fmt.Sprintf("%s/domain/%s/verify", c.config.url, domainID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var domain types.Domain
+	if err := json.NewDecoder(resp.Body).Decode(&domain); err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *Client) DeleteDomain(domainID uuid.UUID) error {
+	url := fmt.Sprintf("%s/domain/%s", c.config.url, domainID)
+	return c.delete(url)
+}
+
+func (c *Client) CreateAccount(params api.CreateAccountParams) (*types.Account, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/account", c.config.url)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var account types.Account
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) SetAccountQuota(accountID uuid.UUID, params api.SetAccountQuotaParams) (*types.Account, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/account/%s/quota", c.config.url, accountID)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var account types.Account
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) GetAccountUsage(accountID uuid.UUID) (*api.AccountUsageResponse, error) {
+	url := fmt.Sprintf("%s/account/%s/usage", c.config.url, accountID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var usage api.AccountUsageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (c *Client) GetAPITokens(accountID uuid.UUID) ([]types.APIToken, error) {
+	url := fmt.Sprintf("%s/account/%s/tokens", c.config.url, accountID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var tokens []types.APIToken
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *Client) CreateAPIToken(accountID uuid.UUID, params api.CreateAPITokenParams) (*api.CreateAPITokenResponse, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/account/%s/tokens", c.config.url, accountID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var tokenResponse api.CreateAPITokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+	return &tokenResponse, nil
+}
+
+func (c *Client) DeleteAPIToken(accountID, tokenID uuid.UUID) error {
+	url := fmt.Sprintf("%s/account/%s/tokens/%s", c.config.url, accountID, tokenID)
+	return c.delete(url)
+}
+
+func (c *Client) GetEndpointRoles(endpointID uuid.UUID) ([]types.EndpointRole, error) {
+	url := fmt.Sprintf("%s/endpoint/%s/roles", c.config.url, endpointID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var roles []types.EndpointRole
+	if err := json.NewDecoder(resp.Body).Decode(&roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (c *Client) SetEndpointRole(endpointID, tokenID uuid.UUID, params api.SetEndpointRoleParams) (*types.EndpointRole, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/endpoint/%s/roles/%s", c.config.url, endpointID, tokenID)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var role types.EndpointRole
+	if err := json.NewDecoder(resp.Body).Decode(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (c *Client) DeleteEndpointRole(endpointID, tokenID uuid.UUID) error {
+	url := fmt.Sprintf("%s/endpoint/%s/roles/%s", c.config.url, endpointID, tokenID)
+	return c.delete(url)
+}
+
+func (c *Client) DeleteEndpoint(endpointID uuid.UUID) error {
+	url := fmt.Sprintf("%s/endpoint/%s", c.config.url, endpointID)
+	return c.delete(url)
+}
+
+// DeleteDeployment deletes the given deployment. The active deployment of an
+// endpoint is only deleted when force is true.
+func (c *Client) DeleteDeployment(deployID uuid.UUID, force bool) error {
+	url := fmt.Sprintf("%s/deployment/%s?force=%t", c.config.url, deployID, force)
+	return c.delete(url)
+}
+
+func (c *Client) delete(url string) error {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error != "" {
+			return fmt.Errorf("api responded with a non 200 status code: %d: %s", resp.StatusCode, errResp.Error)
+		}
+		return fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) GetLogs(endpointID uuid.UUID, params api.LogsParams) ([]types.RuntimeLog, error) {
+	url := fmt.Sprintf("%s/endpoint/%s/logs?%s", c.config.url, endpointID, makeLogsQuery(params).Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var logs []types.RuntimeLog
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return logs, nil
+}
+
+func (c *Client) GetAudit(params api.AuditParams) ([]types.AuditEvent, error) {
+	query := url.Values{}
+	if params.Endpoint != "" {
+		query.Set("endpoint", params.Endpoint)
+	}
+	if params.Action != "" {
+		query.Set("action", params.Action)
+	}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.Offset > 0 {
+		query.Set("offset", strconv.Itoa(params.Offset))
+	}
+	url := fmt.Sprintf("%s/audit?%s", c.config.url, query.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	var events []types.AuditEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FollowLogs calls fn for the latest logs of the given endpoint and for every
+// log that is stored afterwards, until the context is done or fn returns an
+// error.
+func (c *Client) FollowLogs(ctx context.Context, endpointID uuid.UUID, params api.LogsParams, fn func(types.RuntimeLog) error) error {
+	query := makeLogsQuery(params)
+	query.Set("follow", "true")
+	url := fmt.Sprintf("%s/endpoint/%s/logs?%s", c.config.url, endpointID, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("api responded with a non 200 status code: %d", resp.StatusCode)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var log types.RuntimeLog
+		if err := dec.Decode(&log); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+}
+
+func makeLogsQuery(params api.LogsParams) url.Values {
+	query := url.Values{}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339))
+	}
+	if params.DeploymentID != uuid.Nil {
+		query.Set("deployment", params.DeploymentID.String())
+	}
+	if params.RequestID != "" {
+		query.Set("request", params.RequestID)
+	}
+	if params.Stream != "" {
+		query.Set("stream", params.Stream)
+	}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	return query
+}
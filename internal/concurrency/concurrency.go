@@ -0,0 +1,151 @@
+// Package concurrency limits the number of concurrent invocations per key,
+// with a bounded FIFO queue for the requests over the limit.
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+)
+
+var (
+	// ErrQueueFull is returned when the limit is reached and the queue is
+	// full.
+	ErrQueueFull = errors.New("too many concurrent requests")
+	// ErrQueueTimeout is returned when the request waited in the queue for
+	// longer than the queue timeout.
+	ErrQueueTimeout = errors.New("timed out waiting for a free invocation slot")
+)
+
+// Observer is called with the number of active and queued requests of a key
+// every time they change. It is called with the lock of the limiter held, so
+// it must not call the limiter.
+type Observer func(key string, active, queued int)
+
+// Limiter keeps the active and queued requests per key, like an endpoint. It
+// is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	keys     map[string]*state
+	observer Observer
+}
+
+type state struct {
+	active int
+	max    int
+	// queue holds the requests waiting for a slot, oldest first. A slot is
+	// handed over by closing the channel of the request.
+	queue []chan struct{}
+}
+
+// New returns a limiter that reports its changes to the observer, which can
+// be nil.
+func New(observer Observer) *Limiter {
+	if observer == nil {
+		observer = func(string, int, int) {}
+	}
+	return &Limiter{
+		keys:     make(map[string]*state),
+		observer: observer,
+	}
+}
+
+// Acquire takes a slot of the key, waiting in the queue when all slots are
+// taken. It returns the function that gives the slot back, which must be
+// called once the invocation is done. Requests wait until the queue timeout
+// of the limit passed or the context is done.
+func (l *Limiter) Acquire(ctx context.Context, key string, limit types.Concurrency) (func(), error) {
+	if limit.Unlimited() {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	s, ok := l.keys[key]
+	if !ok {
+		s = &state{}
+		l.keys[key] = s
+	}
+	s.max = limit.MaxConcurrent
+	if s.active < s.max && len(s.queue) == 0 {
+		s.active++
+		l.observer(key, s.active, len(s.queue))
+		l.mu.Unlock()
+		return l.releaser(key), nil
+	}
+	if len(s.queue) >= limit.MaxQueue {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	ready := make(chan struct{})
+	s.queue = append(s.queue, ready)
+	l.observer(key, s.active, len(s.queue))
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if limit.QueueTimeout > 0 {
+		timer := time.NewTimer(limit.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+		return l.releaser(key), nil
+	case <-timeout:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := slices.Index(s.queue, ready)
+	if i < 0 {
+		// The slot was handed over while the request gave up.
+		return l.releaser(key), nil
+	}
+	s.queue = slices.Delete(s.queue, i, i+1)
+	l.observer(key, s.active, len(s.queue))
+	l.cleanup(key, s)
+	return nil, ErrQueueTimeout
+}
+
+// releaser returns the function that gives a slot of the key back. The slot
+// is handed over to the oldest queued request, unless the limit was lowered
+// below the active requests.
+func (l *Limiter) releaser(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			s := l.keys[key]
+			if len(s.queue) > 0 && s.active <= s.max {
+				close(s.queue[0])
+				s.queue = s.queue[1:]
+			} else {
+				s.active--
+			}
+			l.observer(key, s.active, len(s.queue))
+			l.cleanup(key, s)
+		})
+	}
+}
+
+// cleanup removes the state of a key without requests. It expects the lock to
+// be held.
+func (l *Limiter) cleanup(key string, s *state) {
+	if s.active == 0 && len(s.queue) == 0 {
+		delete(l.keys, key)
+	}
+}
+
+// Stats returns the number of active and queued requests of the key.
+func (l *Limiter) Stats(key string) (active, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.keys[key]; ok {
+		return s.active, len(s.queue)
+	}
+	return 0, 0
+}
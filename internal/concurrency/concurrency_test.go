@@ -0,0 +1,102 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+)
+
+func TestLimiterAcquire(t *testing.T) {
+	l := New(nil)
+	limit := types.Concurrency{MaxConcurrent: 2, MaxQueue: 1, QueueTimeout: time.Second}
+	first, err := l.Acquire(context.Background(), "a", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), "a", limit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), "b", limit); err != nil {
+		t.Fatalf("expected the slots of other keys to be independent got %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.Acquire(context.Background(), "a", limit)
+		acquired <- err
+	}()
+	waitForStats(t, l, "a", 2, 1)
+	if _, err := l.Acquire(context.Background(), "a", limit); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull got %v", err)
+	}
+	first()
+	first()
+	if err := <-acquired; err != nil {
+		t.Fatalf("expected the queued request to get the released slot got %v", err)
+	}
+	if active, queued := l.Stats("a"); active != 2 || queued != 0 {
+		t.Fatalf("expected 2 active and 0 queued requests got %d and %d", active, queued)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := New(nil)
+	limit := types.Concurrency{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond}
+	release, err := l.Acquire(context.Background(), "a", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), "a", limit); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected ErrQueueTimeout got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limit.QueueTimeout = 0
+	if _, err := l.Acquire(ctx, "a", limit); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected ErrQueueTimeout for a done context got %v", err)
+	}
+	if active, queued := l.Stats("a"); active != 1 || queued != 0 {
+		t.Fatalf("expected the timed out requests to leave the queue got %d and %d", active, queued)
+	}
+	release()
+	if _, ok := l.keys["a"]; ok {
+		t.Fatal("expected the state of a key without requests to be removed")
+	}
+}
+
+func TestLimiterObserver(t *testing.T) {
+	var changes [][2]int
+	l := New(func(key string, active, queued int) {
+		changes = append(changes, [2]int{active, queued})
+	})
+	if _, err := l.Acquire(context.Background(), "a", types.Concurrency{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatal("expected unlimited requests not to be tracked")
+	}
+	release, err := l.Acquire(context.Background(), "a", types.Concurrency{MaxConcurrent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release()
+	if len(changes) != 2 || changes[0] != [2]int{1, 0} || changes[1] != [2]int{0, 0} {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+}
+
+func waitForStats(t *testing.T, l *Limiter, key string, active, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if a, q := l.Stats(key); a == active && q == queued {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d active and %d queued requests of %s", active, queued, key)
+}
@@ -4,17 +4,47 @@ import (
 	"errors"
 	"net"
 	"os"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
 
 const defaultConfig = `
 wasmServerAddr 		= "localhost:5000"
+wasmTelemetryAddr	= "localhost:5001"
 apiServerAddr 		= "localhost:3000"
 storageDriver 		= "sqlite"
 apiToken			= "foobarbaz"
 authorization		= false
 
+[runtime]
+poolMinSize			= 1
+poolMaxSize			= 16
+poolIdleTimeout		= "5m"
+maxMemoryPages		= 2048
+timeout				= "10s"
+maxCalls			= 0
+logRetention		= "168h"
+
+[rateLimit]
+endpointRate		= 0
+endpointBurst		= 0
+clientRate			= 0
+clientBurst			= 0
+
+[quota]
+monthlyInvocations	= 0
+monthlyComputeTime	= "0s"
+
+[concurrency]
+maxConcurrent		= 0
+maxQueue			= 0
+queueTimeout		= "10s"
+
+[secrets]
+masterKey			= ""
+previousMasterKeys	= []
+
 [cluster]
 addr 				= "localhost:6666"
 id					= "wasm_member_1" 
@@ -27,6 +57,7 @@ name 				= "postgres"
 host				= "localhost"
 port				= "5432"
 sslmode 			= "disable"
+path				= "raptor.db"
 `
 
 // Config holds the global configuration which is READONLY.
@@ -39,6 +70,65 @@ type Storage struct {
 	Host     string
 	Port     string
 	SSLMode  string
+	// Path is the location of the database file when using the sqlite driver.
+	Path string
+}
+
+// Runtime configures the pool of warm wasm runtimes that is kept per
+// deployment, the default resource limits of each invocation and the
+// retention of the logs of the guests.
+type Runtime struct {
+	PoolMinSize     int
+	PoolMaxSize     int
+	PoolIdleTimeout Duration
+	// MaxMemoryPages is the default memory limit in 64KiB wasm pages.
+	MaxMemoryPages uint32
+	// Timeout is the default wall-clock timeout of an invocation.
+	Timeout Duration
+	// MaxCalls is the default number of guest function calls an
+	// invocation can make, 0 means unlimited. It counts calls, not CPU
+	// time, loops without calls are only limited by the Timeout.
+	MaxCalls uint64
+	// LogRetention is the duration the logs of the guests are kept, 0 keeps
+	// them forever.
+	LogRetention Duration
+}
+
+// RateLimit configures the default rate limits of the endpoints in requests
+// per second, a rate of 0 does not limit the requests. A burst of 0 allows
+// bursts of one second worth of requests.
+type RateLimit struct {
+	// EndpointRate limits all requests to an endpoint.
+	EndpointRate  float64
+	EndpointBurst int
+	// ClientRate limits the requests of each client IP to an endpoint.
+	ClientRate  float64
+	ClientBurst int
+}
+
+// Quota configures the default monthly quotas of the accounts, 0 does not
+// limit the usage.
+type Quota struct {
+	MonthlyInvocations int64
+	MonthlyComputeTime Duration
+}
+
+// Concurrency configures the default concurrency limits of the endpoints. A
+// maxConcurrent of 0 does not limit the concurrent invocations. Requests over
+// the limit wait for at most QueueTimeout in a queue of MaxQueue requests.
+type Concurrency struct {
+	MaxConcurrent int
+	MaxQueue      int
+	QueueTimeout  Duration
+}
+
+// Secrets configures the encryption of the secrets of the endpoints. The
+// master keys are base64 encoded 32 byte keys, secrets can only be used when
+// a master key is set. After a new master key is set, the replaced one is
+// kept in PreviousMasterKeys until the secrets are rotated.
+type Secrets struct {
+	MasterKey          string
+	PreviousMasterKeys []string
 }
 
 type Cluster struct {
@@ -50,12 +140,37 @@ type Cluster struct {
 type Config struct {
 	APIServerAddr  string
 	WASMServerAddr string
-	StorageDriver  string
-	APIToken       string
-	Authorization  bool
+	// WASMTelemetryAddr is the address the wasm server serves its metrics
+	// on, apart from the public requests. Empty disables the metrics.
+	WASMTelemetryAddr string
+	StorageDriver     string
+	APIToken          string
+	Authorization     bool
+
+	Storage     Storage
+	Runtime     Runtime
+	RateLimit   RateLimit
+	Quota       Quota
+	Concurrency Concurrency
+	Secrets     Secrets
+	Cluster     Cluster
+}
+
+// Duration is a time.Duration that is decoded from a string like "5m" or
+// "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
 
-	Storage Storage
-	Cluster Cluster
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
 }
 
 func Parse(path string) error {
@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
 
 func TestMakeURL(t *testing.T) {
 	testCases := []struct {
@@ -21,3 +26,47 @@ func TestMakeURL(t *testing.T) {
 	}
 
 }
+
+func TestParseDuration(t *testing.T) {
+	var cfg Config
+	b := []byte("[runtime]\npoolIdleTimeout = \"1m30s\"\n")
+	if err := toml.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(cfg.Runtime.PoolIdleTimeout) != 90*time.Second {
+		t.Fatalf("expected 1m30s got %s", time.Duration(cfg.Runtime.PoolIdleTimeout))
+	}
+}
+
+func TestParseDefaultConfig(t *testing.T) {
+	var cfg Config
+	if err := toml.Unmarshal([]byte(defaultConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Runtime.PoolMaxSize != 16 || time.Duration(cfg.Runtime.PoolIdleTimeout) != 5*time.Minute {
+		t.Fatalf("unexpected runtime config: %+v", cfg.Runtime)
+	}
+	if cfg.Runtime.MaxMemoryPages != 2048 || time.Duration(cfg.Runtime.Timeout) != 10*time.Second {
+		t.Fatalf("unexpected runtime limits: %+v", cfg.Runtime)
+	}
+	if cfg.Concurrency.MaxConcurrent != 0 || time.Duration(cfg.Concurrency.QueueTimeout) != 10*time.Second {
+		t.Fatalf("unexpected concurrency config: %+v", cfg.Concurrency)
+	}
+	if cfg.WASMTelemetryAddr == "" || cfg.WASMTelemetryAddr == cfg.WASMServerAddr {
+		t.Fatalf("expected a separate telemetry address got %q", cfg.WASMTelemetryAddr)
+	}
+}
+
+func TestParseRateLimitAndQuota(t *testing.T) {
+	var cfg Config
+	b := []byte("[rateLimit]\nendpointRate = 100\nclientRate = 2.5\nclientBurst = 5\n\n[quota]\nmonthlyInvocations = 1000000\nmonthlyComputeTime = \"10h\"\n")
+	if err := toml.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimit.EndpointRate != 100 || cfg.RateLimit.ClientRate != 2.5 || cfg.RateLimit.ClientBurst != 5 {
+		t.Fatalf("unexpected rate limit config: %+v", cfg.RateLimit)
+	}
+	if cfg.Quota.MonthlyInvocations != 1000000 || time.Duration(cfg.Quota.MonthlyComputeTime) != 10*time.Hour {
+		t.Fatalf("unexpected quota config: %+v", cfg.Quota)
+	}
+}
@@ -0,0 +1,226 @@
+// Package devserver serves a single function from a local file for
+// development, without the storage or the actor cluster. The file is reloaded
+// whenever it changes.
+package devserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/raptor/internal/runtime"
+	"github.com/anthdm/raptor/internal/shared"
+	"github.com/anthdm/raptor/internal/spidermonkey"
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+
+	prot "google.golang.org/protobuf/proto"
+)
+
+const defaultReloadInterval = time.Millisecond * 500
+
+type Config struct {
+	// File is the wasm module of a go function or the script of a js
+	// function.
+	File    string
+	Runtime string
+	Env     map[string]string
+	Limits  types.Limits
+	// ReloadInterval is the interval at which the file is checked for
+	// changes.
+	ReloadInterval time.Duration
+	// Logs receives the lines the function prints on stdout and stderr,
+	// os.Stderr when nil.
+	Logs io.Writer
+}
+
+// Server is an http.Handler that invokes the function of a local file for
+// every request, with the same request and response encoding as the runtime
+// actor.
+type Server struct {
+	config Config
+
+	mu      sync.RWMutex
+	gen     *generation
+	modTime time.Time
+	size    int64
+}
+
+// generation is a loaded version of the file. The compilation cache of a
+// replaced generation is closed once the invocations that use it are done.
+type generation struct {
+	blob     []byte
+	cache    wazero.CompilationCache
+	inflight sync.WaitGroup
+}
+
+// New returns a new Server that serves the function of the file of the given
+// config.
+func New(config Config) (*Server, error) {
+	if !types.ValidRuntime(config.Runtime) {
+		return nil, fmt.Errorf("invalid runtime: %s", config.Runtime)
+	}
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = defaultReloadInterval
+	}
+	if config.Logs == nil {
+		config.Logs = os.Stderr
+	}
+	s := &Server{config: config}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Watch reloads the file whenever it changes until the given context is done.
+func (s *Server) Watch(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := s.reload()
+		if err != nil {
+			slog.Warn("failed to reload function", "err", err, "file", s.config.File)
+			continue
+		}
+		if reloaded {
+			slog.Info("reloaded function", "file", s.config.File)
+		}
+	}
+}
+
+// reload reads the file when it changed since it was last read and returns
+// true when it did.
+func (s *Server) reload() (bool, error) {
+	info, err := os.Stat(s.config.File)
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	changed := !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+	s.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	b, err := os.ReadFile(s.config.File)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	old := s.gen
+	s.gen = &generation{blob: b, cache: wazero.NewCompilationCache()}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+
+	if old != nil {
+		go func() {
+			old.inflight.Wait()
+			old.cache.Close(context.Background())
+		}()
+	}
+	return true, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.NewString()
+	r.Header.Set("x-request-id", requestID)
+	req, err := shared.MakeProtoRequest(requestID, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Locally the function is served on the root instead of /live/<id>.
+	req.URL = r.URL.Path
+	req.Runtime = s.config.Runtime
+	req.Env = s.config.Env
+
+	b, err := prot.Marshal(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.RLock()
+	gen := s.gen
+	gen.inflight.Add(1)
+	s.mu.RUnlock()
+	defer gen.inflight.Done()
+
+	var (
+		out      = &bytes.Buffer{}
+		stderr   = &bytes.Buffer{}
+		response = &bytes.Buffer{}
+		args     = runtime.InvokeArgs{
+			In:       bytes.NewReader(b),
+			Out:      out,
+			Err:      stderr,
+			Response: response,
+			Env:      s.config.Env,
+			Cache:    gen.cache,
+			Limits:   s.config.Limits,
+		}
+	)
+	switch s.config.Runtime {
+	case "go":
+		args.Blob = gen.blob
+	case "js":
+		args.Blob = spidermonkey.WasmBlob
+		args.Args = []string{"", "-e", string(gen.blob)}
+	}
+
+	start := time.Now()
+	err = runtime.Invoke(r.Context(), args)
+	if err != nil {
+		s.printLogs(requestID, out.String(), stderr.String())
+		slog.Error("invoke error", "err", err, "request", requestID)
+		status, message := runtime.ErrorStatus(err)
+		http.Error(w, message, status)
+		return
+	}
+	resp, logs, err := shared.ParseRuntimeResponse(response.Bytes(), out.String())
+	if err != nil {
+		s.printLogs(requestID, out.String(), stderr.String())
+		slog.Error("invalid response", "err", err, "request", requestID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.printLogs(requestID, logs, stderr.String())
+
+	shared.WriteResponseHeader(w.Header(), resp.Header)
+	w.WriteHeader(int(resp.StatusCode))
+	w.Write(resp.Response)
+	slog.Info("served request", "method", r.Method, "url", req.URL, "status", resp.StatusCode, "duration", time.Since(start), "request", requestID)
+}
+
+// printLogs prints the output of an invocation to the logs writer, each line
+// prefixed with its stream, stdout first.
+func (s *Server) printLogs(requestID, stdout, stderr string) {
+	streams := []struct{ name, output string }{
+		{types.LogStreamStdout, stdout},
+		{types.LogStreamStderr, stderr},
+	}
+	for _, stream := range streams {
+		output := strings.TrimRight(stream.output, "\n")
+		if len(output) == 0 {
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			fmt.Fprintf(s.config.Logs, "%s %s %s\n", requestID, stream.name, line)
+		}
+	}
+}
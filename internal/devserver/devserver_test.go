@@ -0,0 +1,88 @@
+package devserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// responseWasm returns a module that writes a response with the body "hi" and
+// the given status code (between 128 and 255) with the write_response host
+// function.
+func responseWasm(status byte) []byte {
+	return []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+		0x01, 0x09, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x00, 0x60, 0x00, 0x00, // type section: func(i32, i32) and func()
+		0x02, 0x19, 0x01, 0x06, 'r', 'a', 'p', 't', 'o', 'r', // import section: raptor
+		0x0e, 'w', 'r', 'i', 't', 'e', '_', 'r', 'e', 's', 'p', 'o', 'n', 's', 'e', 0x00, 0x00, // write_response
+		0x03, 0x02, 0x01, 0x01, // function section
+		0x05, 0x03, 0x01, 0x00, 0x01, // memory section: 1 page
+		0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x01, // export _start
+		0x0a, 0x0a, 0x01, 0x08, 0x00, 0x41, 0x00, 0x41, 0x07, 0x10, 0x00, 0x0b, // code section: write_response(0, 7)
+		0x0b, 0x0d, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x07, // data section at 0
+		0x0a, 0x02, 'h', 'i', 0x10, status, 0x01, // HTTPResponse{Response: "hi", StatusCode: status}
+	}
+}
+
+func serve(t *testing.T, s *Server) (int, string) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/login", nil))
+	b, _ := io.ReadAll(rr.Body)
+	return rr.Code, string(b)
+}
+
+func TestServeReloadsChangedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.wasm")
+	if err := os.WriteFile(file, responseWasm(0xc9), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{File: file, Runtime: "go", Logs: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body := serve(t, s); code != http.StatusCreated || body != "hi" {
+		t.Fatalf("expected 201 hi got %d %s", code, body)
+	}
+
+	if err := os.WriteFile(file, responseWasm(0xca), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the modification time changes on file systems with a coarse
+	// time resolution.
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Fatal("expected the changed file to be reloaded")
+	}
+	if code, _ := serve(t, s); code != http.StatusAccepted {
+		t.Fatalf("expected the reloaded function to respond with 202 got %d", code)
+	}
+}
+
+func TestNewInvalidRuntime(t *testing.T) {
+	if _, err := New(Config{File: "app.wasm", Runtime: "rust"}); err == nil {
+		t.Fatal("expected an error for an invalid runtime")
+	}
+}
+
+func TestPrintLogsOrder(t *testing.T) {
+	var logs bytes.Buffer
+	s := &Server{config: Config{Logs: &logs}}
+	s.printLogs("req", "out 1\nout 2\n", "err 1\n")
+	want := "req stdout out 1\nreq stdout out 2\nreq stderr err 1\n"
+	if logs.String() != want {
+		t.Fatalf("expected logs %q got %q", want, logs.String())
+	}
+}
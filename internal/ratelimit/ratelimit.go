@@ -0,0 +1,93 @@
+// Package ratelimit limits the rate of requests with token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+)
+
+// Limiter keeps a token bucket per key, like an endpoint or a client of an
+// endpoint. It is safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+// refill adds the tokens that were earned since the last refill.
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+func New() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of the key. When the bucket is empty
+// the request is not allowed and the duration until the next token is
+// returned. A changed limit applies to the existing bucket of the key.
+func (l *Limiter) Allow(key string, limit types.RateLimit) (bool, time.Duration) {
+	if limit.Unlimited() {
+		return true, 0
+	}
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		// Allow bursts of one second worth of requests.
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.rate, b.burst = limit.Rate, burst
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// Prune removes the buckets that are full again, they allow the same
+// requests as a new bucket. It keeps the memory of the limiter bounded by the
+// number of recently active keys.
+func (l *Limiter) Prune() {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets of the limiter.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+)
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterAllow(t *testing.T) {
+	l, now := newTestLimiter()
+	limit := types.RateLimit{Rate: 2, Burst: 3}
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", limit); !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("a", limit)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected the request to be limited for 500ms got %t %s", ok, wait)
+	}
+	if ok, _ := l.Allow("b", limit); !ok {
+		t.Fatal("expected the buckets of other keys to be independent")
+	}
+	*now = now.Add(wait)
+	if ok, _ := l.Allow("a", limit); !ok {
+		t.Fatal("expected a refilled token to be allowed")
+	}
+	if ok, _ := l.Allow("a", limit); ok {
+		t.Fatal("expected a single token to be refilled")
+	}
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.Allow("a", limit)
+	}
+	if ok, _ := l.Allow("a", limit); ok {
+		t.Fatal("expected the bucket to refill up to its burst")
+	}
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	l, _ := newTestLimiter()
+	if ok, wait := l.Allow("a", types.RateLimit{}); !ok || wait != 0 {
+		t.Fatal("expected a zero rate to be unlimited")
+	}
+	if l.Len() != 0 {
+		t.Fatal("expected no bucket for an unlimited rate")
+	}
+	limit := types.RateLimit{Rate: 0.5}
+	if ok, _ := l.Allow("a", limit); !ok {
+		t.Fatal("expected a burst of at least 1")
+	}
+	if ok, wait := l.Allow("a", limit); ok || wait != 2*time.Second {
+		t.Fatalf("expected the request to be limited for 2s got %t %s", ok, wait)
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l, now := newTestLimiter()
+	limit := types.RateLimit{Rate: 1, Burst: 2}
+	l.Allow("a", limit)
+	l.Allow("b", limit)
+	*now = now.Add(time.Second)
+	l.Allow("b", limit)
+	l.Prune()
+	if l.Len() != 1 {
+		t.Fatalf("expected only the bucket that is not full to be kept got %d", l.Len())
+	}
+	*now = now.Add(time.Second)
+	l.Prune()
+	if l.Len() != 0 {
+		t.Fatalf("expected all buckets to be pruned got %d", l.Len())
+	}
+}
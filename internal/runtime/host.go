@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// HostModule is the name of the module that holds the host functions guests
+// can import.
+const HostModule = "raptor"
+
+type responseKey struct{}
+
+// withResponse returns a context that makes the write_response host function
+// write the responses of the guest to w.
+func withResponse(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, responseKey{}, w)
+}
+
+// instantiateHostModule instantiates the host module in the given runtime.
+func instantiateHostModule(ctx context.Context, runtime wazero.Runtime) error {
+	_, err := runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().
+		WithFunc(writeResponse).
+		Export("write_response").
+		Instantiate(ctx)
+	return err
+}
+
+// writeResponse is the write_response host function. The guest passes a
+// serialized proto.HTTPResponse that is written length-delimited to the
+// response writer of the invocation, keeping stdout free for logging.
+func writeResponse(ctx context.Context, mod api.Module, ptr, size uint32) {
+	w, ok := ctx.Value(responseKey{}).(io.Writer)
+	if !ok {
+		return
+	}
+	b, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		slog.Warn("guest response out of memory range", "ptr", ptr, "size", size)
+		return
+	}
+	buf := protowire.AppendVarint(make([]byte, 0, len(b)+binary.MaxVarintLen32), uint64(size))
+	if _, err := w.Write(append(buf, b...)); err != nil {
+		slog.Warn("failed to write guest response", "err", err)
+	}
+}
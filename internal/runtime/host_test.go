@@ -0,0 +1,42 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// responseWasm is a module that calls the write_response host function with
+// the 2 bytes "hi" of its memory.
+var responseWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x09, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x00, 0x60, 0x00, 0x00, // type section: func(i32, i32) and func()
+	0x02, 0x19, 0x01, 0x06, 'r', 'a', 'p', 't', 'o', 'r', // import section: raptor
+	0x0e, 'w', 'r', 'i', 't', 'e', '_', 'r', 'e', 's', 'p', 'o', 'n', 's', 'e', 0x00, 0x00, // write_response
+	0x03, 0x02, 0x01, 0x01, // function section
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory section: 1 page
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x01, // export _start
+	0x0a, 0x0a, 0x01, 0x08, 0x00, 0x41, 0x00, 0x41, 0x02, 0x10, 0x00, 0x0b, // code section: write_response(0, 2)
+	0x0b, 0x08, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x02, 'h', 'i', // data section: "hi" at 0
+}
+
+func TestInvokeWriteResponse(t *testing.T) {
+	var out, response bytes.Buffer
+	err := Invoke(context.Background(), InvokeArgs{
+		Blob:     responseWasm,
+		Cache:    wazero.NewCompilationCache(),
+		Out:      &out,
+		Response: &response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response.Bytes(), []byte{0x02, 'h', 'i'}) {
+		t.Fatalf("expected a length-delimited response got %q", response.Bytes())
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected stdout to be empty got %q", out.String())
+	}
+}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+var (
+	// ErrTimeout is returned when an invocation runs longer than its timeout.
+	ErrTimeout = errors.New("invocation exceeded its timeout")
+	// ErrMaxCalls is returned when an invocation makes more guest function
+	// calls than its call limit allows.
+	ErrMaxCalls = errors.New("invocation exceeded its function call limit")
+	// ErrMemoryLimit is returned when an invocation fails after its memory
+	// grew up to the memory limit.
+	ErrMemoryLimit = errors.New("invocation exceeded its memory limit")
+)
+
+// memoryLimitHeadroom is the number of pages below the memory limit at which
+// a failed invocation is considered to have run out of memory. Guests grow
+// their memory in chunks (the Go runtime in arenas of 64 pages), so the last
+// growth fails before the memory reaches the limit exactly.
+const memoryLimitHeadroom = 64
+
+const pageSize = 65536
+
+type callsKey struct{}
+
+// calls is the remaining number of guest function calls of a single
+// invocation.
+type calls struct {
+	remaining uint64
+}
+
+// withMaxCalls returns a context that limits the invocations of modules that
+// are compiled with the call listener to the given number of function calls.
+func withMaxCalls(ctx context.Context, n uint64) context.Context {
+	return context.WithValue(ctx, callsKey{}, &calls{remaining: n})
+}
+
+// withCallListener returns a context that compiles modules with the call
+// listener attached to all of their functions.
+func withCallListener(ctx context.Context) context.Context {
+	factory := experimental.FunctionListenerFactoryFunc(func(def api.FunctionDefinition) experimental.FunctionListener {
+		if def.GoFunction() != nil {
+			return nil
+		}
+		return callListener{}
+	})
+	return context.WithValue(ctx, experimental.FunctionListenerFactoryKey{}, factory)
+}
+
+// callListener counts the guest function calls of the invocation and aborts
+// it once it makes more calls than its limit. Instructions are not counted, a
+// loop without calls is only stopped by the timeout.
+type callListener struct{}
+
+func (callListener) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	c, ok := ctx.Value(callsKey{}).(*calls)
+	if !ok {
+		return
+	}
+	if c.remaining == 0 {
+		panic(ErrMaxCalls)
+	}
+	c.remaining--
+}
+
+func (callListener) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (callListener) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+// ErrorStatus returns the HTTP status code and message of the response to an
+// invocation that failed with the given error.
+func ErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrTimeout):
+		return http.StatusGatewayTimeout, ErrTimeout.Error()
+	case errors.Is(err, ErrMaxCalls):
+		return http.StatusGatewayTimeout, ErrMaxCalls.Error()
+	case errors.Is(err, ErrMemoryLimit):
+		return http.StatusInsufficientStorage, ErrMemoryLimit.Error()
+	}
+	return http.StatusInternalServerError, "internal server error"
+}
+
+// limitError returns an error wrapping the limit that made the invocation of
+// the given module fail, or err itself when no limit was exceeded.
+func limitError(err error, mod api.Module, limits types.Limits) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w (%s): %v", ErrTimeout, limits.Timeout, err)
+	case errors.Is(err, ErrMaxCalls):
+		return err
+	case reachedMemoryLimit(mod, limits.MaxMemoryPages):
+		return fmt.Errorf("%w (%d pages): %v", ErrMemoryLimit, limits.MaxMemoryPages, err)
+	}
+	return err
+}
+
+func reachedMemoryLimit(mod api.Module, limit uint32) bool {
+	if limit == 0 || mod == nil || mod.Memory() == nil {
+		return false
+	}
+	pages := mod.Memory().Size() / pageSize
+	return pages+min(memoryLimitHeadroom, limit/4) >= limit
+}
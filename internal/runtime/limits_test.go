@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+)
+
+// growWasm is a module that grows its memory one page at a time until growing
+// fails and then traps.
+var growWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory section: 1 page
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export _start
+	0x0a, 0x14, 0x01, 0x12, 0x00, // code section
+	0x03, 0x40, // loop
+	0x41, 0x01, 0x40, 0x00, // memory.grow 1
+	0x41, 0x7f, 0x46, 0x04, 0x40, 0x00, 0x0b, // if the result is -1: unreachable
+	0x0c, 0x00, 0x0b, 0x0b, // br 0
+}
+
+// loopWasm is a module that loops forever without calling any function.
+var loopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export _start
+	0x0a, 0x09, 0x01, 0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, // code section: loop br 0
+}
+
+// callLoopWasm is a module that calls an empty function in an endless loop.
+var callLoopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x03, 0x02, 0x00, 0x00, // function section: 2 functions
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export _start
+	0x0a, 0x0e, 0x02, // code section
+	0x09, 0x00, 0x03, 0x40, 0x10, 0x01, 0x0c, 0x00, 0x0b, 0x0b, // loop call 1 br 0
+	0x02, 0x00, 0x0b, // empty function
+}
+
+func TestInvokeMemoryLimit(t *testing.T) {
+	err := Invoke(context.Background(), InvokeArgs{
+		Blob:   growWasm,
+		Cache:  wazero.NewCompilationCache(),
+		Limits: types.Limits{MaxMemoryPages: 10},
+	})
+	if !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("expected memory limit error got %v", err)
+	}
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	start := time.Now()
+	err := Invoke(context.Background(), InvokeArgs{
+		Blob:   loopWasm,
+		Cache:  wazero.NewCompilationCache(),
+		Limits: types.Limits{Timeout: time.Millisecond * 50},
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected timeout error got %v", err)
+	}
+	if time.Since(start) > time.Second*5 {
+		t.Fatalf("expected the invocation to be stopped after its timeout")
+	}
+}
+
+func TestInvokeMaxCalls(t *testing.T) {
+	err := Invoke(context.Background(), InvokeArgs{
+		Blob:   callLoopWasm,
+		Cache:  wazero.NewCompilationCache(),
+		Limits: types.Limits{MaxCalls: 1000, Timeout: time.Second * 5},
+	})
+	if !errors.Is(err, ErrMaxCalls) {
+		t.Fatalf("expected call limit error got %v", err)
+	}
+}
+
+func TestPoolRecreatesRuntimesWithNewLimits(t *testing.T) {
+	p := NewPool(PoolConfig{MaxSize: 4, IdleTimeout: time.Minute})
+	defer p.Close()
+
+	var (
+		key  = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New()}
+		args = newTestArgs()
+	)
+	args.Limits.MaxMemoryPages = 10
+	if err := p.Invoke(context.Background(), key, args); err != nil {
+		t.Fatal(err)
+	}
+	args.Limits.Timeout = time.Second
+	if err := p.Invoke(context.Background(), key, args); err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	limits := p.pools[key.DeploymentID].args.Limits
+	p.mu.Unlock()
+	if limits != args.Limits {
+		t.Fatalf("expected pool limits %+v got %+v", args.Limits, limits)
+	}
+}
@@ -0,0 +1,330 @@
+package runtime
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PoolConfig configures the number of warm runtimes that are kept for each
+// deployment.
+type PoolConfig struct {
+	// MinSize is the number of warm runtimes that are kept for the LIVE
+	// deployment of each endpoint, even when they are idle.
+	MinSize int
+	// MaxSize is the maximum number of runtimes of a single deployment.
+	// Invocations wait for a runtime to be released when all of them are
+	// in use.
+	MaxSize int
+	// IdleTimeout is the duration after which idle runtimes are evicted.
+	IdleTimeout time.Duration
+	// IsActive reports whether the deployment of a LIVE pool is still the
+	// active deployment of its endpoint. The LIVE pools of deployments that
+	// are not active anymore, like the ones of deleted endpoints, are
+	// released every ActiveInterval. When nil, LIVE pools are only released
+	// when another deployment of the endpoint is invoked.
+	IsActive func(PoolKey) bool
+	// ActiveInterval is the interval at which the LIVE pools are checked
+	// with IsActive.
+	ActiveInterval time.Duration
+	// OnRelease is called with the key of each LIVE pool that is released
+	// because its deployment is not active anymore.
+	OnRelease func(PoolKey)
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MinSize:        1,
+		MaxSize:        16,
+		IdleTimeout:    time.Minute * 5,
+		ActiveInterval: time.Second * 10,
+	}
+}
+
+// PoolKey identifies the runtimes of a single deployment.
+type PoolKey struct {
+	EndpointID   uuid.UUID
+	DeploymentID uuid.UUID
+	// Live is true when the deployment is invoked as the active deployment
+	// of its endpoint. Invoking a new live deployment of an endpoint
+	// invalidates the runtimes of the previous one.
+	Live bool
+}
+
+// Pool keeps compiled modules and warm runtimes per deployment so they can
+// be reused across invocations.
+type Pool struct {
+	config PoolConfig
+
+	mu    sync.Mutex
+	pools map[uuid.UUID]*deploymentPool
+	// live maps each endpoint to the deployment that is invoked LIVE.
+	live map[uuid.UUID]uuid.UUID
+
+	quit chan struct{}
+	once sync.Once
+}
+
+type deploymentPool struct {
+	key    PoolKey
+	args   InvokeArgs
+	sem    chan struct{}
+	idle   []*instance
+	size   int
+	closed bool
+}
+
+// NewPool returns a new Pool and starts evicting idle runtimes in the
+// background. Zero values of the given config are replaced by the ones of
+// DefaultPoolConfig.
+func NewPool(config PoolConfig) *Pool {
+	defaults := DefaultPoolConfig()
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaults.MaxSize
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.ActiveInterval <= 0 {
+		config.ActiveInterval = defaults.ActiveInterval
+	}
+	config.MinSize = min(max(config.MinSize, 0), config.MaxSize)
+
+	p := &Pool{
+		config: config,
+		pools:  make(map[uuid.UUID]*deploymentPool),
+		live:   make(map[uuid.UUID]uuid.UUID),
+		quit:   make(chan struct{}),
+	}
+	go p.evictLoop()
+	return p
+}
+
+// Invoke runs the given args on a warm runtime of the deployment of the
+// given key, creating one when none is available.
+func (p *Pool) Invoke(ctx context.Context, key PoolKey, args InvokeArgs) error {
+	dp, created := p.getPool(key, args)
+	if created && key.Live {
+		go p.warm(dp)
+	}
+
+	select {
+	case dp.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-dp.sem }()
+
+	inst, err := p.acquire(ctx, dp)
+	if err != nil {
+		return err
+	}
+	err = inst.invoke(ctx, args)
+	p.release(dp, inst, err == nil)
+	return err
+}
+
+// Invalidate closes all runtimes of the given deployment. Runtimes that are
+// in use are closed as soon as their invocation is done.
+func (p *Pool) Invalidate(deployID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invalidate(deployID)
+}
+
+// Close closes all runtimes and stops the eviction of idle runtimes.
+func (p *Pool) Close() {
+	p.once.Do(func() { close(p.quit) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.pools {
+		p.invalidate(id)
+	}
+}
+
+func (p *Pool) getPool(key PoolKey, args InvokeArgs) (*deploymentPool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The limits are part of the config of the runtimes, so runtimes that were
+	// created with other limits can not be reused.
+	if dp, ok := p.pools[key.DeploymentID]; ok && dp.args.Limits != args.Limits {
+		p.invalidate(key.DeploymentID)
+	}
+	if key.Live {
+		if current, ok := p.live[key.EndpointID]; ok && current != key.DeploymentID {
+			p.invalidate(current)
+		}
+		p.live[key.EndpointID] = key.DeploymentID
+	}
+	if dp, ok := p.pools[key.DeploymentID]; ok {
+		if key.Live {
+			dp.key.Live = true
+		}
+		return dp, false
+	}
+	// The per request fields are not needed to create new runtimes.
+	args.In, args.Out, args.Err, args.Response, args.Env = nil, nil, nil, nil, nil
+	dp := &deploymentPool{
+		key:  key,
+		args: args,
+		sem:  make(chan struct{}, p.config.MaxSize),
+	}
+	p.pools[key.DeploymentID] = dp
+	return dp, true
+}
+
+func (p *Pool) acquire(ctx context.Context, dp *deploymentPool) (*instance, error) {
+	p.mu.Lock()
+	if n := len(dp.idle); n > 0 {
+		inst := dp.idle[n-1]
+		dp.idle = dp.idle[:n-1]
+		p.mu.Unlock()
+		return inst, nil
+	}
+	dp.size++
+	p.mu.Unlock()
+
+	inst, err := newInstance(ctx, dp.args)
+	if err != nil {
+		p.mu.Lock()
+		dp.size--
+		p.mu.Unlock()
+		return nil, err
+	}
+	return inst, nil
+}
+
+// release puts the given runtime back in the pool, unless the pool got
+// invalidated or the invocation failed, in which case the runtime can not be
+// trusted anymore and is closed.
+func (p *Pool) release(dp *deploymentPool, inst *instance, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if dp.closed || !healthy {
+		dp.size--
+		go inst.close(context.Background())
+		return
+	}
+	dp.idle = append(dp.idle, inst)
+}
+
+// warm creates runtimes for the given deployment until the pool holds at
+// least MinSize runtimes.
+func (p *Pool) warm(dp *deploymentPool) {
+	for {
+		p.mu.Lock()
+		if dp.closed || dp.size >= p.config.MinSize {
+			p.mu.Unlock()
+			return
+		}
+		dp.size++
+		p.mu.Unlock()
+
+		inst, err := newInstance(context.Background(), dp.args)
+		if err != nil {
+			slog.Warn("failed to warm runtime", "err", err, "deploy", dp.key.DeploymentID)
+			p.mu.Lock()
+			dp.size--
+			p.mu.Unlock()
+			return
+		}
+		p.release(dp, inst, true)
+	}
+}
+
+// invalidate needs to be called with the lock held.
+func (p *Pool) invalidate(deployID uuid.UUID) {
+	dp, ok := p.pools[deployID]
+	if !ok {
+		return
+	}
+	delete(p.pools, deployID)
+	if p.live[dp.key.EndpointID] == deployID {
+		delete(p.live, dp.key.EndpointID)
+	}
+	dp.closed = true
+	for _, inst := range dp.idle {
+		dp.size--
+		go inst.close(context.Background())
+	}
+	dp.idle = nil
+}
+
+func (p *Pool) evictLoop() {
+	ticker := time.NewTicker(max(p.config.IdleTimeout/2, time.Second))
+	defer ticker.Stop()
+	activeTicker := time.NewTicker(p.config.ActiveInterval)
+	defer activeTicker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.evict(time.Now())
+		case <-activeTicker.C:
+			p.releaseInactive()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// evict closes the runtimes that have been idle for longer than the idle
+// timeout. The runtimes of LIVE deployments are kept until only MinSize
+// runtimes are left, while other deployments are dropped completely once all
+// their runtimes are evicted.
+func (p *Pool) evict(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, dp := range p.pools {
+		// Idle runtimes are appended on release, so the least recently used
+		// runtimes are in the front.
+		var keep []*instance
+		for i, inst := range dp.idle {
+			expired := now.Sub(inst.lastUsed) > p.config.IdleTimeout
+			if expired && (!dp.key.Live || dp.size > p.config.MinSize) {
+				dp.size--
+				go inst.close(context.Background())
+				continue
+			}
+			keep = append(keep, dp.idle[i:]...)
+			break
+		}
+		dp.idle = keep
+		if dp.size == 0 && !dp.key.Live {
+			delete(p.pools, id)
+		}
+	}
+}
+
+// releaseInactive invalidates the LIVE pools of the deployments that are not
+// the active deployment of their endpoint anymore. The lock is not held
+// while asking IsActive, which may hit the store.
+func (p *Pool) releaseInactive() {
+	if p.config.IsActive == nil {
+		return
+	}
+	p.mu.Lock()
+	keys := make([]PoolKey, 0, len(p.live))
+	for endpointID, deployID := range p.live {
+		keys = append(keys, PoolKey{EndpointID: endpointID, DeploymentID: deployID, Live: true})
+	}
+	p.mu.Unlock()
+
+	for _, key := range keys {
+		if p.config.IsActive(key) {
+			continue
+		}
+		p.mu.Lock()
+		released := p.live[key.EndpointID] == key.DeploymentID
+		if released {
+			p.invalidate(key.DeploymentID)
+		}
+		p.mu.Unlock()
+		if released && p.config.OnRelease != nil {
+			p.config.OnRelease(key)
+		}
+	}
+}
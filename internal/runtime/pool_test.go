@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+)
+
+// noopWasm is a module that exports an empty _start function.
+var noopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type section: func() -> ()
+	0x03, 0x02, 0x01, 0x00, // function section
+	0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x00, // export _start
+	0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b, // code section
+}
+
+func newTestArgs() InvokeArgs {
+	return InvokeArgs{
+		Blob:  noopWasm,
+		Cache: wazero.NewCompilationCache(),
+	}
+}
+
+func poolSize(p *Pool, deployID uuid.UUID) (size, idle int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dp, ok := p.pools[deployID]
+	if !ok {
+		return 0, 0, false
+	}
+	return dp.size, len(dp.idle), true
+}
+
+func TestPoolReusesRuntimes(t *testing.T) {
+	p := NewPool(PoolConfig{MinSize: 0, MaxSize: 4, IdleTimeout: time.Minute})
+	defer p.Close()
+
+	key := PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New()}
+	for i := 0; i < 3; i++ {
+		if err := p.Invoke(context.Background(), key, newTestArgs()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, idle, _ := poolSize(p, key.DeploymentID)
+	if size != 1 || idle != 1 {
+		t.Fatalf("expected a single reused runtime got size %d idle %d", size, idle)
+	}
+}
+
+func TestPoolMaxSize(t *testing.T) {
+	p := NewPool(PoolConfig{MaxSize: 2, IdleTimeout: time.Minute})
+	defer p.Close()
+
+	var (
+		key = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New()}
+		wg  sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Invoke(context.Background(), key, newTestArgs()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	size, _, _ := poolSize(p, key.DeploymentID)
+	if size > 2 {
+		t.Fatalf("expected at most 2 runtimes got %d", size)
+	}
+}
+
+func TestPoolInvalidatesPreviousLiveDeployment(t *testing.T) {
+	p := NewPool(PoolConfig{MinSize: 1, MaxSize: 4, IdleTimeout: time.Minute})
+	defer p.Close()
+
+	var (
+		endpointID = uuid.New()
+		first      = PoolKey{EndpointID: endpointID, DeploymentID: uuid.New(), Live: true}
+		second     = PoolKey{EndpointID: endpointID, DeploymentID: uuid.New(), Live: true}
+	)
+	if err := p.Invoke(context.Background(), first, newTestArgs()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := poolSize(p, first.DeploymentID); !ok {
+		t.Fatal("expected runtimes of the first deployment to be pooled")
+	}
+	if err := p.Invoke(context.Background(), second, newTestArgs()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := poolSize(p, first.DeploymentID); ok {
+		t.Fatal("expected runtimes of the first deployment to be invalidated")
+	}
+	if _, _, ok := poolSize(p, second.DeploymentID); !ok {
+		t.Fatal("expected runtimes of the second deployment to be pooled")
+	}
+}
+
+func TestPoolEvictsIdleRuntimes(t *testing.T) {
+	p := NewPool(PoolConfig{MinSize: 1, MaxSize: 4, IdleTimeout: time.Minute})
+	defer p.Close()
+
+	var (
+		live    = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New(), Live: true}
+		preview = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New()}
+	)
+	for _, key := range []PoolKey{live, preview} {
+		if err := p.Invoke(context.Background(), key, newTestArgs()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.evict(time.Now().Add(2 * time.Minute))
+	if size, _, ok := poolSize(p, live.DeploymentID); !ok || size != 1 {
+		t.Fatalf("expected the live deployment to keep its warm runtime got size %d", size)
+	}
+	if _, _, ok := poolSize(p, preview.DeploymentID); ok {
+		t.Fatal("expected the idle preview deployment to be evicted")
+	}
+}
+
+func TestPoolReleasesInactiveLiveDeployments(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		active   = make(map[uuid.UUID]uuid.UUID)
+		released []PoolKey
+	)
+	p := NewPool(PoolConfig{
+		MinSize:        1,
+		MaxSize:        4,
+		IdleTimeout:    time.Minute,
+		ActiveInterval: time.Hour,
+		IsActive: func(key PoolKey) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return active[key.EndpointID] == key.DeploymentID
+		},
+		OnRelease: func(key PoolKey) {
+			mu.Lock()
+			defer mu.Unlock()
+			released = append(released, key)
+		},
+	})
+	defer p.Close()
+
+	var (
+		kept     = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New(), Live: true}
+		replaced = PoolKey{EndpointID: uuid.New(), DeploymentID: uuid.New(), Live: true}
+	)
+	mu.Lock()
+	active[kept.EndpointID] = kept.DeploymentID
+	active[replaced.EndpointID] = replaced.DeploymentID
+	mu.Unlock()
+	for _, key := range []PoolKey{kept, replaced} {
+		if err := p.Invoke(context.Background(), key, newTestArgs()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	active[replaced.EndpointID] = uuid.New()
+	mu.Unlock()
+	p.releaseInactive()
+	if _, _, ok := poolSize(p, kept.DeploymentID); !ok {
+		t.Fatal("expected the active live deployment to be kept")
+	}
+	if _, _, ok := poolSize(p, replaced.DeploymentID); ok {
+		t.Fatal("expected the replaced live deployment to be released")
+	}
+	if len(released) != 1 || released[0] != replaced {
+		t.Fatalf("expected the release of %+v got %+v", replaced, released)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/anthdm/raptor/internal/types"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 )
@@ -16,48 +17,125 @@ type InvokeArgs struct {
 	Blob  []byte
 	Cache wazero.CompilationCache
 	Out   io.Writer
-	In    io.Reader
-	Env   map[string]string
-	Debug bool
-	Args  []string
+	// Err receives the stderr of the guest, os.Stderr when nil.
+	Err io.Writer
+	In  io.Reader
+	// Response receives the length-delimited responses the guest writes
+	// with the write_response host function.
+	Response io.Writer
+	Env      map[string]string
+	Debug    bool
+	Args     []string
+	// Limits restricts the resources of each invocation, zero values mean
+	// unlimited.
+	Limits types.Limits
 }
 
+// Invoke compiles and runs the given blob in a new runtime that is closed
+// right after. Use a Pool to reuse compiled modules across invocations.
 func Invoke(ctx context.Context, args InvokeArgs) error {
+	inst, err := newInstance(ctx, args)
+	if err != nil {
+		return err
+	}
+	defer inst.close(ctx)
+	return inst.invoke(ctx, args)
+}
+
+// instance is a wazero runtime with WASI instantiated and the module of a
+// deployment compiled, ready to be invoked any number of times, one
+// invocation at a time.
+type instance struct {
+	runtime  wazero.Runtime
+	module   wazero.CompiledModule
+	lastUsed time.Time
+}
+
+func newInstance(ctx context.Context, args InvokeArgs) (*instance, error) {
 	start := time.Now()
 	// only arm64
 	// config := opt.NewRuntimeConfigOptimizingCompiler().WithCompilationCache(args.Cache)
-	config := wazero.NewRuntimeConfigCompiler().WithCompilationCache(args.Cache)
+	config := wazero.NewRuntimeConfigCompiler().
+		WithCompilationCache(args.Cache).
+		WithCloseOnContextDone(true)
+	if args.Limits.MaxMemoryPages > 0 {
+		config = config.WithMemoryLimitPages(args.Limits.MaxMemoryPages)
+	}
 	runtime := wazero.NewRuntimeWithConfig(ctx, config)
-	defer runtime.Close(ctx)
 
 	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	if err := instantiateHostModule(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
 	if args.Debug {
 		fmt.Println("runtime new: ", time.Since(start))
 	}
 
 	start = time.Now()
-	mod, err := runtime.CompileModule(ctx, args.Blob)
+	compileCtx := ctx
+	if args.Limits.MaxCalls > 0 {
+		compileCtx = withCallListener(ctx)
+	}
+	mod, err := runtime.CompileModule(compileCtx, args.Blob)
 	if err != nil {
 		slog.Warn("compiling module failed", "err", err)
-		return err
+		runtime.Close(ctx)
+		return nil, err
 	}
 	if args.Debug {
 		fmt.Println("runtime compile module: ", time.Since(start))
 	}
+	return &instance{
+		runtime:  runtime,
+		module:   mod,
+		lastUsed: time.Now(),
+	}, nil
+}
 
-	start = time.Now()
+// invoke instantiates the compiled module with the input, output,
+// environment and arguments of the given args and runs it to completion or
+// until one of its limits is exceeded.
+func (i *instance) invoke(ctx context.Context, args InvokeArgs) error {
+	start := time.Now()
+	stderr := args.Err
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	if args.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.Limits.Timeout)
+		defer cancel()
+	}
+	if args.Limits.MaxCalls > 0 {
+		ctx = withMaxCalls(ctx, args.Limits.MaxCalls)
+	}
+	if args.Response != nil {
+		ctx = withResponse(ctx, args.Response)
+	}
 	modConf := wazero.NewModuleConfig().
+		WithName("").
 		WithStdin(args.In).
 		WithStdout(args.Out).
-		WithStderr(os.Stderr).
+		WithStderr(stderr).
 		WithArgs(args.Args...)
 	for k, v := range args.Env {
 		modConf = modConf.WithEnv(k, v)
 	}
-	_, err = runtime.InstantiateModule(ctx, mod, modConf)
+	mod, err := i.runtime.InstantiateModule(ctx, i.module, modConf)
+	if err != nil {
+		err = limitError(err, mod, args.Limits)
+	}
+	if mod != nil {
+		mod.Close(context.Background())
+	}
 	if args.Debug {
 		fmt.Println("runtime instantiate: ", time.Since(start))
 	}
-
+	i.lastUsed = time.Now()
 	return err
 }
+
+func (i *instance) close(ctx context.Context) {
+	i.runtime.Close(ctx)
+}
@@ -0,0 +1,163 @@
+// Package secrets encrypts the values of endpoint secrets with AES-256-GCM.
+//
+// Every value is encrypted with the current master key and is prefixed with
+// the id of that key, so values that were encrypted with a previous master
+// key can still be decrypted until they are re-encrypted with the current
+// one.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/anthdm/raptor/internal/config"
+	"github.com/anthdm/raptor/internal/types"
+)
+
+const (
+	keySize   = 32
+	keyIDSize = 8
+)
+
+// ErrNotConfigured is returned when secrets are used without a master key.
+var ErrNotConfigured = errors.New("secrets are not configured, set secrets.masterKey in the config")
+
+// Keyring encrypts with the current master key and decrypts with the current
+// or any of the previous master keys.
+type Keyring struct {
+	current []byte
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring for the given base64 encoded 32 byte master
+// keys. The previous keys are only used to decrypt.
+func NewKeyring(current string, previous ...string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for i, encoded := range append([]string{current}, previous...) {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key: %w", err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("invalid master key: expected %d bytes got %d", keySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := keyID(key)
+		if i == 0 {
+			k.current = id
+		}
+		k.keys[string(id)] = aead
+	}
+	return k, nil
+}
+
+// NewKeyringFromConfig returns the keyring of the given config, or nil when
+// no master key is configured.
+func NewKeyringFromConfig(cfg config.Secrets) (*Keyring, error) {
+	if cfg.MasterKey == "" {
+		return nil, nil
+	}
+	return NewKeyring(cfg.MasterKey, cfg.PreviousMasterKeys...)
+}
+
+// GenerateKey returns a new random base64 encoded master key.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt encrypts the plaintext with the current master key. The additional
+// data is authenticated but not encrypted, it binds the ciphertext to its
+// owner so it can not be decrypted as the value of another secret.
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	aead := k.keys[string(k.current)]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, keyIDSize+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, k.current...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts a ciphertext of Encrypt with the master key it was
+// encrypted with.
+func (k *Keyring) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < keyIDSize {
+		return nil, errors.New("invalid ciphertext")
+	}
+	aead, ok := k.keys[string(ciphertext[:keyIDSize])]
+	if !ok {
+		return nil, errors.New("ciphertext was encrypted with an unknown master key")
+	}
+	ciphertext = ciphertext[keyIDSize:]
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("invalid ciphertext")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// NeedsRotation returns true when the ciphertext was not encrypted with the
+// current master key.
+func (k *Keyring) NeedsRotation(ciphertext []byte) bool {
+	return len(ciphertext) < keyIDSize || string(ciphertext[:keyIDSize]) != string(k.current)
+}
+
+// Seal encrypts the given value as the value of the secret.
+func (k *Keyring) Seal(secret *types.Secret, value string) error {
+	b, err := k.Encrypt([]byte(value), additionalData(secret))
+	if err != nil {
+		return err
+	}
+	secret.Value = b
+	return nil
+}
+
+// Open returns the decrypted value of the secret.
+func (k *Keyring) Open(secret *types.Secret) (string, error) {
+	b, err := k.Decrypt(secret.Value, additionalData(secret))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret %s: %w", secret.Name, err)
+	}
+	return string(b), nil
+}
+
+// Rotate re-encrypts the value of the secret with the current master key and
+// returns false when it already was encrypted with it.
+func (k *Keyring) Rotate(secret *types.Secret) (bool, error) {
+	if !k.NeedsRotation(secret.Value) {
+		return false, nil
+	}
+	value, err := k.Open(secret)
+	if err != nil {
+		return false, err
+	}
+	return true, k.Seal(secret, value)
+}
+
+// additionalData binds the value of a secret to its endpoint and name.
+func additionalData(secret *types.Secret) []byte {
+	return []byte(secret.EndpointID.String() + "/" + secret.Name)
+}
+
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyIDSize]
+}
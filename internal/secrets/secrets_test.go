@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := NewKeyring(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &types.Secret{EndpointID: uuid.New(), Name: "API_KEY"}
+	if err := k.Seal(secret, "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value) == "s3cr3t" {
+		t.Fatal("expected the value to be encrypted")
+	}
+	value, err := k.Open(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "s3cr3t" {
+		t.Fatalf("expected value %s got %s", "s3cr3t", value)
+	}
+
+	// The value can not be decrypted as the value of another secret.
+	other := &types.Secret{EndpointID: uuid.New(), Name: "API_KEY", Value: secret.Value}
+	if _, err := k.Open(other); err == nil {
+		t.Fatal("expected error when opening the value of another secret")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	old, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &types.Secret{EndpointID: uuid.New(), Name: "API_KEY"}
+	if err := old.Seal(secret, "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := NewKeyring(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := k.Rotate(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotated {
+		t.Fatal("expected the secret to be rotated")
+	}
+	if rotated, _ := k.Rotate(secret); rotated {
+		t.Fatal("expected the secret to be rotated only once")
+	}
+
+	current, err := NewKeyring(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := current.Open(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "s3cr3t" {
+		t.Fatalf("expected value %s got %s", "s3cr3t", value)
+	}
+	if _, err := old.Open(secret); err == nil {
+		t.Fatal("expected error when opening with a removed master key")
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	if _, err := NewKeyring("c2hvcnQ="); err == nil {
+		t.Fatal("expected error for a short master key")
+	}
+	if _, err := NewKeyring("not base64!"); err == nil {
+		t.Fatal("expected error for an invalid master key")
+	}
+}
@@ -1,6 +1,9 @@
 package shared
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,8 +12,70 @@ import (
 	"strings"
 
 	"github.com/anthdm/raptor/proto"
+	"google.golang.org/protobuf/encoding/protodelim"
 )
 
+// HeaderLinePrefix prefixes the lines guests print on stdout to set a response
+// header with the line protocol, e.g. "raptor-header: Content-Type: text/html".
+const HeaderLinePrefix = "raptor-header: "
+
+// hopByHopHeaders are only meaningful for a single connection and are never
+// forwarded from the response of a guest.
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+}
+
+// ParseRuntimeResponse parses the response of an invocation. Guests that use
+// the SDK write length-delimited proto.HTTPResponse messages with the
+// write_response host function, in which case the last one is the response.
+// Other guests print the response on stdout, which is parsed with the line
+// protocol of ParseRuntimeHTTPResponse after the header lines are taken out.
+// The returned logs are the part of stdout that is not the response.
+func ParseRuntimeResponse(structured []byte, stdout string) (resp *proto.HTTPResponse, logs string, err error) {
+	if len(structured) == 0 {
+		header, stdout := parseHeaderLines(stdout)
+		res, status, err := ParseRuntimeHTTPResponse(stdout)
+		if err != nil {
+			return nil, "", err
+		}
+		// Everything printed before the response lines is logged.
+		lines := strings.Split(stdout, "\n")
+		logs = strings.Join(lines[:len(lines)-3], "\n")
+		return &proto.HTTPResponse{
+			Response:   []byte(res),
+			StatusCode: int32(status),
+			Header:     header,
+		}, logs, nil
+	}
+	r := bufio.NewReader(bytes.NewReader(structured))
+	for {
+		msg := &proto.HTTPResponse{}
+		err := protodelim.UnmarshalFrom(r, msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid response: %w", err)
+		}
+		resp = msg
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	return resp, stdout, nil
+}
+
+// ParseRuntimeHTTPResponse parses the line protocol where the body and the
+// status code are the last 2 lines printed on stdout.
 func ParseRuntimeHTTPResponse(in string) (resp string, status int, err error) {
 	lines := strings.Split(in, "\n")
 	if len(lines) < 3 {
@@ -22,6 +87,59 @@ func ParseRuntimeHTTPResponse(in string) (resp string, status int, err error) {
 	return
 }
 
+// parseHeaderLines returns the headers of the lines that start with
+// HeaderLinePrefix and the input without those lines.
+func parseHeaderLines(in string) (map[string]*proto.HeaderFields, string) {
+	var (
+		header = make(map[string]*proto.HeaderFields)
+		lines  = strings.Split(in, "\n")
+		rest   = lines[:0]
+	)
+	for _, line := range lines {
+		field, ok := strings.CutPrefix(line, HeaderLinePrefix)
+		if !ok {
+			rest = append(rest, line)
+			continue
+		}
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+		if _, ok := header[key]; !ok {
+			header[key] = &proto.HeaderFields{}
+		}
+		header[key].Fields = append(header[key].Fields, strings.TrimSpace(value))
+	}
+	return header, strings.Join(rest, "\n")
+}
+
+// WriteResponseHeader adds the headers of a guest response to the given
+// header, leaving out the hop-by-hop headers and the ones named by the
+// Connection header.
+func WriteResponseHeader(dst http.Header, header map[string]*proto.HeaderFields) {
+	skip := make(map[string]bool)
+	for key, fields := range header {
+		if http.CanonicalHeaderKey(key) != "Connection" {
+			continue
+		}
+		for _, field := range fields.GetFields() {
+			for _, name := range strings.Split(field, ",") {
+				skip[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+			}
+		}
+	}
+	for key, fields := range header {
+		key = http.CanonicalHeaderKey(key)
+		if hopByHopHeaders[key] || skip[key] {
+			continue
+		}
+		for _, value := range fields.GetFields() {
+			dst.Add(key, value)
+		}
+	}
+}
+
 func MakeProtoRequest(id string, r *http.Request) (*proto.HTTPRequest, error) {
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -39,7 +157,7 @@ func MakeProtoRequest(id string, r *http.Request) (*proto.HTTPRequest, error) {
 func trimmedEndpointFromURL(url *url.URL) string {
 	path := strings.TrimPrefix(url.Path, "/")
 	pathParts := strings.Split(path, "/")
-	if len(pathParts) == 0 {
+	if len(pathParts) < 2 {
 		return "/"
 	}
 	return "/" + strings.Join(pathParts[2:], "/")
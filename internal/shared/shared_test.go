@@ -0,0 +1,84 @@
+package shared
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/anthdm/raptor/proto"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+func TestParseRuntimeResponse(t *testing.T) {
+	var structured bytes.Buffer
+	for _, msg := range []*proto.HTTPResponse{
+		{Response: []byte("first"), StatusCode: http.StatusAccepted},
+		{Response: []byte("second"), StatusCode: http.StatusCreated},
+	} {
+		if _, err := protodelim.MarshalTo(&structured, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, logs, err := ParseRuntimeResponse(structured.Bytes(), "some log line\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != "some log line\n" {
+		t.Fatalf("expected stdout to be logged got %q", logs)
+	}
+	if string(resp.Response) != "second" || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the last response got %q %d", resp.Response, resp.StatusCode)
+	}
+
+	if _, _, err := ParseRuntimeResponse([]byte{0x05, 'a'}, ""); err == nil {
+		t.Fatal("expected an error for a truncated response")
+	}
+}
+
+func TestParseRuntimeResponseLineProtocol(t *testing.T) {
+	stdout := "some log line\n" +
+		"raptor-header: content-type: text/html\n" +
+		"raptor-header: Set-Cookie: a=1\n" +
+		"raptor-header: Set-Cookie: b=2\n" +
+		"hello\n200\n"
+	resp, logs, err := ParseRuntimeResponse(nil, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != "some log line" {
+		t.Fatalf("expected the lines before the response to be logged got %q", logs)
+	}
+	if string(resp.Response) != "hello" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %q %d", resp.Response, resp.StatusCode)
+	}
+	if fields := resp.Header["Content-Type"].GetFields(); len(fields) != 1 || fields[0] != "text/html" {
+		t.Fatalf("unexpected Content-Type header %v", fields)
+	}
+	if fields := resp.Header["Set-Cookie"].GetFields(); len(fields) != 2 {
+		t.Fatalf("expected 2 Set-Cookie headers got %v", fields)
+	}
+}
+
+func TestWriteResponseHeader(t *testing.T) {
+	header := http.Header{}
+	WriteResponseHeader(header, map[string]*proto.HeaderFields{
+		"content-type":      {Fields: []string{"application/json"}},
+		"Set-Cookie":        {Fields: []string{"a=1", "b=2"}},
+		"X-Custom":          {Fields: []string{"foo"}},
+		"Connection":        {Fields: []string{"close, X-Internal"}},
+		"X-Internal":        {Fields: []string{"secret"}},
+		"Transfer-Encoding": {Fields: []string{"chunked"}},
+		"Content-Length":    {Fields: []string{"999"}},
+	})
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Custom") != "foo" {
+		t.Fatalf("expected end-to-end headers to be written got %v", header)
+	}
+	if len(header.Values("Set-Cookie")) != 2 {
+		t.Fatalf("expected 2 Set-Cookie headers got %v", header.Values("Set-Cookie"))
+	}
+	for _, key := range []string{"Connection", "X-Internal", "Transfer-Encoding", "Content-Length"} {
+		if _, ok := header[key]; ok {
+			t.Fatalf("expected hop-by-hop header %s to be dropped", key)
+		}
+	}
+}
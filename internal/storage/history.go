@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+// buildDeploymentHistory returns the history of the given deployments, where
+// publications are all the publications of their endpoint ordered by the
+// time they were published.
+func buildDeploymentHistory(deploys []*types.Deployment, publications []*types.Publication, activeID uuid.UUID) []*types.DeploymentHistory {
+	var (
+		published   = make(map[uuid.UUID]time.Time)
+		unpublished = make(map[uuid.UUID]time.Time)
+	)
+	for i, publication := range publications {
+		published[publication.DeploymentID] = publication.PublishedAT
+		delete(unpublished, publication.DeploymentID)
+		if i+1 < len(publications) && publications[i+1].DeploymentID != publication.DeploymentID {
+			unpublished[publication.DeploymentID] = publications[i+1].PublishedAT
+		}
+	}
+
+	history := make([]*types.DeploymentHistory, len(deploys))
+	for i, deploy := range deploys {
+		h := &types.DeploymentHistory{
+			ID:        deploy.ID,
+			Hash:      deploy.Hash,
+			Active:    deploy.ID == activeID,
+			CreatedAT: deploy.CreatedAT,
+		}
+		if t, ok := published[deploy.ID]; ok {
+			h.PublishedAT = &t
+		}
+		if t, ok := unpublished[deploy.ID]; ok && !h.Active {
+			h.UnpublishedAT = &t
+		}
+		history[i] = h
+	}
+	return history
+}
+
+// paginate returns the page of n records described by p as a [start, end)
+// range.
+func paginate(n int, p Pagination) (start, end int) {
+	start = min(max(p.Offset, 0), n)
+	end = n
+	if p.Limit > 0 {
+		end = min(start+p.Limit, n)
+	}
+	return start, end
+}
@@ -0,0 +1,763 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+// memoryLogCapacity is the number of log lines the MemoryStore keeps per
+// endpoint, older lines are dropped.
+const memoryLogCapacity = 10000
+
+// MemoryStore is a concurrency safe in-memory implementation of the Store,
+// the MetricStore, the LogStore, the SecretStore, the DomainStore, the
+// AccountStore and the AuditStore interface. Nothing is persisted, hence it is
+// meant for local development and testing.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	endpoints    map[uuid.UUID]*types.Endpoint
+	deployments  map[uuid.UUID]*types.Deployment
+	publications map[uuid.UUID][]*types.Publication
+	metrics      map[uuid.UUID][]types.RuntimeMetric
+	logs         map[uuid.UUID][]types.RuntimeLog
+	logSeq       int64
+	secrets      map[uuid.UUID]map[string]*types.Secret
+	domains      map[uuid.UUID]*types.Domain
+	accounts     map[uuid.UUID]*types.Account
+	tokens       map[uuid.UUID]*types.APIToken
+	// usage holds the usage per account, keyed by the start of the month.
+	usage map[uuid.UUID]map[time.Time]types.Usage
+	// roles holds the roles per endpoint, keyed by the id of the token.
+	roles map[uuid.UUID]map[uuid.UUID]*types.EndpointRole
+	// audit holds the audit log, oldest first.
+	audit []*types.AuditEvent
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		endpoints:    make(map[uuid.UUID]*types.Endpoint),
+		deployments:  make(map[uuid.UUID]*types.Deployment),
+		publications: make(map[uuid.UUID][]*types.Publication),
+		metrics:      make(map[uuid.UUID][]types.RuntimeMetric),
+		logs:         make(map[uuid.UUID][]types.RuntimeLog),
+		secrets:      make(map[uuid.UUID]map[string]*types.Secret),
+		domains:      make(map[uuid.UUID]*types.Domain),
+		accounts:     make(map[uuid.UUID]*types.Account),
+		tokens:       make(map[uuid.UUID]*types.APIToken),
+		usage:        make(map[uuid.UUID]map[time.Time]types.Usage),
+		roles:        make(map[uuid.UUID]map[uuid.UUID]*types.EndpointRole),
+	}
+}
+
+func (s *MemoryStore) CreateEndpoint(endpoint *types.Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[endpoint.ID]; ok {
+		return fmt.Errorf("endpoint (%s) already exists", endpoint.ID)
+	}
+	if err := s.checkSlug(endpoint.ID, endpoint.Slug); err != nil {
+		return err
+	}
+	if _, ok := s.accounts[endpoint.AccountID]; endpoint.AccountID != uuid.Nil && !ok {
+		return fmt.Errorf("could not find account (%s)", endpoint.AccountID)
+	}
+	s.endpoints[endpoint.ID] = copyEndpoint(endpoint)
+	return nil
+}
+
+func (s *MemoryStore) UpdateEndpoint(id uuid.UUID, params UpdateEndpointParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	if err := s.checkSlug(id, params.Slug); err != nil {
+		return err
+	}
+	if params.ActiveDeployID != uuid.Nil {
+		if _, ok := s.deployments[params.ActiveDeployID]; !ok {
+			return fmt.Errorf("could not find deployment (%s)", params.ActiveDeployID)
+		}
+		endpoint.ActiveDeploymentID = params.ActiveDeployID
+		endpoint.TrafficSplit = nil
+		publication := types.NewPublication(id, params.ActiveDeployID)
+		s.publications[id] = append(s.publications[id], publication)
+	}
+	if params.Name != "" {
+		endpoint.Name = params.Name
+	}
+	if params.Slug != "" {
+		endpoint.Slug = params.Slug
+	}
+	if params.Environment != nil {
+		endpoint.Environment = copyEnv(params.Environment)
+	} else if params.mergesEnvironment() {
+		endpoint.Environment = params.mergeEnvironment(endpoint.Environment)
+	}
+	if params.RateLimits != nil {
+		endpoint.RateLimits = *params.RateLimits
+	}
+	if params.Concurrency != nil {
+		endpoint.Concurrency = *params.Concurrency
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetEndpoint(id uuid.UUID) (*types.Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return nil, fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	return copyEndpoint(endpoint), nil
+}
+
+func (s *MemoryStore) GetEndpointBySlug(slug string) (*types.Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, endpoint := range s.endpoints {
+		if slug != "" && endpoint.Slug == slug {
+			return copyEndpoint(endpoint), nil
+		}
+	}
+	return nil, fmt.Errorf("could not find endpoint (%s)", slug)
+}
+
+// checkSlug returns an error when the slug is used by another endpoint than
+// the given one. It expects the lock to be held.
+func (s *MemoryStore) checkSlug(id uuid.UUID, slug string) error {
+	if slug == "" {
+		return nil
+	}
+	for _, endpoint := range s.endpoints {
+		if endpoint.ID != id && endpoint.Slug == slug {
+			return fmt.Errorf("slug (%s) already exists", slug)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetEndpoints(accountID uuid.UUID) ([]types.Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoints := make([]types.Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		if accountID == uuid.Nil || endpoint.AccountID == accountID {
+			endpoints = append(endpoints, *copyEndpoint(endpoint))
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAT.Before(endpoints[j].CreatedAT)
+	})
+	return endpoints, nil
+}
+
+func (s *MemoryStore) CreateDeployment(deploy *types.Deployment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[deploy.EndpointID]; !ok {
+		return fmt.Errorf("could not find endpoint (%s)", deploy.EndpointID)
+	}
+	if _, ok := s.deployments[deploy.ID]; ok {
+		return fmt.Errorf("deployment (%s) already exists", deploy.ID)
+	}
+	d := *deploy
+	s.deployments[deploy.ID] = &d
+	return nil
+}
+
+func (s *MemoryStore) GetDeployment(id uuid.UUID) (*types.Deployment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deploy, ok := s.deployments[id]
+	if !ok {
+		return nil, fmt.Errorf("could not find deployment (%s)", id)
+	}
+	d := *deploy
+	return &d, nil
+}
+
+func (s *MemoryStore) GetDeploymentHistory(endpointID uuid.UUID, p Pagination) ([]*types.DeploymentHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoint, ok := s.endpoints[endpointID]
+	if !ok {
+		return nil, fmt.Errorf("could not find endpoint (%s)", endpointID)
+	}
+	var deploys []*types.Deployment
+	for _, deploy := range s.deployments {
+		if deploy.EndpointID == endpointID {
+			deploys = append(deploys, deploy)
+		}
+	}
+	sort.Slice(deploys, func(i, j int) bool {
+		return deploys[i].CreatedAT.After(deploys[j].CreatedAT)
+	})
+	start, end := paginate(len(deploys), p)
+	return buildDeploymentHistory(deploys[start:end], s.publications[endpointID], endpoint.ActiveDeploymentID), nil
+}
+
+func (s *MemoryStore) GetPublications(endpointID uuid.UUID) ([]*types.Publication, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	publications := make([]*types.Publication, len(s.publications[endpointID]))
+	for i, publication := range s.publications[endpointID] {
+		p := *publication
+		publications[i] = &p
+	}
+	return publications, nil
+}
+
+func (s *MemoryStore) SetTrafficSplit(id uuid.UUID, split *types.TrafficSplit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	endpoint.TrafficSplit = copyTrafficSplit(split)
+	return nil
+}
+
+func (s *MemoryStore) DeleteEndpoint(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[id]; !ok {
+		return fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	for deployID, deploy := range s.deployments {
+		if deploy.EndpointID == id {
+			delete(s.deployments, deployID)
+		}
+	}
+	delete(s.endpoints, id)
+	delete(s.publications, id)
+	delete(s.metrics, id)
+	delete(s.logs, id)
+	delete(s.secrets, id)
+	delete(s.roles, id)
+	for domainID, domain := range s.domains {
+		if domain.EndpointID == id {
+			delete(s.domains, domainID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteDeployment(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deploy, ok := s.deployments[id]
+	if !ok {
+		return fmt.Errorf("could not find deployment (%s)", id)
+	}
+	endpointID := deploy.EndpointID
+	if endpoint, ok := s.endpoints[endpointID]; ok && endpoint.ActiveDeploymentID == id {
+		endpoint.ActiveDeploymentID = uuid.Nil
+	}
+	s.publications[endpointID] = slices.DeleteFunc(s.publications[endpointID], func(p *types.Publication) bool {
+		return p.DeploymentID == id
+	})
+	s.metrics[endpointID] = slices.DeleteFunc(s.metrics[endpointID], func(m types.RuntimeMetric) bool {
+		return m.DeploymentID == id
+	})
+	s.logs[endpointID] = slices.DeleteFunc(s.logs[endpointID], func(l types.RuntimeLog) bool {
+		return l.DeploymentID == id
+	})
+	delete(s.deployments, id)
+	return nil
+}
+
+func (s *MemoryStore) CreateRuntimeMetrics(metrics []types.RuntimeMetric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, metric := range metrics {
+		s.metrics[metric.EndpointID] = append(s.metrics[metric.EndpointID], metric)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetRuntimeMetrics(id uuid.UUID, filter MetricFilter) ([]types.RuntimeMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metrics := []types.RuntimeMetric{}
+	for _, metric := range s.metrics[id] {
+		if filter.Match(metric) {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].StartTime.After(metrics[j].StartTime)
+	})
+	if filter.Limit > 0 && len(metrics) > filter.Limit {
+		metrics = metrics[:filter.Limit]
+	}
+	return metrics, nil
+}
+
+func (s *MemoryStore) GetRuntimeMetricCounts(id uuid.UUID, filter MetricFilter) (types.MetricCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var counts types.MetricCounts
+	for _, metric := range s.metrics[id] {
+		if !filter.Match(metric) {
+			continue
+		}
+		counts.Count++
+		if metric.IsError() {
+			counts.Errors++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) AddAccountUsage(accountID uuid.UUID, month time.Time, usage types.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage[accountID] == nil {
+		s.usage[accountID] = make(map[time.Time]types.Usage)
+	}
+	month = types.MonthStart(month)
+	total := s.usage[accountID][month]
+	total.Invocations += usage.Invocations
+	total.ComputeTime += usage.ComputeTime
+	s.usage[accountID][month] = total
+	return nil
+}
+
+func (s *MemoryStore) GetRuntimeMetricsSummary(id uuid.UUID, filter MetricFilter, bucket time.Duration) (*types.MetricsSummary, error) {
+	filter.Limit = 0
+	metrics, err := s.GetRuntimeMetrics(id, filter)
+	if err != nil {
+		return nil, err
+	}
+	return types.SummarizeMetrics(id, metrics, filter.From, filter.To, bucket), nil
+}
+
+func (s *MemoryStore) GetAccountUsage(accountID uuid.UUID, since time.Time) (types.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var usage types.Usage
+	for month, monthUsage := range s.usage[accountID] {
+		if !month.Before(types.MonthStart(since)) {
+			usage.Invocations += monthUsage.Invocations
+			usage.ComputeTime += monthUsage.ComputeTime
+		}
+	}
+	return usage, nil
+}
+
+func (s *MemoryStore) CreateRuntimeLogs(logs []types.RuntimeLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, log := range logs {
+		s.logSeq++
+		log.Seq = s.logSeq
+		endpointLogs := append(s.logs[log.EndpointID], log)
+		if len(endpointLogs) > memoryLogCapacity {
+			endpointLogs = endpointLogs[len(endpointLogs)-memoryLogCapacity:]
+		}
+		s.logs[log.EndpointID] = endpointLogs
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetRuntimeLogs(id uuid.UUID, filter LogFilter) ([]types.RuntimeLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	logs := []types.RuntimeLog{}
+	for _, log := range s.logs[id] {
+		if filter.Match(log) {
+			logs = append(logs, log)
+		}
+	}
+	if filter.Limit > 0 && len(logs) > filter.Limit {
+		if filter.AfterSeq > 0 {
+			logs = logs[:filter.Limit]
+		} else {
+			logs = logs[len(logs)-filter.Limit:]
+		}
+	}
+	return logs, nil
+}
+
+func (s *MemoryStore) DeleteRuntimeLogs(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, logs := range s.logs {
+		kept := logs[:0]
+		for _, log := range logs {
+			if !log.Time.Before(before) {
+				kept = append(kept, log)
+			}
+		}
+		s.logs[id] = kept
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutSecret(secret *types.Secret) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[secret.EndpointID]; !ok {
+		return fmt.Errorf("could not find endpoint (%s)", secret.EndpointID)
+	}
+	if _, ok := s.secrets[secret.EndpointID]; !ok {
+		s.secrets[secret.EndpointID] = make(map[string]*types.Secret)
+	}
+	now := time.Now().UTC()
+	stored := copySecret(secret)
+	if current, ok := s.secrets[secret.EndpointID][secret.Name]; ok {
+		stored.Version = current.Version + 1
+		stored.CreatedAT = current.CreatedAT
+	} else {
+		stored.Version = 1
+		stored.CreatedAT = now
+	}
+	stored.UpdatedAT = now
+	s.secrets[secret.EndpointID][secret.Name] = stored
+	secret.Version, secret.CreatedAT, secret.UpdatedAT = stored.Version, stored.CreatedAT, stored.UpdatedAT
+	return nil
+}
+
+func (s *MemoryStore) UpdateSecretValue(secret *types.Secret) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.secrets[secret.EndpointID][secret.Name]
+	if !ok {
+		return fmt.Errorf("could not find secret (%s)", secret.Name)
+	}
+	current.Value = slices.Clone(secret.Value)
+	return nil
+}
+
+func (s *MemoryStore) GetSecrets(endpointID uuid.UUID) ([]*types.Secret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secrets := []*types.Secret{}
+	for _, secret := range s.secrets[endpointID] {
+		secrets = append(secrets, copySecret(secret))
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+func (s *MemoryStore) DeleteSecret(endpointID uuid.UUID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[endpointID][name]; !ok {
+		return fmt.Errorf("could not find secret (%s)", name)
+	}
+	delete(s.secrets[endpointID], name)
+	return nil
+}
+
+func (s *MemoryStore) CreateDomain(domain *types.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[domain.EndpointID]; !ok {
+		return fmt.Errorf("could not find endpoint (%s)", domain.EndpointID)
+	}
+	for _, d := range s.domains {
+		if d.ID == domain.ID || d.Blocks(domain.EndpointID, domain.Hostname, domain.PathPrefix, domain.CreatedAT) {
+			return fmt.Errorf("domain (%s%s) already exists", domain.Hostname, domain.PathPrefix)
+		}
+	}
+	for id, d := range s.domains {
+		if d.Hostname == domain.Hostname && d.PathPrefix == domain.PathPrefix && d.Expired(domain.CreatedAT) {
+			delete(s.domains, id)
+		}
+	}
+	d := *domain
+	s.domains[domain.ID] = &d
+	return nil
+}
+
+func (s *MemoryStore) GetDomain(id uuid.UUID) (*types.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	domain, ok := s.domains[id]
+	if !ok {
+		return nil, fmt.Errorf("could not find domain (%s)", id)
+	}
+	d := *domain
+	return &d, nil
+}
+
+func (s *MemoryStore) GetDomains(endpointID uuid.UUID) ([]*types.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	domains := []*types.Domain{}
+	for _, domain := range s.domains {
+		if endpointID == uuid.Nil || domain.EndpointID == endpointID {
+			d := *domain
+			domains = append(domains, &d)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Hostname != domains[j].Hostname {
+			return domains[i].Hostname < domains[j].Hostname
+		}
+		return domains[i].PathPrefix < domains[j].PathPrefix
+	})
+	return domains, nil
+}
+
+func (s *MemoryStore) VerifyDomain(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	domain, ok := s.domains[id]
+	if !ok {
+		return fmt.Errorf("could not find domain (%s)", id)
+	}
+	for _, d := range s.domains {
+		if d.ID != id && d.Verified && d.Hostname == domain.Hostname && d.PathPrefix == domain.PathPrefix {
+			return fmt.Errorf("domain (%s%s) is already verified", domain.Hostname, domain.PathPrefix)
+		}
+	}
+	domain.Verified = true
+	return nil
+}
+
+func (s *MemoryStore) DeleteDomain(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.domains[id]; !ok {
+		return fmt.Errorf("could not find domain (%s)", id)
+	}
+	delete(s.domains, id)
+	return nil
+}
+
+func (s *MemoryStore) CreateAccount(account *types.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[account.ID]; ok {
+		return fmt.Errorf("account (%s) already exists", account.ID)
+	}
+	a := *account
+	s.accounts[account.ID] = &a
+	return nil
+}
+
+func (s *MemoryStore) GetAccount(id uuid.UUID) (*types.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("could not find account (%s)", id)
+	}
+	a := *account
+	return &a, nil
+}
+
+func (s *MemoryStore) SetAccountQuota(id uuid.UUID, quota types.Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[id]
+	if !ok {
+		return fmt.Errorf("could not find account (%s)", id)
+	}
+	account.Quota = quota
+	return nil
+}
+
+func (s *MemoryStore) CreateAPIToken(token *types.APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[token.AccountID]; !ok {
+		return fmt.Errorf("could not find account (%s)", token.AccountID)
+	}
+	for _, t := range s.tokens {
+		if t.ID == token.ID || slices.Equal(t.Hash, token.Hash) {
+			return fmt.Errorf("api token (%s) already exists", token.ID)
+		}
+	}
+	s.tokens[token.ID] = copyAPIToken(token)
+	return nil
+}
+
+func (s *MemoryStore) GetAPITokenByHash(hash []byte) (*types.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, token := range s.tokens {
+		if slices.Equal(token.Hash, hash) {
+			return copyAPIToken(token), nil
+		}
+	}
+	return nil, fmt.Errorf("could not find api token")
+}
+
+func (s *MemoryStore) GetAPITokens(accountID uuid.UUID) ([]*types.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := []*types.APIToken{}
+	for _, token := range s.tokens {
+		if token.AccountID == accountID {
+			tokens = append(tokens, copyAPIToken(token))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAT.Before(tokens[j].CreatedAT)
+	})
+	return tokens, nil
+}
+
+func (s *MemoryStore) DeleteAPIToken(accountID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, ok := s.tokens[id]; !ok || token.AccountID != accountID {
+		return fmt.Errorf("could not find api token (%s)", id)
+	}
+	delete(s.tokens, id)
+	for _, roles := range s.roles {
+		delete(roles, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetEndpointRole(role *types.EndpointRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[role.EndpointID]; !ok {
+		return fmt.Errorf("could not find endpoint (%s)", role.EndpointID)
+	}
+	if _, ok := s.tokens[role.TokenID]; !ok {
+		return fmt.Errorf("could not find api token (%s)", role.TokenID)
+	}
+	if _, ok := s.roles[role.EndpointID]; !ok {
+		s.roles[role.EndpointID] = make(map[uuid.UUID]*types.EndpointRole)
+	}
+	r := *role
+	if existing, ok := s.roles[role.EndpointID][role.TokenID]; ok {
+		r.CreatedAT = existing.CreatedAT
+	}
+	s.roles[role.EndpointID][role.TokenID] = &r
+	return nil
+}
+
+func (s *MemoryStore) GetEndpointRole(endpointID, tokenID uuid.UUID) (*types.EndpointRole, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[endpointID][tokenID]
+	if !ok {
+		return nil, fmt.Errorf("could not find role of api token (%s) on endpoint (%s)", tokenID, endpointID)
+	}
+	r := *role
+	return &r, nil
+}
+
+func (s *MemoryStore) GetEndpointRoles(endpointID uuid.UUID) ([]*types.EndpointRole, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	roles := []*types.EndpointRole{}
+	for _, role := range s.roles[endpointID] {
+		r := *role
+		roles = append(roles, &r)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].CreatedAT.Before(roles[j].CreatedAT)
+	})
+	return roles, nil
+}
+
+func (s *MemoryStore) DeleteEndpointRole(endpointID, tokenID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[endpointID][tokenID]; !ok {
+		return fmt.Errorf("could not find role of api token (%s) on endpoint (%s)", tokenID, endpointID)
+	}
+	delete(s.roles[endpointID], tokenID)
+	return nil
+}
+
+func (s *MemoryStore) CreateAuditEvent(event *types.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, copyAuditEvent(event))
+	return nil
+}
+
+func (s *MemoryStore) GetAuditEvents(filter AuditFilter, p Pagination) ([]*types.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := []*types.AuditEvent{}
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		if filter.Match(s.audit[i]) {
+			events = append(events, copyAuditEvent(s.audit[i]))
+		}
+	}
+	start, end := paginate(len(events), p)
+	return events[start:end], nil
+}
+
+func copyAuditEvent(event *types.AuditEvent) *types.AuditEvent {
+	e := *event
+	for _, state := range []**types.AuditState{&e.Before, &e.After} {
+		if *state != nil {
+			s := **state
+			s.EnvKeys = slices.Clone(s.EnvKeys)
+			*state = &s
+		}
+	}
+	return &e
+}
+
+func copyAPIToken(token *types.APIToken) *types.APIToken {
+	t := *token
+	t.Scopes = slices.Clone(token.Scopes)
+	t.Hash = slices.Clone(token.Hash)
+	return &t
+}
+
+func copySecret(secret *types.Secret) *types.Secret {
+	s := *secret
+	s.Value = slices.Clone(secret.Value)
+	return &s
+}
+
+// copyEndpoint makes a deep copy of the given endpoint so callers can never
+// mutate the state of the store without going through its methods.
+func copyEndpoint(endpoint *types.Endpoint) *types.Endpoint {
+	e := *endpoint
+	e.Environment = copyEnv(endpoint.Environment)
+	e.TrafficSplit = copyTrafficSplit(endpoint.TrafficSplit)
+	e.DeploymentHistory = make([]*types.DeploymentHistory, len(endpoint.DeploymentHistory))
+	for i, history := range endpoint.DeploymentHistory {
+		h := *history
+		e.DeploymentHistory[i] = &h
+	}
+	return &e
+}
+
+func copyTrafficSplit(split *types.TrafficSplit) *types.TrafficSplit {
+	if split == nil {
+		return nil
+	}
+	s := *split
+	s.Routes = slices.Clone(split.Routes)
+	if split.Canary != nil {
+		canary := *split.Canary
+		s.Canary = &canary
+	}
+	return &s
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	m := make(map[string]string, len(env))
+	for k, v := range env {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+func TestMemoryStoreEndpoint(t *testing.T) {
+	store := NewMemoryStore()
+	endpoint := types.NewEndpoint("my endpoint", "go", map[string]string{"FOO": "bar"})
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateEndpoint(endpoint); err == nil {
+		t.Fatal("expected error when creating a duplicate endpoint")
+	}
+
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != endpoint.Name || e.Environment["FOO"] != "bar" {
+		t.Fatalf("unexpected endpoint: %+v", e)
+	}
+
+	// Mutating the returned endpoint should not change the stored one.
+	e.Environment["FOO"] = "baz"
+	e, _ = store.GetEndpoint(endpoint.ID)
+	if e.Environment["FOO"] != "bar" {
+		t.Fatalf("expected store to be isolated from callers, got %s", e.Environment["FOO"])
+	}
+
+	if _, err := store.GetEndpoint(uuid.New()); err == nil {
+		t.Fatal("expected error for unknown endpoint")
+	}
+	endpoints, err := store.GetEndpoints(uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 {
+		t.Fatalf("expected 1 endpoint got %d", len(endpoints))
+	}
+}
+
+func TestMemoryStoreDeployment(t *testing.T) {
+	store := NewMemoryStore()
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	deploy := types.NewDeployment(endpoint, []byte("blob"))
+	if err := store.CreateDeployment(deploy); err == nil {
+		t.Fatal("expected error when deploying to an unknown endpoint")
+	}
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateDeployment(deploy); err != nil {
+		t.Fatal(err)
+	}
+	d, err := store.GetDeployment(deploy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Hash != deploy.Hash || string(d.Blob) != "blob" {
+		t.Fatalf("unexpected deployment: %+v", d)
+	}
+
+	err = store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{ActiveDeployID: uuid.New()})
+	if err == nil {
+		t.Fatal("expected error when activating an unknown deployment")
+	}
+	err = store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{
+		ActiveDeployID: deploy.ID,
+		Environment:    map[string]string{"A": "B"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ActiveDeploymentID != deploy.ID {
+		t.Fatalf("expected active deployment %s got %s", deploy.ID, e.ActiveDeploymentID)
+	}
+	if e.Environment["A"] != "B" {
+		t.Fatalf("expected environment to be updated got %v", e.Environment)
+	}
+	history, err := store.GetDeploymentHistory(endpoint.ID, Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].ID != deploy.ID || !history[0].Active {
+		t.Fatalf("unexpected deployment history: %v", history)
+	}
+}
+
+func TestMemoryStoreMetrics(t *testing.T) {
+	var (
+		store      = NewMemoryStore()
+		endpointID = uuid.New()
+		wg         sync.WaitGroup
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.CreateRuntimeMetrics([]types.RuntimeMetric{{
+				ID:         uuid.New(),
+				EndpointID: endpointID,
+				StatusCode: 200,
+			}})
+		}()
+	}
+	wg.Wait()
+	metrics, err := store.GetRuntimeMetrics(endpointID, MetricFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 100 {
+		t.Fatalf("expected 100 metrics got %d", len(metrics))
+	}
+	counts, err := store.GetRuntimeMetricCounts(endpointID, MetricFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Count != 100 || counts.Errors != 0 {
+		t.Fatalf("expected 100 metrics without errors got %+v", counts)
+	}
+}
+
+func TestMemoryStoreMetricsSummary(t *testing.T) {
+	testMetricsSummary(t, NewMemoryStore())
+}
+
+func TestMemoryStoreLogs(t *testing.T) {
+	testLogStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	testDelete(t, NewMemoryStore())
+}
+
+func TestMemoryStoreSecrets(t *testing.T) {
+	testSecretStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreTrafficSplit(t *testing.T) {
+	testTrafficSplit(t, NewMemoryStore())
+}
+
+func TestMemoryStoreDomains(t *testing.T) {
+	testDomainStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreEndpointSlug(t *testing.T) {
+	testEndpointSlug(t, NewMemoryStore())
+}
+
+func TestMemoryStoreEndpointEnvironment(t *testing.T) {
+	testEndpointEnvironment(t, NewMemoryStore())
+}
+
+func TestMemoryStoreAccounts(t *testing.T) {
+	testAccountStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreEndpointRoles(t *testing.T) {
+	testEndpointRoles(t, NewMemoryStore())
+}
+
+func TestMemoryStoreAudit(t *testing.T) {
+	testAuditStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreRateLimitsAndQuotas(t *testing.T) {
+	testRateLimitsAndQuotas(t, NewMemoryStore())
+}
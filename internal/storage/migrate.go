@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/raptor/internal/config"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// migrationLockID is the key of the Postgres advisory lock that is held while
+// migrations are applied, so concurrent startups of the api server and the
+// wasm server do not race each other.
+const migrationLockID = 7193418203
+
+//go:embed migrations
+var migrationFS embed.FS
+
+// Migration is a single versioned schema change. Migrations are embedded as
+// SQL files named <version>_<name>.up.sql and <version>_<name>.down.sql under
+// migrations/<dialect>.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied and when.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAT time.Time
+}
+
+// Migrator applies and reverts the versioned schema migrations of a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the given database and dialect.
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// OpenMigrator opens the database of the given storage driver without
+// applying any migrations.
+func OpenMigrator(driver string, cfg config.Storage) (*Migrator, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+	switch driver {
+	case DialectPostgres:
+		db, err = openPostgres(cfg.User, cfg.Password, cfg.Name, cfg.Host, cfg.Port, cfg.SSLMode)
+	case DialectSQLite:
+		db, err = openSQLite(cfg.Path)
+	default:
+		return nil, fmt.Errorf("storage driver %s does not support migrations", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, driver)
+}
+
+// Close closes the underlying database.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Up applies all pending migrations and returns the ones that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(tx *sql.Tx) error {
+		versions, err := appliedVersions(tx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			stmt := "INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, $3)"
+			if _, err := tx.Exec(stmt, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Down reverts the given number of most recently applied migrations and
+// returns the ones that were reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(func(tx *sql.Tx) error {
+		versions, err := appliedVersions(tx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := tx.Exec("DELETE FROM schema_version WHERE version = $1", migration.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// Status returns the status of every known migration ordered by version.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(tx *sql.Tx) error {
+		versions, err := appliedVersions(tx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			appliedAt, ok := versions[migration.Version]
+			statuses = append(statuses, MigrationStatus{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   ok,
+				AppliedAT: appliedAt,
+			})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn inside a single transaction that holds an exclusive
+// migration lock. Postgres uses a transaction scoped advisory lock, while
+// SQLite databases are opened with immediate transactions which take the
+// database write lock on BEGIN.
+func (m *Migrator) withLock(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.dialect == DialectPostgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+CREATE TABLE if not exists schema_version (
+	version integer primary key,
+	name text not null,
+	applied_at timestamp not null
+)`)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func appliedVersions(tx *sql.Tx) (map[int]time.Time, error) {
+	rows, err := tx.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations found for dialect %s", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, migrationName, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in file name: %s", name)
+		}
+		b, err := fs.ReadFile(migrationFS, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{DialectPostgres, DialectSQLite} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("expected migrations for dialect %s", dialect)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Fatalf("expected migration version %d got %d", i+1, migration.Version)
+			}
+		}
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "raptor.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewMigrator(db, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.migrations) {
+		t.Fatalf("expected %d applied migrations got %d", len(m.migrations), len(applied))
+	}
+	applied, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected no pending migrations got %d", len(applied))
+	}
+
+	reverted, err := m.Down(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != m.migrations[len(m.migrations)-1].Version {
+		t.Fatalf("expected the latest migration to be reverted got %v", reverted)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[len(statuses)-1].Applied {
+		t.Fatal("expected the latest migration to be pending")
+	}
+
+	if _, err := m.Down(len(m.migrations)); err != nil {
+		t.Fatal(err)
+	}
+	applied, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.migrations) {
+		t.Fatalf("expected %d applied migrations got %d", len(m.migrations), len(applied))
+	}
+}
+
+func TestMigratorConcurrentUp(t *testing.T) {
+	var (
+		path  = filepath.Join(t.TempDir(), "raptor.db")
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := openSQLite(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer db.Close()
+			m, err := NewMigrator(db, DialectSQLite)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			applied, err := m.Up()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			total += len(applied)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	migrations, _ := loadMigrations(DialectSQLite)
+	if total != len(migrations) {
+		t.Fatalf("expected every migration to be applied exactly once, got %d applications", total)
+	}
+}
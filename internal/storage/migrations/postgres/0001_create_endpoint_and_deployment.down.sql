@@ -0,0 +1,2 @@
+DROP TABLE if exists deployment CASCADE;
+DROP TABLE if exists endpoint CASCADE;
@@ -0,0 +1,18 @@
+CREATE TABLE if not exists endpoint (
+	id UUID primary key, 
+	name text not null,
+	runtime text not null,
+	environment jsonb,
+	created_at timestamp not null default now()
+);
+
+CREATE TABLE if not exists deployment (
+	id UUID primary key, 
+	endpoint_id UUID not null references endpoint,
+	hash text not null,
+	blob bytea not null,
+	created_at timestamp not null default now()
+);
+
+ALTER table endpoint
+ADD COLUMN if not exists active_deployment_id UUID references deployment;
@@ -0,0 +1,8 @@
+CREATE TABLE publication (
+	id UUID primary key,
+	endpoint_id UUID not null references endpoint,
+	deployment_id UUID not null references deployment,
+	published_at timestamp not null default now()
+);
+
+CREATE INDEX publication_endpoint_id_published_at_idx ON publication (endpoint_id, published_at);
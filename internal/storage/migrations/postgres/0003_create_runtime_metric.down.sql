@@ -0,0 +1 @@
+DROP TABLE runtime_metric;
@@ -0,0 +1,12 @@
+CREATE TABLE runtime_metric (
+	id UUID primary key,
+	endpoint_id UUID not null,
+	deployment_id UUID not null,
+	request_url text not null,
+	duration bigint not null,
+	start_time timestamp not null,
+	status_code integer not null
+);
+
+CREATE INDEX runtime_metric_endpoint_id_start_time_idx ON runtime_metric (endpoint_id, start_time);
+CREATE INDEX runtime_metric_start_time_idx ON runtime_metric (start_time);
@@ -0,0 +1,3 @@
+ALTER TABLE endpoint DROP COLUMN fuel;
+ALTER TABLE endpoint DROP COLUMN timeout;
+ALTER TABLE endpoint DROP COLUMN max_memory_pages;
@@ -0,0 +1,3 @@
+ALTER TABLE endpoint ADD COLUMN max_memory_pages bigint not null default 0;
+ALTER TABLE endpoint ADD COLUMN timeout bigint not null default 0;
+ALTER TABLE endpoint ADD COLUMN fuel bigint not null default 0;
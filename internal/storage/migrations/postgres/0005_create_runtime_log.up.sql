@@ -0,0 +1,12 @@
+CREATE TABLE runtime_log (
+	seq bigserial primary key,
+	endpoint_id UUID not null,
+	deployment_id UUID not null,
+	request_id text not null,
+	stream text not null,
+	line text not null,
+	logged_at timestamp not null
+);
+
+CREATE INDEX runtime_log_endpoint_id_seq_idx ON runtime_log (endpoint_id, seq);
+CREATE INDEX runtime_log_logged_at_idx ON runtime_log (logged_at);
@@ -0,0 +1,4 @@
+DROP INDEX endpoint_account_id;
+ALTER TABLE endpoint DROP COLUMN account_id;
+DROP TABLE api_token;
+DROP TABLE account;
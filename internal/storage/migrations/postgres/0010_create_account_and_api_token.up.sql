@@ -0,0 +1,18 @@
+CREATE TABLE account (
+	id UUID primary key,
+	name text not null,
+	created_at timestamp not null
+);
+
+CREATE TABLE api_token (
+	id UUID primary key,
+	account_id UUID not null references account,
+	name text not null,
+	scopes jsonb not null,
+	prefix text not null,
+	hash bytea not null unique,
+	created_at timestamp not null
+);
+
+ALTER TABLE endpoint ADD COLUMN account_id UUID references account;
+CREATE INDEX endpoint_account_id ON endpoint (account_id);
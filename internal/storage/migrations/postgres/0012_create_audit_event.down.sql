@@ -0,0 +1,3 @@
+DROP INDEX audit_event_endpoint_id;
+DROP INDEX audit_event_account_id;
+DROP TABLE audit_event;
@@ -0,0 +1,17 @@
+CREATE TABLE audit_event (
+	id UUID primary key,
+	account_id UUID,
+	actor text not null,
+	token_id UUID,
+	action text not null,
+	endpoint_id UUID,
+	target_id UUID,
+	detail text not null,
+	state_before jsonb,
+	state_after jsonb,
+	source_ip text not null,
+	created_at timestamp not null
+);
+
+CREATE INDEX audit_event_account_id ON audit_event (account_id, created_at);
+CREATE INDEX audit_event_endpoint_id ON audit_event (endpoint_id, created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE account DROP COLUMN monthly_compute_time;
+ALTER TABLE account DROP COLUMN monthly_invocations;
+ALTER TABLE endpoint DROP COLUMN client_rate_limit_burst;
+ALTER TABLE endpoint DROP COLUMN client_rate_limit;
+ALTER TABLE endpoint DROP COLUMN rate_limit_burst;
+ALTER TABLE endpoint DROP COLUMN rate_limit;
@@ -0,0 +1,3 @@
+ALTER TABLE endpoint ADD COLUMN max_concurrent integer not null default 0;
+ALTER TABLE endpoint ADD COLUMN max_queue integer not null default 0;
+ALTER TABLE endpoint ADD COLUMN queue_timeout bigint not null default 0;
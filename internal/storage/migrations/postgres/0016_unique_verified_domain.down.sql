@@ -0,0 +1,8 @@
+DELETE FROM domain WHERE NOT verified AND EXISTS (
+	SELECT 1 FROM domain o
+	WHERE o.hostname = domain.hostname AND o.path_prefix = domain.path_prefix AND o.id <> domain.id
+	AND (o.verified OR o.created_at < domain.created_at OR (o.created_at = domain.created_at AND o.id < domain.id))
+);
+DROP INDEX domain_hostname_path_prefix;
+DROP INDEX domain_verified_hostname_path_prefix;
+ALTER TABLE domain ADD CONSTRAINT domain_hostname_path_prefix_key UNIQUE (hostname, path_prefix);
@@ -0,0 +1,3 @@
+ALTER TABLE domain DROP CONSTRAINT domain_hostname_path_prefix_key;
+CREATE UNIQUE INDEX domain_verified_hostname_path_prefix ON domain (hostname, path_prefix) WHERE verified;
+CREATE INDEX domain_hostname_path_prefix ON domain (hostname, path_prefix);
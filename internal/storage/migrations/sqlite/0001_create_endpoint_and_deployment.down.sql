@@ -0,0 +1,3 @@
+UPDATE endpoint SET active_deployment_id = NULL;
+DROP TABLE if exists deployment;
+DROP TABLE if exists endpoint;
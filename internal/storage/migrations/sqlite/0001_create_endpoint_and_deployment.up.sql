@@ -0,0 +1,16 @@
+CREATE TABLE if not exists endpoint (
+	id text primary key,
+	name text not null,
+	runtime text not null,
+	environment text,
+	created_at timestamp not null default current_timestamp,
+	active_deployment_id text references deployment
+);
+
+CREATE TABLE if not exists deployment (
+	id text primary key,
+	endpoint_id text not null references endpoint,
+	hash text not null,
+	blob blob not null,
+	created_at timestamp not null default current_timestamp
+);
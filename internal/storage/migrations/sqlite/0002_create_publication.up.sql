@@ -0,0 +1,8 @@
+CREATE TABLE publication (
+	id text primary key,
+	endpoint_id text not null references endpoint,
+	deployment_id text not null references deployment,
+	published_at timestamp not null default current_timestamp
+);
+
+CREATE INDEX publication_endpoint_id_published_at_idx ON publication (endpoint_id, published_at);
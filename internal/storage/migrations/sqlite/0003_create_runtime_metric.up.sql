@@ -0,0 +1,12 @@
+CREATE TABLE runtime_metric (
+	id text primary key,
+	endpoint_id text not null,
+	deployment_id text not null,
+	request_url text not null,
+	duration integer not null,
+	start_time timestamp not null,
+	status_code integer not null
+);
+
+CREATE INDEX runtime_metric_endpoint_id_start_time_idx ON runtime_metric (endpoint_id, start_time);
+CREATE INDEX runtime_metric_start_time_idx ON runtime_metric (start_time);
@@ -0,0 +1,9 @@
+CREATE TABLE secret (
+	endpoint_id text not null references endpoint,
+	name text not null,
+	value blob not null,
+	version integer not null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	primary key (endpoint_id, name)
+);
@@ -0,0 +1 @@
+ALTER TABLE endpoint DROP COLUMN traffic_split;
@@ -0,0 +1 @@
+ALTER TABLE endpoint ADD COLUMN traffic_split text;
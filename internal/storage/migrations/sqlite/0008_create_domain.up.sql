@@ -0,0 +1,10 @@
+CREATE TABLE domain (
+	id text primary key,
+	endpoint_id text not null references endpoint,
+	hostname text not null,
+	path_prefix text not null,
+	verification_token text not null,
+	verified boolean not null,
+	created_at timestamp not null,
+	unique (hostname, path_prefix)
+);
@@ -0,0 +1,2 @@
+DROP INDEX endpoint_slug;
+ALTER TABLE endpoint DROP COLUMN slug;
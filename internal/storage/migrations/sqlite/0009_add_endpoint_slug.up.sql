@@ -0,0 +1,2 @@
+ALTER TABLE endpoint ADD COLUMN slug text;
+CREATE UNIQUE INDEX endpoint_slug ON endpoint (slug);
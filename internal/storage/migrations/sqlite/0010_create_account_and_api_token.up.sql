@@ -0,0 +1,18 @@
+CREATE TABLE account (
+	id text primary key,
+	name text not null,
+	created_at timestamp not null
+);
+
+CREATE TABLE api_token (
+	id text primary key,
+	account_id text not null references account,
+	name text not null,
+	scopes text not null,
+	prefix text not null,
+	hash blob not null unique,
+	created_at timestamp not null
+);
+
+ALTER TABLE endpoint ADD COLUMN account_id text references account;
+CREATE INDEX endpoint_account_id ON endpoint (account_id);
@@ -0,0 +1,7 @@
+CREATE TABLE endpoint_role (
+	endpoint_id text not null references endpoint,
+	token_id text not null references api_token,
+	role text not null,
+	created_at timestamp not null,
+	primary key (endpoint_id, token_id)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE audit_event (
+	id text primary key,
+	account_id text,
+	actor text not null,
+	token_id text,
+	action text not null,
+	endpoint_id text,
+	target_id text,
+	detail text not null,
+	state_before text,
+	state_after text,
+	source_ip text not null,
+	created_at timestamp not null
+);
+
+CREATE INDEX audit_event_account_id ON audit_event (account_id, created_at);
+CREATE INDEX audit_event_endpoint_id ON audit_event (endpoint_id, created_at);
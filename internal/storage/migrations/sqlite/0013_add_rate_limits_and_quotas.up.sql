@@ -0,0 +1,6 @@
+ALTER TABLE endpoint ADD COLUMN rate_limit real not null default 0;
+ALTER TABLE endpoint ADD COLUMN rate_limit_burst integer not null default 0;
+ALTER TABLE endpoint ADD COLUMN client_rate_limit real not null default 0;
+ALTER TABLE endpoint ADD COLUMN client_rate_limit_burst integer not null default 0;
+ALTER TABLE account ADD COLUMN monthly_invocations bigint not null default 0;
+ALTER TABLE account ADD COLUMN monthly_compute_time bigint not null default 0;
@@ -0,0 +1,3 @@
+ALTER TABLE endpoint DROP COLUMN queue_timeout;
+ALTER TABLE endpoint DROP COLUMN max_queue;
+ALTER TABLE endpoint DROP COLUMN max_concurrent;
@@ -0,0 +1,7 @@
+CREATE TABLE account_usage (
+	account_id text not null references account,
+	month timestamp not null,
+	invocations bigint not null default 0,
+	compute_time bigint not null default 0,
+	primary key (account_id, month)
+);
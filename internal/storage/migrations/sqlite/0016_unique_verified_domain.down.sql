@@ -0,0 +1,22 @@
+DELETE FROM domain WHERE NOT verified AND EXISTS (
+	SELECT 1 FROM domain o
+	WHERE o.hostname = domain.hostname AND o.path_prefix = domain.path_prefix AND o.id <> domain.id
+	AND (o.verified OR o.created_at < domain.created_at OR (o.created_at = domain.created_at AND o.id < domain.id))
+);
+
+CREATE TABLE domain_old (
+	id text primary key,
+	endpoint_id text not null references endpoint,
+	hostname text not null,
+	path_prefix text not null,
+	verification_token text not null,
+	verified boolean not null,
+	created_at timestamp not null,
+	unique (hostname, path_prefix)
+);
+
+INSERT INTO domain_old (id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at)
+SELECT id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at FROM domain;
+
+DROP TABLE domain;
+ALTER TABLE domain_old RENAME TO domain;
@@ -0,0 +1,18 @@
+CREATE TABLE domain_new (
+	id text primary key,
+	endpoint_id text not null references endpoint,
+	hostname text not null,
+	path_prefix text not null,
+	verification_token text not null,
+	verified boolean not null,
+	created_at timestamp not null
+);
+
+INSERT INTO domain_new (id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at)
+SELECT id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at FROM domain;
+
+DROP TABLE domain;
+ALTER TABLE domain_new RENAME TO domain;
+
+CREATE UNIQUE INDEX domain_verified_hostname_path_prefix ON domain (hostname, path_prefix) WHERE verified;
+CREATE INDEX domain_hostname_path_prefix ON domain (hostname, path_prefix);
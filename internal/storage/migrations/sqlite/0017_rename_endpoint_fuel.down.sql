@@ -0,0 +1 @@
+ALTER TABLE endpoint RENAME COLUMN max_calls TO fuel;
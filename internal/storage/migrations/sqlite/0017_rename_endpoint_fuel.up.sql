@@ -0,0 +1 @@
+ALTER TABLE endpoint RENAME COLUMN fuel TO max_calls;
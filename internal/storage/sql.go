@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/google/uuid"
@@ -12,10 +14,33 @@ import (
 )
 
 type SQLStore struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect string
 }
 
 func NewSQLStore(user, password, dbname, host, port, sslmode string) (*SQLStore, error) {
+	db, err := openPostgres(user, password, dbname, host, port, sslmode)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLStore(db, DialectPostgres)
+}
+
+func newSQLStore(db *sql.DB, dialect string) (*SQLStore, error) {
+	migrator, err := NewMigrator(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(); err != nil {
+		return nil, err
+	}
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+	}, nil
+}
+
+func openPostgres(user, password, dbname, host, port, sslmode string) (*sql.DB, error) {
 	uri := fmt.Sprintf(
 		"user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
 		user,
@@ -25,24 +50,15 @@ func NewSQLStore(user, password, dbname, host, port, sslmode string) (*SQLStore,
 		port,
 		sslmode,
 	)
-	db, err := sql.Open("postgres", uri)
-	if err != nil {
-		return nil, err
-	}
-	_, err = db.Exec(createAllTablesQuery)
-	if err != nil {
-		return nil, err
-	}
-
-	return &SQLStore{
-		db: db,
-	}, nil
+	return sql.Open("postgres", uri)
 }
 
 func (s *SQLStore) CreateEndpoint(endpoint *types.Endpoint) error {
 	stmt := `
-INSERT INTO endpoint (id, name, runtime, environment, created_at)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO endpoint (id, name, slug, account_id, runtime, environment, max_memory_pages, timeout, max_calls,
+	rate_limit, rate_limit_burst, client_rate_limit, client_rate_limit_burst,
+	max_concurrent, max_queue, queue_timeout, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 RETURNING id`
 	b, err := json.Marshal(endpoint.Environment)
 	if err != nil {
@@ -51,21 +67,48 @@ RETURNING id`
 	_, err = s.db.Exec(stmt,
 		endpoint.ID,
 		endpoint.Name,
+		nullString(endpoint.Slug),
+		uuid.NullUUID{UUID: endpoint.AccountID, Valid: endpoint.AccountID != uuid.Nil},
 		endpoint.Runtime,
 		b,
+		endpoint.Limits.MaxMemoryPages,
+		int64(endpoint.Limits.Timeout),
+		endpoint.Limits.MaxCalls,
+		endpoint.RateLimits.Endpoint.Rate,
+		endpoint.RateLimits.Endpoint.Burst,
+		endpoint.RateLimits.Client.Rate,
+		endpoint.RateLimits.Client.Burst,
+		endpoint.Concurrency.MaxConcurrent,
+		endpoint.Concurrency.MaxQueue,
+		int64(endpoint.Concurrency.QueueTimeout),
 		endpoint.CreatedAT)
 	return err
 }
 
 func (s *SQLStore) GetEndpoint(id uuid.UUID) (*types.Endpoint, error) {
-	row := s.db.QueryRow("SELECT * FROM endpoint WHERE id = $1", id)
+	row := s.db.QueryRow("SELECT "+endpointColumns+" FROM endpoint WHERE id = $1", id)
 	var endpoint types.Endpoint
 	err := scanEndpoint(row, &endpoint)
 	return &endpoint, err
 }
 
-func (s *SQLStore) GetEndpoints() ([]types.Endpoint, error) {
-	rows, err := s.db.Query("SELECT * FROM endpoint")
+func (s *SQLStore) GetEndpointBySlug(slug string) (*types.Endpoint, error) {
+	row := s.db.QueryRow("SELECT "+endpointColumns+" FROM endpoint WHERE slug = $1", slug)
+	var endpoint types.Endpoint
+	if err := scanEndpoint(row, &endpoint); err != nil {
+		return nil, fmt.Errorf("could not find endpoint (%s)", slug)
+	}
+	return &endpoint, nil
+}
+
+func (s *SQLStore) GetEndpoints(accountID uuid.UUID) ([]types.Endpoint, error) {
+	stmt := "SELECT " + endpointColumns + " FROM endpoint"
+	args := []any{}
+	if accountID != uuid.Nil {
+		stmt += " WHERE account_id = $1"
+		args = append(args, accountID)
+	}
+	rows, err := s.db.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -83,9 +126,141 @@ func (s *SQLStore) GetEndpoints() ([]types.Endpoint, error) {
 }
 
 func (s *SQLStore) UpdateEndpoint(id uuid.UUID, params UpdateEndpointParams) error {
-	query, args := buildUpdateEndpointQuery(id, params)
-	_, err := s.db.Exec(query, args...)
-	return err
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if params.mergesEnvironment() {
+		env, err := s.getEndpointEnvironment(tx, id)
+		if err != nil {
+			return err
+		}
+		params.Environment = params.mergeEnvironment(env)
+	}
+	query, args, err := buildUpdateEndpointQuery(id, params)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if params.ActiveDeployID != uuid.Nil {
+		publication := types.NewPublication(id, params.ActiveDeployID)
+		stmt := `
+INSERT INTO publication (id, endpoint_id, deployment_id, published_at)
+VALUES ($1, $2, $3, $4)`
+		_, err := tx.Exec(stmt,
+			publication.ID,
+			publication.EndpointID,
+			publication.DeploymentID,
+			publication.PublishedAT)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getEndpointEnvironment returns the environment of the endpoint, locking its
+// row until the transaction ends on postgres. The SQLite transactions take the
+// write lock when they begin.
+func (s *SQLStore) getEndpointEnvironment(tx *sql.Tx, id uuid.UUID) (map[string]string, error) {
+	query := "SELECT environment FROM endpoint WHERE id = $1"
+	if s.dialect == DialectPostgres {
+		query += " FOR UPDATE"
+	}
+	var b []byte
+	if err := tx.QueryRow(query, id).Scan(&b); err != nil {
+		return nil, fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (s *SQLStore) SetTrafficSplit(id uuid.UUID, split *types.TrafficSplit) error {
+	var value any
+	if split != nil {
+		b, err := json.Marshal(split)
+		if err != nil {
+			return err
+		}
+		value = string(b)
+	}
+	res, err := s.db.Exec("UPDATE endpoint SET traffic_split = $1 WHERE id = $2", value, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteEndpoint(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The endpoint references its active deployment, so the reference is
+	// cleared before the deployments can be deleted.
+	stmts := []string{
+		"UPDATE endpoint SET active_deployment_id = NULL WHERE id = $1",
+		"DELETE FROM publication WHERE endpoint_id = $1",
+		"DELETE FROM runtime_metric WHERE endpoint_id = $1",
+		"DELETE FROM runtime_log WHERE endpoint_id = $1",
+		"DELETE FROM secret WHERE endpoint_id = $1",
+		"DELETE FROM domain WHERE endpoint_id = $1",
+		"DELETE FROM endpoint_role WHERE endpoint_id = $1",
+		"DELETE FROM deployment WHERE endpoint_id = $1",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec("DELETE FROM endpoint WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find endpoint (%s)", id)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteDeployment(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		"UPDATE endpoint SET active_deployment_id = NULL WHERE active_deployment_id = $1",
+		"DELETE FROM publication WHERE deployment_id = $1",
+		"DELETE FROM runtime_metric WHERE deployment_id = $1",
+		"DELETE FROM runtime_log WHERE deployment_id = $1",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec("DELETE FROM deployment WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find deployment (%s)", id)
+	}
+	return tx.Commit()
 }
 
 func (s *SQLStore) GetDeployment(id uuid.UUID) (*types.Deployment, error) {
@@ -111,19 +286,825 @@ RETURNING id`
 	return err
 }
 
-func (s *SQLStore) CreateRuntimeMetric(metric *types.RuntimeMetric) error {
-	return nil
+func (s *SQLStore) GetDeploymentHistory(endpointID uuid.UUID, p Pagination) ([]*types.DeploymentHistory, error) {
+	var activeID uuid.UUID
+	row := s.db.QueryRow("SELECT active_deployment_id FROM endpoint WHERE id = $1", endpointID)
+	if err := row.Scan(&activeID); err != nil {
+		return nil, err
+	}
+
+	stmt := "SELECT id, hash, created_at FROM deployment WHERE endpoint_id = $1 ORDER BY created_at DESC"
+	args := []any{endpointID}
+	if p.Limit > 0 {
+		stmt += " LIMIT $2 OFFSET $3"
+		args = append(args, p.Limit, p.Offset)
+	}
+	rows, err := s.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deploys []*types.Deployment
+	for rows.Next() {
+		var deploy types.Deployment
+		if err := rows.Scan(&deploy.ID, &deploy.Hash, &deploy.CreatedAT); err != nil {
+			return nil, err
+		}
+		deploys = append(deploys, &deploy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	publications, err := s.GetPublications(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	return buildDeploymentHistory(deploys, publications, activeID), nil
 }
 
-func (s *SQLStore) GetRuntimeMetrics(id uuid.UUID) ([]types.RuntimeMetric, error) {
-	return nil, nil
+func (s *SQLStore) GetPublications(endpointID uuid.UUID) ([]*types.Publication, error) {
+	stmt := `
+SELECT id, endpoint_id, deployment_id, published_at FROM publication
+WHERE endpoint_id = $1
+ORDER BY published_at`
+	rows, err := s.db.Query(stmt, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var publications []*types.Publication
+	for rows.Next() {
+		var p types.Publication
+		if err := rows.Scan(&p.ID, &p.EndpointID, &p.DeploymentID, &p.PublishedAT); err != nil {
+			return nil, err
+		}
+		publications = append(publications, &p)
+	}
+	return publications, rows.Err()
 }
 
+func (s *SQLStore) CreateRuntimeMetrics(metrics []types.RuntimeMetric) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+INSERT INTO runtime_metric (id, endpoint_id, deployment_id, request_url, duration, start_time, status_code)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, metric := range metrics {
+		_, err := stmt.Exec(
+			metric.ID,
+			metric.EndpointID,
+			metric.DeploymentID,
+			metric.RequestURL,
+			int64(metric.Duration),
+			metric.StartTime.UTC(),
+			metric.StatusCode)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetRuntimeMetrics(id uuid.UUID, filter MetricFilter) ([]types.RuntimeMetric, error) {
+	query, args := buildRuntimeMetricsQuery(id, filter)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []types.RuntimeMetric{}
+	for rows.Next() {
+		var metric types.RuntimeMetric
+		if err := scanRuntimeMetric(rows, &metric); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, rows.Err()
+}
+
+func (s *SQLStore) GetRuntimeMetricCounts(id uuid.UUID, filter MetricFilter) (types.MetricCounts, error) {
+	conditions, args := runtimeMetricConditions(id, filter)
+	query := fmt.Sprintf(`
+SELECT count(*), coalesce(sum(CASE WHEN status_code >= 500 THEN 1 ELSE 0 END), 0)
+FROM runtime_metric
+WHERE %s`, strings.Join(conditions, " AND "))
+	var counts types.MetricCounts
+	err := s.db.QueryRow(query, args...).Scan(&counts.Count, &counts.Errors)
+	return counts, err
+}
+
+func (s *SQLStore) GetRuntimeMetricsSummary(id uuid.UUID, filter MetricFilter, bucket time.Duration) (*types.MetricsSummary, error) {
+	var groups []types.MetricsGroup
+	// The groups of the buckets of the deployments, of the deployments and
+	// of the whole endpoint.
+	for _, keys := range [][]string{{"deployment_id", "bucket"}, {"deployment_id"}, {}} {
+		query, args := s.buildRuntimeMetricsSummaryQuery(id, filter, bucket, keys)
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				g             = types.MetricsGroup{Bucket: -1}
+				statuses      [5]int
+				p50, p90, p99 int64
+				dest          []any
+			)
+			if len(keys) > 0 {
+				dest = append(dest, &g.DeploymentID)
+			}
+			if len(keys) > 1 {
+				dest = append(dest, &g.Bucket)
+			}
+			dest = append(dest, &g.Count, &statuses[0], &statuses[1], &statuses[2], &statuses[3], &statuses[4], &p50, &p90, &p99)
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			g.StatusCounts = make(map[string]int)
+			known := 0
+			for i, n := range statuses {
+				g.StatusCounts[types.StatusClass((i+1)*100)] = n
+				known += n
+			}
+			g.StatusCounts[types.StatusClass(0)] = g.Count - known
+			g.P50, g.P90, g.P99 = time.Duration(p50), time.Duration(p90), time.Duration(p99)
+			groups = append(groups, g)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return types.NewMetricsSummary(id, filter.From, filter.To, bucket, groups), nil
+}
+
+// buildRuntimeMetricsSummaryQuery returns the query that aggregates the
+// metrics per group of the given keys. The percentiles are the nearest-rank
+// durations of the groups, picked by their row number.
+func (s *SQLStore) buildRuntimeMetricsSummaryQuery(id uuid.UUID, filter MetricFilter, bucket time.Duration, keys []string) (string, []any) {
+	conditions, args := runtimeMetricConditions(id, filter)
+	args = append(args, filter.From.UnixMilli(), bucket.Milliseconds())
+	var (
+		from     = fmt.Sprintf("$%d", len(args)-1)
+		size     = fmt.Sprintf("$%d", len(args))
+		bucketOf string
+	)
+	switch s.dialect {
+	case DialectSQLite:
+		// The start time is stored in the format of time.Time.String, of
+		// which julianday parses the part before the zone. The julian day
+		// is rounded back to the unix milliseconds it was computed from.
+		bucketOf = fmt.Sprintf("(CAST(julianday(substr(start_time, 1, instr(substr(start_time, 12), ' ') + 10)) * 86400000 + 0.5 AS INTEGER) - 210866760000000 - %s) / %s", from, size)
+	default:
+		bucketOf = fmt.Sprintf("floor((extract(epoch FROM start_time) * 1000 - %s) / %s)::integer", from, size)
+	}
+	var (
+		columns   = strings.Join(keys, ", ")
+		partition string
+		groupBy   string
+	)
+	if len(keys) > 0 {
+		partition = "PARTITION BY " + columns
+		groupBy = "GROUP BY " + columns
+		columns += ","
+	}
+	query := fmt.Sprintf(`
+WITH m AS (
+	SELECT deployment_id, %s AS bucket, duration, status_code
+	FROM runtime_metric
+	WHERE %s
+), ranked AS (
+	SELECT %s duration, status_code,
+		row_number() OVER (%s ORDER BY duration) AS rn,
+		count(*) OVER (%s) AS n
+	FROM m
+)
+SELECT %s count(*),
+	coalesce(sum(CASE WHEN status_code BETWEEN 100 AND 199 THEN 1 ELSE 0 END), 0),
+	coalesce(sum(CASE WHEN status_code BETWEEN 200 AND 299 THEN 1 ELSE 0 END), 0),
+	coalesce(sum(CASE WHEN status_code BETWEEN 300 AND 399 THEN 1 ELSE 0 END), 0),
+	coalesce(sum(CASE WHEN status_code BETWEEN 400 AND 499 THEN 1 ELSE 0 END), 0),
+	coalesce(sum(CASE WHEN status_code BETWEEN 500 AND 599 THEN 1 ELSE 0 END), 0),
+	coalesce(max(CASE WHEN rn = (50 * n + 99) / 100 THEN duration END), 0),
+	coalesce(max(CASE WHEN rn = (90 * n + 99) / 100 THEN duration END), 0),
+	coalesce(max(CASE WHEN rn = (99 * n + 99) / 100 THEN duration END), 0)
+FROM ranked
+%s`, bucketOf, strings.Join(conditions, " AND "), columns, partition, partition, columns, groupBy)
+	return query, args
+}
+
+func (s *SQLStore) AddAccountUsage(accountID uuid.UUID, month time.Time, usage types.Usage) error {
+	_, err := s.db.Exec(`
+INSERT INTO account_usage (account_id, month, invocations, compute_time)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (account_id, month) DO UPDATE SET
+	invocations = account_usage.invocations + excluded.invocations,
+	compute_time = account_usage.compute_time + excluded.compute_time`,
+		accountID, types.MonthStart(month), usage.Invocations, int64(usage.ComputeTime))
+	return err
+}
+
+func (s *SQLStore) GetAccountUsage(accountID uuid.UUID, since time.Time) (types.Usage, error) {
+	var (
+		usage    types.Usage
+		duration int64
+	)
+	row := s.db.QueryRow(`
+SELECT coalesce(sum(invocations), 0), coalesce(sum(compute_time), 0)
+FROM account_usage
+WHERE account_id = $1 AND month >= $2`, accountID, types.MonthStart(since))
+	if err := row.Scan(&usage.Invocations, &duration); err != nil {
+		return usage, err
+	}
+	usage.ComputeTime = time.Duration(duration)
+	return usage, nil
+}
+
+func (s *SQLStore) CreateRuntimeLogs(logs []types.RuntimeLog) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+INSERT INTO runtime_log (endpoint_id, deployment_id, request_id, stream, line, logged_at)
+VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, log := range logs {
+		_, err := stmt.Exec(
+			log.EndpointID,
+			log.DeploymentID,
+			log.RequestID,
+			log.Stream,
+			log.Line,
+			log.Time.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetRuntimeLogs(id uuid.UUID, filter LogFilter) ([]types.RuntimeLog, error) {
+	query, args := buildRuntimeLogsQuery(id, filter)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []types.RuntimeLog{}
+	for rows.Next() {
+		var log types.RuntimeLog
+		if err := scanRuntimeLog(rows, &log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Without a cursor the newest logs are selected first.
+	if filter.AfterSeq == 0 {
+		slices.Reverse(logs)
+	}
+	return logs, nil
+}
+
+func (s *SQLStore) DeleteRuntimeLogs(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM runtime_log WHERE logged_at < $1", before.UTC())
+	return err
+}
+
+// endpointColumns are the columns selected for each endpoint in the order
+// that scanEndpoint expects them.
+const endpointColumns = "id, name, slug, account_id, runtime, environment, active_deployment_id, max_memory_pages, timeout, max_calls, rate_limit, rate_limit_burst, client_rate_limit, client_rate_limit_burst, max_concurrent, max_queue, queue_timeout, traffic_split, created_at"
+
+// domainColumns are the columns selected for each domain in the order that
+// scanDomain expects them.
+const domainColumns = "id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at"
+
+// apiTokenColumns are the columns selected for each API token in the order
+// that scanAPIToken expects them.
+const apiTokenColumns = "id, account_id, name, scopes, prefix, hash, created_at"
+
 type Scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func buildUpdateEndpointQuery(id uuid.UUID, params UpdateEndpointParams) (string, []any) {
+func (s *SQLStore) PutSecret(secret *types.Secret) error {
+	now := time.Now().UTC()
+	row := s.db.QueryRow(`
+INSERT INTO secret (endpoint_id, name, value, version, created_at, updated_at)
+VALUES ($1, $2, $3, 1, $4, $4)
+ON CONFLICT (endpoint_id, name) DO UPDATE
+SET value = excluded.value, version = secret.version + 1, updated_at = excluded.updated_at
+RETURNING version, created_at, updated_at`,
+		secret.EndpointID,
+		secret.Name,
+		secret.Value,
+		now)
+	return row.Scan(&secret.Version, &secret.CreatedAT, &secret.UpdatedAT)
+}
+
+func (s *SQLStore) UpdateSecretValue(secret *types.Secret) error {
+	res, err := s.db.Exec("UPDATE secret SET value = $1 WHERE endpoint_id = $2 AND name = $3",
+		secret.Value,
+		secret.EndpointID,
+		secret.Name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find secret (%s)", secret.Name)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetSecrets(endpointID uuid.UUID) ([]*types.Secret, error) {
+	rows, err := s.db.Query(`
+SELECT endpoint_id, name, value, version, created_at, updated_at
+FROM secret WHERE endpoint_id = $1 ORDER BY name`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := []*types.Secret{}
+	for rows.Next() {
+		var secret types.Secret
+		err := rows.Scan(
+			&secret.EndpointID,
+			&secret.Name,
+			&secret.Value,
+			&secret.Version,
+			&secret.CreatedAT,
+			&secret.UpdatedAT)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, &secret)
+	}
+	return secrets, rows.Err()
+}
+
+func (s *SQLStore) DeleteSecret(endpointID uuid.UUID, name string) error {
+	res, err := s.db.Exec("DELETE FROM secret WHERE endpoint_id = $1 AND name = $2", endpointID, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find secret (%s)", name)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateDomain(domain *types.Domain) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	claims, err := getDomainClaims(tx, domain.Hostname, domain.PathPrefix)
+	if err != nil {
+		return err
+	}
+	for _, d := range claims {
+		if d.Blocks(domain.EndpointID, domain.Hostname, domain.PathPrefix, domain.CreatedAT) {
+			return fmt.Errorf("domain (%s%s) already exists", domain.Hostname, domain.PathPrefix)
+		}
+		if d.Expired(domain.CreatedAT) {
+			if _, err := tx.Exec("DELETE FROM domain WHERE id = $1", d.ID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.Exec(`
+INSERT INTO domain (id, endpoint_id, hostname, path_prefix, verification_token, verified, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		domain.ID,
+		domain.EndpointID,
+		domain.Hostname,
+		domain.PathPrefix,
+		domain.VerificationToken,
+		domain.Verified,
+		domain.CreatedAT)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getDomainClaims returns all domains, verified or not, with the given
+// hostname and path prefix.
+func getDomainClaims(tx *sql.Tx, hostname, pathPrefix string) ([]*types.Domain, error) {
+	rows, err := tx.Query("SELECT "+domainColumns+" FROM domain WHERE hostname = $1 AND path_prefix = $2", hostname, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []*types.Domain
+	for rows.Next() {
+		var domain types.Domain
+		if err := scanDomain(rows, &domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, &domain)
+	}
+	return domains, rows.Err()
+}
+
+func (s *SQLStore) GetDomain(id uuid.UUID) (*types.Domain, error) {
+	row := s.db.QueryRow("SELECT "+domainColumns+" FROM domain WHERE id = $1", id)
+	var domain types.Domain
+	if err := scanDomain(row, &domain); err != nil {
+		return nil, fmt.Errorf("could not find domain (%s)", id)
+	}
+	return &domain, nil
+}
+
+func (s *SQLStore) GetDomains(endpointID uuid.UUID) ([]*types.Domain, error) {
+	stmt := "SELECT " + domainColumns + " FROM domain"
+	args := []any{}
+	if endpointID != uuid.Nil {
+		stmt += " WHERE endpoint_id = $1"
+		args = append(args, endpointID)
+	}
+	rows, err := s.db.Query(stmt+" ORDER BY hostname, path_prefix", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []*types.Domain{}
+	for rows.Next() {
+		var domain types.Domain
+		if err := scanDomain(rows, &domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, &domain)
+	}
+	return domains, rows.Err()
+}
+
+func (s *SQLStore) VerifyDomain(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var domain types.Domain
+	row := tx.QueryRow("SELECT "+domainColumns+" FROM domain WHERE id = $1", id)
+	if err := scanDomain(row, &domain); err != nil {
+		return fmt.Errorf("could not find domain (%s)", id)
+	}
+	claims, err := getDomainClaims(tx, domain.Hostname, domain.PathPrefix)
+	if err != nil {
+		return err
+	}
+	for _, d := range claims {
+		if d.ID != id && d.Verified {
+			return fmt.Errorf("domain (%s%s) is already verified", domain.Hostname, domain.PathPrefix)
+		}
+	}
+	if _, err := tx.Exec("UPDATE domain SET verified = $1 WHERE id = $2", true, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteDomain(id uuid.UUID) error {
+	res, err := s.db.Exec("DELETE FROM domain WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find domain (%s)", id)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateAccount(account *types.Account) error {
+	_, err := s.db.Exec(`
+INSERT INTO account (id, name, monthly_invocations, monthly_compute_time, created_at)
+VALUES ($1, $2, $3, $4, $5)`,
+		account.ID,
+		account.Name,
+		account.Quota.MonthlyInvocations,
+		int64(account.Quota.MonthlyComputeTime),
+		account.CreatedAT)
+	return err
+}
+
+func (s *SQLStore) GetAccount(id uuid.UUID) (*types.Account, error) {
+	var account types.Account
+	row := s.db.QueryRow(`
+SELECT id, name, monthly_invocations, monthly_compute_time, created_at
+FROM account
+WHERE id = $1`, id)
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.Quota.MonthlyInvocations,
+		&account.Quota.MonthlyComputeTime,
+		&account.CreatedAT)
+	if err != nil {
+		return nil, fmt.Errorf("could not find account (%s)", id)
+	}
+	return &account, nil
+}
+
+func (s *SQLStore) SetAccountQuota(id uuid.UUID, quota types.Quota) error {
+	res, err := s.db.Exec("UPDATE account SET monthly_invocations = $1, monthly_compute_time = $2 WHERE id = $3",
+		quota.MonthlyInvocations,
+		int64(quota.MonthlyComputeTime),
+		id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find account (%s)", id)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateAPIToken(token *types.APIToken) error {
+	scopes, err := json.Marshal(token.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+INSERT INTO api_token (id, account_id, name, scopes, prefix, hash, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID,
+		token.AccountID,
+		token.Name,
+		scopes,
+		token.Prefix,
+		token.Hash,
+		token.CreatedAT)
+	return err
+}
+
+func (s *SQLStore) GetAPITokenByHash(hash []byte) (*types.APIToken, error) {
+	row := s.db.QueryRow("SELECT "+apiTokenColumns+" FROM api_token WHERE hash = $1", hash)
+	var token types.APIToken
+	if err := scanAPIToken(row, &token); err != nil {
+		return nil, fmt.Errorf("could not find api token")
+	}
+	return &token, nil
+}
+
+func (s *SQLStore) GetAPITokens(accountID uuid.UUID) ([]*types.APIToken, error) {
+	rows, err := s.db.Query("SELECT "+apiTokenColumns+" FROM api_token WHERE account_id = $1 ORDER BY created_at", accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*types.APIToken{}
+	for rows.Next() {
+		var token types.APIToken
+		if err := scanAPIToken(rows, &token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLStore) DeleteAPIToken(accountID, id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+DELETE FROM endpoint_role
+WHERE token_id IN (SELECT id FROM api_token WHERE account_id = $1 AND id = $2)`, accountID, id)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM api_token WHERE account_id = $1 AND id = $2", accountID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find api token (%s)", id)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) SetEndpointRole(role *types.EndpointRole) error {
+	_, err := s.db.Exec(`
+INSERT INTO endpoint_role (endpoint_id, token_id, role, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (endpoint_id, token_id) DO UPDATE SET role = excluded.role`,
+		role.EndpointID,
+		role.TokenID,
+		role.Role,
+		role.CreatedAT)
+	return err
+}
+
+func (s *SQLStore) GetEndpointRole(endpointID, tokenID uuid.UUID) (*types.EndpointRole, error) {
+	row := s.db.QueryRow(`
+SELECT endpoint_id, token_id, role, created_at
+FROM endpoint_role
+WHERE endpoint_id = $1 AND token_id = $2`, endpointID, tokenID)
+	var role types.EndpointRole
+	if err := row.Scan(&role.EndpointID, &role.TokenID, &role.Role, &role.CreatedAT); err != nil {
+		return nil, fmt.Errorf("could not find role of api token (%s) on endpoint (%s)", tokenID, endpointID)
+	}
+	return &role, nil
+}
+
+func (s *SQLStore) GetEndpointRoles(endpointID uuid.UUID) ([]*types.EndpointRole, error) {
+	rows, err := s.db.Query(`
+SELECT endpoint_id, token_id, role, created_at
+FROM endpoint_role
+WHERE endpoint_id = $1
+ORDER BY created_at`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*types.EndpointRole{}
+	for rows.Next() {
+		var role types.EndpointRole
+		if err := rows.Scan(&role.EndpointID, &role.TokenID, &role.Role, &role.CreatedAT); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *SQLStore) DeleteEndpointRole(endpointID, tokenID uuid.UUID) error {
+	res, err := s.db.Exec("DELETE FROM endpoint_role WHERE endpoint_id = $1 AND token_id = $2", endpointID, tokenID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("could not find role of api token (%s) on endpoint (%s)", tokenID, endpointID)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateAuditEvent(event *types.AuditEvent) error {
+	before, err := marshalAuditState(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalAuditState(event.After)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+INSERT INTO audit_event (id, account_id, actor, token_id, action, endpoint_id, target_id, detail, state_before, state_after, source_ip, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		event.ID,
+		nullUUID(event.AccountID),
+		event.Actor,
+		nullUUID(event.TokenID),
+		event.Action,
+		nullUUID(event.EndpointID),
+		nullUUID(event.TargetID),
+		event.Detail,
+		before,
+		after,
+		event.SourceIP,
+		event.CreatedAT)
+	return err
+}
+
+func (s *SQLStore) GetAuditEvents(filter AuditFilter, p Pagination) ([]*types.AuditEvent, error) {
+	query, args := buildAuditEventsQuery(filter, p)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*types.AuditEvent{}
+	for rows.Next() {
+		var (
+			event                 types.AuditEvent
+			accountID, tokenID    uuid.NullUUID
+			endpointID, targetID  uuid.NullUUID
+			beforeData, afterData []byte
+		)
+		err := rows.Scan(
+			&event.ID,
+			&accountID,
+			&event.Actor,
+			&tokenID,
+			&event.Action,
+			&endpointID,
+			&targetID,
+			&event.Detail,
+			&beforeData,
+			&afterData,
+			&event.SourceIP,
+			&event.CreatedAT)
+		if err != nil {
+			return nil, err
+		}
+		event.AccountID, event.TokenID = accountID.UUID, tokenID.UUID
+		event.EndpointID, event.TargetID = endpointID.UUID, targetID.UUID
+		if event.Before, err = unmarshalAuditState(beforeData); err != nil {
+			return nil, err
+		}
+		if event.After, err = unmarshalAuditState(afterData); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+func buildAuditEventsQuery(filter AuditFilter, p Pagination) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.AccountID != uuid.Nil {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("account_id = $%d", len(args)))
+	}
+	if filter.EndpointID != uuid.Nil {
+		args = append(args, filter.EndpointID)
+		conditions = append(conditions, fmt.Sprintf("endpoint_id = $%d", len(args)))
+	}
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		conditions = append(conditions, fmt.Sprintf("action = $%d", len(args)))
+	}
+
+	query := `
+SELECT id, account_id, actor, token_id, action, endpoint_id, target_id, detail, state_before, state_after, source_ip, created_at
+FROM audit_event`
+	if len(conditions) > 0 {
+		query += "\nWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\nORDER BY created_at DESC"
+	if p.Limit > 0 {
+		args = append(args, p.Limit, p.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	return query, args
+}
+
+// marshalAuditState returns the state as JSON, or nil when there is no
+// state so it is stored as NULL.
+func marshalAuditState(state *types.AuditState) (any, error) {
+	if state == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func unmarshalAuditState(b []byte) (*types.AuditState, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var state types.AuditState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func buildUpdateEndpointQuery(id uuid.UUID, params UpdateEndpointParams) (string, []any, error) {
 	var (
 		updates []string
 		args    []any
@@ -132,26 +1113,165 @@ func buildUpdateEndpointQuery(id uuid.UUID, params UpdateEndpointParams) (string
 
 	if params.ActiveDeployID.String() != "00000000-0000-0000-0000-000000000000" {
 		updates = append(updates, fmt.Sprintf("active_deployment_id = $%d", counter))
+		updates = append(updates, "traffic_split = NULL")
 		args = append(args, params.ActiveDeployID)
 		counter++
 	}
+	if params.Name != "" {
+		updates = append(updates, fmt.Sprintf("name = $%d", counter))
+		args = append(args, params.Name)
+		counter++
+	}
+	if params.Slug != "" {
+		updates = append(updates, fmt.Sprintf("slug = $%d", counter))
+		args = append(args, params.Slug)
+		counter++
+	}
 	if params.Environment != nil {
 		b, err := json.Marshal(params.Environment)
 		if err != nil {
-			panic(err)
+			return "", nil, err
 		}
 		updates = append(updates, fmt.Sprintf("environment = $%d", counter))
 		args = append(args, b)
 		counter++
 	}
+	if limits := params.RateLimits; limits != nil {
+		updates = append(updates,
+			fmt.Sprintf("rate_limit = $%d", counter),
+			fmt.Sprintf("rate_limit_burst = $%d", counter+1),
+			fmt.Sprintf("client_rate_limit = $%d", counter+2),
+			fmt.Sprintf("client_rate_limit_burst = $%d", counter+3))
+		args = append(args, limits.Endpoint.Rate, limits.Endpoint.Burst, limits.Client.Rate, limits.Client.Burst)
+		counter += 4
+	}
+	if concurrency := params.Concurrency; concurrency != nil {
+		updates = append(updates,
+			fmt.Sprintf("max_concurrent = $%d", counter),
+			fmt.Sprintf("max_queue = $%d", counter+1),
+			fmt.Sprintf("queue_timeout = $%d", counter+2))
+		args = append(args, concurrency.MaxConcurrent, concurrency.MaxQueue, int64(concurrency.QueueTimeout))
+		counter += 3
+	}
 	args = append(args, id)
 
 	setClause := strings.Join(updates, ", ")
 	query := fmt.Sprintf("UPDATE endpoint SET %s WHERE id = $%d", setClause, counter)
 
+	return query, args, nil
+}
+
+func buildRuntimeMetricsQuery(id uuid.UUID, filter MetricFilter) (string, []any) {
+	conditions, args := runtimeMetricConditions(id, filter)
+	query := fmt.Sprintf(`
+SELECT id, endpoint_id, deployment_id, request_url, duration, start_time, status_code
+FROM runtime_metric
+WHERE %s
+ORDER BY start_time DESC`, strings.Join(conditions, " AND "))
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+// runtimeMetricConditions returns the conditions of the WHERE clause that
+// select the metrics of the endpoint that pass the filter, ignoring its limit.
+func runtimeMetricConditions(id uuid.UUID, filter MetricFilter) ([]string, []any) {
+	var (
+		conditions = []string{"endpoint_id = $1"}
+		args       = []any{id}
+	)
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UTC())
+		conditions = append(conditions, fmt.Sprintf("start_time >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UTC())
+		conditions = append(conditions, fmt.Sprintf("start_time < $%d", len(args)))
+	}
+	if filter.DeploymentID != uuid.Nil {
+		args = append(args, filter.DeploymentID)
+		conditions = append(conditions, fmt.Sprintf("deployment_id = $%d", len(args)))
+	}
+	if filter.StatusCode != 0 {
+		args = append(args, filter.StatusCode)
+		conditions = append(conditions, fmt.Sprintf("status_code = $%d", len(args)))
+	}
+	return conditions, args
+}
+
+func buildRuntimeLogsQuery(id uuid.UUID, filter LogFilter) (string, []any) {
+	var (
+		conditions = []string{"endpoint_id = $1"}
+		args       = []any{id}
+		order      = "DESC"
+	)
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UTC())
+		conditions = append(conditions, fmt.Sprintf("logged_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UTC())
+		conditions = append(conditions, fmt.Sprintf("logged_at < $%d", len(args)))
+	}
+	if filter.DeploymentID != uuid.Nil {
+		args = append(args, filter.DeploymentID)
+		conditions = append(conditions, fmt.Sprintf("deployment_id = $%d", len(args)))
+	}
+	if filter.RequestID != "" {
+		args = append(args, filter.RequestID)
+		conditions = append(conditions, fmt.Sprintf("request_id = $%d", len(args)))
+	}
+	if filter.Stream != "" {
+		args = append(args, filter.Stream)
+		conditions = append(conditions, fmt.Sprintf("stream = $%d", len(args)))
+	}
+	if filter.AfterSeq > 0 {
+		args = append(args, filter.AfterSeq)
+		conditions = append(conditions, fmt.Sprintf("seq > $%d", len(args)))
+		order = "ASC"
+	}
+
+	query := fmt.Sprintf(`
+SELECT seq, endpoint_id, deployment_id, request_id, stream, line, logged_at
+FROM runtime_log
+WHERE %s
+ORDER BY seq %s`, strings.Join(conditions, " AND "), order)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
 	return query, args
 }
 
+func scanRuntimeLog(s Scanner, l *types.RuntimeLog) error {
+	return s.Scan(
+		&l.Seq,
+		&l.EndpointID,
+		&l.DeploymentID,
+		&l.RequestID,
+		&l.Stream,
+		&l.Line,
+		&l.Time,
+	)
+}
+
+func scanRuntimeMetric(s Scanner, m *types.RuntimeMetric) error {
+	var duration int64
+	err := s.Scan(
+		&m.ID,
+		&m.EndpointID,
+		&m.DeploymentID,
+		&m.RequestURL,
+		&duration,
+		&m.StartTime,
+		&m.StatusCode,
+	)
+	m.Duration = time.Duration(duration)
+	return err
+}
+
 func scanDeploy(s Scanner, d *types.Deployment) error {
 	return s.Scan(
 		&d.ID,
@@ -162,39 +1282,85 @@ func scanDeploy(s Scanner, d *types.Deployment) error {
 	)
 }
 
+// nullUUID returns an invalid NullUUID for uuid.Nil, so optional references
+// are stored as NULL.
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// nullString returns nil for an empty string, so optional unique columns are
+// stored as NULL.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func scanAPIToken(s Scanner, t *types.APIToken) error {
+	var scopes []byte
+	err := s.Scan(
+		&t.ID,
+		&t.AccountID,
+		&t.Name,
+		&scopes,
+		&t.Prefix,
+		&t.Hash,
+		&t.CreatedAT)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(scopes, &t.Scopes)
+}
+
+func scanDomain(s Scanner, d *types.Domain) error {
+	return s.Scan(
+		&d.ID,
+		&d.EndpointID,
+		&d.Hostname,
+		&d.PathPrefix,
+		&d.VerificationToken,
+		&d.Verified,
+		&d.CreatedAT)
+}
+
 func scanEndpoint(s Scanner, e *types.Endpoint) error {
-	var envData []byte
+	var (
+		envData, splitData []byte
+		slug               sql.NullString
+		accountID          uuid.NullUUID
+	)
 	err := s.Scan(
 		&e.ID,
 		&e.Name,
+		&slug,
+		&accountID,
 		&e.Runtime,
 		&envData,
-		&e.CreatedAT,
 		&e.ActiveDeploymentID,
+		&e.Limits.MaxMemoryPages,
+		&e.Limits.Timeout,
+		&e.Limits.MaxCalls,
+		&e.RateLimits.Endpoint.Rate,
+		&e.RateLimits.Endpoint.Burst,
+		&e.RateLimits.Client.Rate,
+		&e.RateLimits.Client.Burst,
+		&e.Concurrency.MaxConcurrent,
+		&e.Concurrency.MaxQueue,
+		&e.Concurrency.QueueTimeout,
+		&splitData,
+		&e.CreatedAT,
 	)
 	if err != nil {
 		return err
 	}
+	e.Slug = slug.String
+	e.AccountID = accountID.UUID
+	if len(splitData) > 0 {
+		e.TrafficSplit = &types.TrafficSplit{}
+		if err := json.Unmarshal(splitData, e.TrafficSplit); err != nil {
+			return err
+		}
+	}
 	return json.Unmarshal(envData, &e.Environment)
 }
-
-var createAllTablesQuery = `
-CREATE TABLE if not exists endpoint (
-	id UUID primary key, 
-	name text not null,
-	runtime text not null,
-	environment jsonb,
-	created_at timestamp not null default now()
-);
-
-CREATE TABLE if not exists deployment (
-	id UUID primary key, 
-	endpoint_id UUID not null references endpoint,
-	hash text not null,
-	blob bytea not null,
-	created_at timestamp not null default now()
-);
-
-ALTER table endpoint
-ADD COLUMN if not exists active_deployment_id UUID references deployment
-`
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// NewSQLiteStore returns a SQLStore that is backed by a single SQLite database
+// file located at the given path. The file is created when it does not exist.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLStore(db, DialectSQLite)
+}
+
+// openSQLite opens the database with immediate transactions, so that every
+// transaction takes the write lock up front instead of failing halfway when
+// the api server and the wasm server write to the same file.
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	return sql.Open("sqlite", dsn)
+}
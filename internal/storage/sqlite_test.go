@@ -0,0 +1,1073 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthdm/raptor/internal/types"
+	"github.com/google/uuid"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "raptor.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+func TestSQLiteStoreEndpoint(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	endpoint := types.NewEndpoint("my endpoint", "js", map[string]string{"FOO": "bar"})
+	endpoint.Limits = types.Limits{MaxMemoryPages: 64, Timeout: time.Second, MaxCalls: 1000}
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != endpoint.ID || e.Name != endpoint.Name || e.Runtime != "js" {
+		t.Fatalf("unexpected endpoint: %+v", e)
+	}
+	if e.Limits != endpoint.Limits {
+		t.Fatalf("expected limits %+v got %+v", endpoint.Limits, e.Limits)
+	}
+	if e.Environment["FOO"] != "bar" {
+		t.Fatalf("expected env FOO=bar got %v", e.Environment)
+	}
+	if e.HasActiveDeploy() {
+		t.Fatal("expected endpoint to have no active deployment")
+	}
+	endpoints, err := store.GetEndpoints(uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 {
+		t.Fatalf("expected 1 endpoint got %d", len(endpoints))
+	}
+}
+
+func TestSQLiteStoreDeployment(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	deploy := types.NewDeployment(endpoint, []byte{0x00, 0x61, 0x73, 0x6d})
+	if err := store.CreateDeployment(deploy); err != nil {
+		t.Fatal(err)
+	}
+	d, err := store.GetDeployment(deploy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Hash != deploy.Hash || string(d.Blob) != string(deploy.Blob) {
+		t.Fatalf("unexpected deployment: %+v", d)
+	}
+
+	err = store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{
+		ActiveDeployID: deploy.ID,
+		Environment:    map[string]string{"A": "B"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ActiveDeploymentID != deploy.ID {
+		t.Fatalf("expected active deployment %s got %s", deploy.ID, e.ActiveDeploymentID)
+	}
+	if e.Environment["A"] != "B" {
+		t.Fatalf("expected env A=B got %v", e.Environment)
+	}
+
+	err = store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{
+		Name:        "renamed endpoint",
+		Environment: map[string]string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err = store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "renamed endpoint" {
+		t.Fatalf("expected name %s got %s", "renamed endpoint", e.Name)
+	}
+	if len(e.Environment) != 0 {
+		t.Fatalf("expected empty env got %v", e.Environment)
+	}
+	if e.ActiveDeploymentID != deploy.ID {
+		t.Fatalf("expected active deployment %s to be kept got %s", deploy.ID, e.ActiveDeploymentID)
+	}
+}
+
+func TestSQLiteStoreDeploymentHistory(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	first := types.NewDeployment(endpoint, []byte("first"))
+	second := types.NewDeployment(endpoint, []byte("second"))
+	second.CreatedAT = first.CreatedAT.Add(time.Second)
+	for _, deploy := range []*types.Deployment{first, second} {
+		if err := store.CreateDeployment(deploy); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{ActiveDeployID: deploy.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := store.GetDeploymentHistory(endpoint.ID, Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 deployments in history got %d", len(history))
+	}
+	latest, previous := history[0], history[1]
+	if latest.ID != second.ID || !latest.Active || latest.PublishedAT == nil || latest.UnpublishedAT != nil {
+		t.Fatalf("unexpected latest deployment history: %+v", latest)
+	}
+	if previous.ID != first.ID || previous.Active || previous.UnpublishedAT == nil {
+		t.Fatalf("unexpected previous deployment history: %+v", previous)
+	}
+	if !previous.UnpublishedAT.Equal(*latest.PublishedAT) {
+		t.Fatalf("expected previous deployment to be unpublished when the latest got published")
+	}
+
+	page, err := store.GetDeploymentHistory(endpoint.ID, Pagination{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != first.ID {
+		t.Fatalf("unexpected page: %v", page)
+	}
+
+	publications, err := store.GetPublications(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(publications) != 2 || publications[0].DeploymentID != first.ID || publications[1].DeploymentID != second.ID {
+		t.Fatalf("expected the publications oldest first got %+v", publications)
+	}
+}
+
+func TestSQLiteStoreRuntimeMetrics(t *testing.T) {
+	var (
+		store        = newTestSQLiteStore(t)
+		endpointID   = uuid.New()
+		deploymentID = uuid.New()
+		start        = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		metrics      []types.RuntimeMetric
+	)
+	for i := 0; i < 10; i++ {
+		status := http.StatusOK
+		if i%5 == 0 {
+			status = http.StatusInternalServerError
+		}
+		metrics = append(metrics, types.RuntimeMetric{
+			ID:           uuid.New(),
+			EndpointID:   endpointID,
+			DeploymentID: deploymentID,
+			RequestURL:   "/",
+			Duration:     time.Duration(i) * time.Millisecond,
+			StartTime:    start.Add(time.Duration(i) * time.Minute),
+			StatusCode:   status,
+		})
+	}
+	if err := store.CreateRuntimeMetrics(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := store.GetRuntimeMetrics(endpointID, MetricFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 10 {
+		t.Fatalf("expected 10 metrics got %d", len(all))
+	}
+	if all[0].ID != metrics[9].ID || all[0].Duration != metrics[9].Duration {
+		t.Fatalf("expected newest metric first got %+v", all[0])
+	}
+
+	filters := map[string]struct {
+		filter   MetricFilter
+		expected int
+	}{
+		"time range":  {MetricFilter{From: start.Add(2 * time.Minute), To: start.Add(5 * time.Minute)}, 3},
+		"status code": {MetricFilter{StatusCode: http.StatusInternalServerError}, 2},
+		"deployment":  {MetricFilter{DeploymentID: uuid.New()}, 0},
+		"limit":       {MetricFilter{Limit: 4}, 4},
+	}
+	for name, tc := range filters {
+		metrics, err := store.GetRuntimeMetrics(endpointID, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) != tc.expected {
+			t.Errorf("%s: expected %d metrics got %d", name, tc.expected, len(metrics))
+		}
+	}
+
+	counts, err := store.GetRuntimeMetricCounts(endpointID, MetricFilter{From: start.Add(time.Minute), Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Count != 9 || counts.Errors != 1 {
+		t.Fatalf("expected 9 metrics with 1 error got %+v", counts)
+	}
+}
+
+func TestSQLiteStoreRuntimeMetricsSummary(t *testing.T) {
+	testMetricsSummary(t, newTestSQLiteStore(t))
+}
+
+// testMetricsSummary tests that the given empty metric store aggregates the
+// same summary as types.SummarizeMetrics.
+func testMetricsSummary(t *testing.T, store MetricStore) {
+	t.Helper()
+	var (
+		endpointID = uuid.New()
+		deployA    = uuid.New()
+		deployB    = uuid.New()
+		from       = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		to         = from.Add(2 * time.Minute)
+		metrics    []types.RuntimeMetric
+	)
+	for i := 1; i <= 100; i++ {
+		status := http.StatusOK
+		if i > 90 {
+			status = http.StatusInternalServerError
+		}
+		metrics = append(metrics, types.RuntimeMetric{
+			ID:           uuid.New(),
+			EndpointID:   endpointID,
+			DeploymentID: deployA,
+			Duration:     time.Duration(101-i) * time.Millisecond,
+			StartTime:    from.Add(time.Duration(i)*time.Second + 250*time.Millisecond),
+			StatusCode:   status,
+		})
+	}
+	metrics = append(metrics,
+		// On the start of the second bucket.
+		types.RuntimeMetric{ID: uuid.New(), EndpointID: endpointID, DeploymentID: deployB, StartTime: from.Add(time.Minute), StatusCode: http.StatusNotFound},
+		types.RuntimeMetric{ID: uuid.New(), EndpointID: endpointID, DeploymentID: deployB, StartTime: to, StatusCode: http.StatusOK},
+	)
+	if err := store.CreateRuntimeMetrics(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := store.GetRuntimeMetricsSummary(endpointID, MetricFilter{From: from, To: to}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(summary)
+	want, _ := json.Marshal(types.SummarizeMetrics(endpointID, metrics, from, to, time.Minute))
+	if string(got) != string(want) {
+		t.Fatalf("expected summary\n%s\ngot\n%s", want, got)
+	}
+	if summary.Total.Count != 101 || summary.Deployments[1].Buckets[1].Count != 1 {
+		t.Fatalf("unexpected summary %s", got)
+	}
+
+	empty, err := store.GetRuntimeMetricsSummary(uuid.New(), MetricFilter{From: from, To: to}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Total.Count != 0 || len(empty.Deployments) != 0 {
+		t.Fatalf("expected an empty summary got %+v", empty)
+	}
+}
+
+func TestSQLiteStoreRuntimeLogs(t *testing.T) {
+	testLogStore(t, newTestSQLiteStore(t))
+}
+
+// testLogStore tests the filters, the ordering, the follow cursor and the
+// retention of the given empty log store.
+func testLogStore(t *testing.T, store LogStore) {
+	t.Helper()
+	var (
+		endpointID = uuid.New()
+		start      = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		logs       []types.RuntimeLog
+	)
+	for i := 0; i < 10; i++ {
+		stream := types.LogStreamStdout
+		if i%2 == 0 {
+			stream = types.LogStreamStderr
+		}
+		logs = append(logs, types.RuntimeLog{
+			EndpointID:   endpointID,
+			DeploymentID: uuid.New(),
+			RequestID:    fmt.Sprintf("request-%d", i/5),
+			Stream:       stream,
+			Line:         fmt.Sprintf("line %d", i),
+			Time:         start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	if err := store.CreateRuntimeLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	newest, err := store.GetRuntimeLogs(endpointID, LogFilter{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newest) != 3 || newest[0].Line != "line 7" || newest[2].Line != "line 9" {
+		t.Fatalf("expected the newest 3 logs oldest first got %+v", newest)
+	}
+	following, err := store.GetRuntimeLogs(endpointID, LogFilter{AfterSeq: newest[0].Seq, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(following) != 1 || following[0].Line != "line 8" {
+		t.Fatalf("expected the log after the cursor got %+v", following)
+	}
+
+	filters := map[string]struct {
+		filter   LogFilter
+		expected int
+	}{
+		"time range": {LogFilter{From: start.Add(2 * time.Minute), To: start.Add(5 * time.Minute)}, 3},
+		"stream":     {LogFilter{Stream: types.LogStreamStderr}, 5},
+		"request":    {LogFilter{RequestID: "request-1"}, 5},
+		"deployment": {LogFilter{DeploymentID: logs[3].DeploymentID}, 1},
+	}
+	for name, tc := range filters {
+		logs, err := store.GetRuntimeLogs(endpointID, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != tc.expected {
+			t.Errorf("%s: expected %d logs got %d", name, tc.expected, len(logs))
+		}
+	}
+
+	if err := store.DeleteRuntimeLogs(start.Add(4 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := store.GetRuntimeLogs(endpointID, LogFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 6 || kept[0].Line != "line 4" {
+		t.Fatalf("expected the logs before the retention to be deleted got %+v", kept)
+	}
+}
+
+func TestSQLiteStoreDelete(t *testing.T) {
+	testDelete(t, newTestSQLiteStore(t))
+}
+
+// testDelete tests that deleting deployments and endpoints of the given empty
+// backend cascades to everything that belongs to them.
+func testDelete(t *testing.T, store Backend) {
+	t.Helper()
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	var deploys []*types.Deployment
+	for i := 0; i < 2; i++ {
+		deploy := types.NewDeployment(endpoint, []byte(fmt.Sprintf("blob %d", i)))
+		if err := store.CreateDeployment(deploy); err != nil {
+			t.Fatal(err)
+		}
+		err := store.CreateRuntimeMetrics([]types.RuntimeMetric{{
+			ID:           uuid.New(),
+			EndpointID:   endpoint.ID,
+			DeploymentID: deploy.ID,
+			StartTime:    time.Now(),
+			StatusCode:   http.StatusOK,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.CreateRuntimeLogs([]types.RuntimeLog{{
+			EndpointID:   endpoint.ID,
+			DeploymentID: deploy.ID,
+			Stream:       types.LogStreamStdout,
+			Time:         time.Now(),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deploys = append(deploys, deploy)
+	}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{ActiveDeployID: deploys[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutSecret(&types.Secret{EndpointID: endpoint.ID, Name: "A", Value: []byte("B")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteDeployment(deploys[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetDeployment(deploys[0].ID); err == nil {
+		t.Fatal("expected the deployment to be deleted")
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.HasActiveDeploy() {
+		t.Fatal("expected the endpoint to have no active deployment")
+	}
+	metrics, err := store.GetRuntimeMetrics(endpoint.ID, MetricFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].DeploymentID != deploys[1].ID {
+		t.Fatalf("expected only the metrics of the remaining deployment got %+v", metrics)
+	}
+
+	if err := store.DeleteEndpoint(endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetEndpoint(endpoint.ID); err == nil {
+		t.Fatal("expected the endpoint to be deleted")
+	}
+	if _, err := store.GetDeployment(deploys[1].ID); err == nil {
+		t.Fatal("expected the deployments of the endpoint to be deleted")
+	}
+	logs, err := store.GetRuntimeLogs(endpoint.ID, LogFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("expected the logs of the endpoint to be deleted got %d", len(logs))
+	}
+	secrets, err := store.GetSecrets(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Fatalf("expected the secrets of the endpoint to be deleted got %d", len(secrets))
+	}
+	if err := store.DeleteEndpoint(endpoint.ID); err == nil {
+		t.Fatal("expected an error when deleting an unknown endpoint")
+	}
+}
+
+func TestSQLiteStoreSecrets(t *testing.T) {
+	testSecretStore(t, newTestSQLiteStore(t))
+}
+
+// testSecretStore tests the secrets of the given empty backend.
+func testSecretStore(t *testing.T, store Backend) {
+	t.Helper()
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"B", "A"} {
+		secret := &types.Secret{EndpointID: endpoint.ID, Name: name, Value: []byte("first")}
+		if err := store.PutSecret(secret); err != nil {
+			t.Fatal(err)
+		}
+		if secret.Version != 1 {
+			t.Fatalf("expected version 1 got %d", secret.Version)
+		}
+	}
+	secret := &types.Secret{EndpointID: endpoint.ID, Name: "A", Value: []byte("second")}
+	if err := store.PutSecret(secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.Version != 2 {
+		t.Fatalf("expected version 2 got %d", secret.Version)
+	}
+	secret.Value = []byte("reencrypted")
+	if err := store.UpdateSecretValue(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := store.GetSecrets(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 2 || secrets[0].Name != "A" || secrets[1].Name != "B" {
+		t.Fatalf("expected secrets A and B ordered by name got %+v", secrets)
+	}
+	if string(secrets[0].Value) != "reencrypted" || secrets[0].Version != 2 {
+		t.Fatalf("unexpected secret: %+v", secrets[0])
+	}
+	if secrets[0].CreatedAT.After(secrets[0].UpdatedAT) {
+		t.Fatalf("expected the secret to be created before it was updated: %+v", secrets[0])
+	}
+
+	if err := store.DeleteSecret(endpoint.ID, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteSecret(endpoint.ID, "B"); err == nil {
+		t.Fatal("expected an error when deleting an unknown secret")
+	}
+	secrets, err = store.GetSecrets(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 {
+		t.Fatalf("expected 1 secret got %d", len(secrets))
+	}
+}
+
+func TestSQLiteStoreTrafficSplit(t *testing.T) {
+	testTrafficSplit(t, newTestSQLiteStore(t))
+}
+
+// testTrafficSplit tests the traffic split of an endpoint of the given empty
+// backend.
+func testTrafficSplit(t *testing.T, store Backend) {
+	t.Helper()
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	stable := types.NewDeployment(endpoint, []byte("stable"))
+	canary := types.NewDeployment(endpoint, []byte("canary"))
+	for _, deploy := range []*types.Deployment{stable, canary} {
+		if err := store.CreateDeployment(deploy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{ActiveDeployID: stable.ID}); err != nil {
+		t.Fatal(err)
+	}
+	split := &types.TrafficSplit{
+		Routes: []types.TrafficRoute{
+			{DeploymentID: stable.ID, Weight: 90},
+			{DeploymentID: canary.ID, Weight: 10},
+		},
+		Canary: &types.CanaryPolicy{
+			DeploymentID: canary.ID,
+			MaxErrorRate: 0.05,
+			Duration:     time.Minute,
+		},
+		CreatedAT: time.Now().UTC(),
+	}
+	if err := store.SetTrafficSplit(endpoint.ID, split); err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrafficSplit == nil || len(e.TrafficSplit.Routes) != 2 || e.TrafficSplit.Canary.DeploymentID != canary.ID {
+		t.Fatalf("unexpected traffic split: %+v", e.TrafficSplit)
+	}
+
+	// Publishing a deployment routes all traffic to it.
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{ActiveDeployID: canary.ID}); err != nil {
+		t.Fatal(err)
+	}
+	e, err = store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrafficSplit != nil {
+		t.Fatalf("expected publishing to remove the traffic split got %+v", e.TrafficSplit)
+	}
+
+	if err := store.SetTrafficSplit(endpoint.ID, split); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetTrafficSplit(endpoint.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	e, err = store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrafficSplit != nil {
+		t.Fatalf("expected the traffic split to be removed got %+v", e.TrafficSplit)
+	}
+	if err := store.SetTrafficSplit(uuid.New(), split); err == nil {
+		t.Fatal("expected an error for an unknown endpoint")
+	}
+}
+
+func TestSQLiteStoreDomains(t *testing.T) {
+	testDomainStore(t, newTestSQLiteStore(t))
+}
+
+func testDomainStore(t *testing.T, store Backend) {
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	site := types.NewDomain(endpoint.ID, "example.com", "")
+	api := types.NewDomain(endpoint.ID, "example.com", "/api")
+	for _, domain := range []*types.Domain{api, site} {
+		if err := store.CreateDomain(domain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateDomain(types.NewDomain(endpoint.ID, "example.com", "/api")); err == nil {
+		t.Fatal("expected an error when claiming a claimed domain")
+	}
+	if err := store.CreateDomain(types.NewDomain(uuid.New(), "other.com", "")); err == nil {
+		t.Fatal("expected an error for an unknown endpoint")
+	}
+
+	// The unverified claims of different endpoints coexist until one of
+	// them is verified.
+	other := types.NewEndpoint("other endpoint", "go", nil)
+	if err := store.CreateEndpoint(other); err != nil {
+		t.Fatal(err)
+	}
+	squatter := types.NewDomain(other.ID, "example.com", "/api")
+	if err := store.CreateDomain(squatter); err != nil {
+		t.Fatalf("expected an unverified claim not to block another endpoint: %v", err)
+	}
+	stale := types.NewDomain(other.ID, "stale.com", "")
+	stale.CreatedAT = time.Now().Add(-types.DomainClaimTTL - time.Hour)
+	if err := store.CreateDomain(stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateDomain(types.NewDomain(other.ID, "stale.com", "")); err != nil {
+		t.Fatalf("expected an expired claim to be replaced: %v", err)
+	}
+	if _, err := store.GetDomain(stale.ID); err == nil {
+		t.Fatal("expected the expired claim to be deleted")
+	}
+
+	if err := store.VerifyDomain(api.ID); err != nil {
+		t.Fatal(err)
+	}
+	d, err := store.GetDomain(api.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Verified || d.PathPrefix != "/api" || d.VerificationToken != api.VerificationToken {
+		t.Fatalf("unexpected domain: %+v", d)
+	}
+	if err := store.VerifyDomain(squatter.ID); err == nil {
+		t.Fatal("expected an error when verifying a verified domain of another endpoint")
+	}
+	if err := store.CreateDomain(types.NewDomain(other.ID, "example.com", "/api")); err == nil {
+		t.Fatal("expected an error when claiming a verified domain")
+	}
+	domains, err := store.GetDomains(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 2 || domains[0].ID != site.ID || domains[1].ID != api.ID {
+		t.Fatalf("expected the domains ordered by path prefix got %+v", domains)
+	}
+
+	if err := store.DeleteDomain(site.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteDomain(site.ID); err == nil {
+		t.Fatal("expected an error when deleting a deleted domain")
+	}
+	if err := store.DeleteEndpoint(endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	domains, err = store.GetDomains(uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 2 {
+		t.Fatalf("expected the domains of the other endpoint to be kept got %d", len(domains))
+	}
+	if err := store.DeleteEndpoint(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	domains, err = store.GetDomains(uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 0 {
+		t.Fatalf("expected the domains to be deleted with the endpoint got %d", len(domains))
+	}
+}
+
+func TestSQLiteStoreEndpointSlug(t *testing.T) {
+	testEndpointSlug(t, newTestSQLiteStore(t))
+}
+
+func testEndpointSlug(t *testing.T, store Backend) {
+	endpoint := types.NewEndpoint("my endpoint", "go", nil)
+	endpoint.Slug = "my-endpoint"
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	// Endpoints without a slug do not conflict with each other.
+	for i := 0; i < 2; i++ {
+		if err := store.CreateEndpoint(types.NewEndpoint("my endpoint", "go", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := types.NewEndpoint("other endpoint", "go", nil)
+	other.Slug = "my-endpoint"
+	if err := store.CreateEndpoint(other); err == nil {
+		t.Fatal("expected an error when creating an endpoint with a taken slug")
+	}
+
+	e, err := store.GetEndpointBySlug("my-endpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != endpoint.ID || e.Slug != "my-endpoint" {
+		t.Fatalf("unexpected endpoint: %+v", e)
+	}
+	if _, err := store.GetEndpointBySlug("unknown"); err == nil {
+		t.Fatal("expected an error for an unknown slug")
+	}
+
+	other.Slug = "other-endpoint"
+	if err := store.CreateEndpoint(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateEndpoint(other.ID, UpdateEndpointParams{Slug: "my-endpoint"}); err == nil {
+		t.Fatal("expected an error when updating to a taken slug")
+	}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{Slug: "renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetEndpointBySlug("renamed"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStoreEndpointEnvironment(t *testing.T) {
+	testEndpointEnvironment(t, newTestSQLiteStore(t))
+}
+
+func testEndpointEnvironment(t *testing.T, store Backend) {
+	endpoint := types.NewEndpoint("my endpoint", "go", map[string]string{"FOO": "bar", "OLD": "value"})
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	// Concurrent merges of different variables do not overwrite each other.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{
+				SetEnvironment: map[string]string{fmt.Sprintf("KEY_%d", i): "value"},
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{
+		SetEnvironment:   map[string]string{"FOO": "baz"},
+		UnsetEnvironment: []string{"OLD"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Environment) != 11 || e.Environment["FOO"] != "baz" || e.Environment["KEY_9"] != "value" {
+		t.Fatalf("unexpected environment: %+v", e.Environment)
+	}
+	if _, ok := e.Environment["OLD"]; ok {
+		t.Fatal("expected the unset variable to be removed")
+	}
+
+	if err := store.UpdateEndpoint(uuid.New(), UpdateEndpointParams{SetEnvironment: map[string]string{"FOO": "bar"}}); err == nil {
+		t.Fatal("expected an error for an unknown endpoint")
+	}
+}
+
+func TestSQLiteStoreAccounts(t *testing.T) {
+	testAccountStore(t, newTestSQLiteStore(t))
+}
+
+func testAccountStore(t *testing.T, store Backend) {
+	account := types.NewAccount("acme")
+	if err := store.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	a, err := store.GetAccount(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "acme" {
+		t.Fatalf("unexpected account: %+v", a)
+	}
+	if _, err := store.GetAccount(uuid.New()); err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+
+	owned := types.NewEndpoint("owned", "go", nil)
+	owned.AccountID = account.ID
+	for _, endpoint := range []*types.Endpoint{owned, types.NewEndpoint("unowned", "go", nil)} {
+		if err := store.CreateEndpoint(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	endpoints, err := store.GetEndpoints(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != owned.ID || endpoints[0].AccountID != account.ID {
+		t.Fatalf("expected only the endpoint of the account got %+v", endpoints)
+	}
+	if endpoints, _ := store.GetEndpoints(uuid.Nil); len(endpoints) != 2 {
+		t.Fatalf("expected the endpoints of all accounts got %d", len(endpoints))
+	}
+
+	token, secret := types.NewAPIToken(account.ID, "ci", []string{types.ScopeRead, types.ScopeDeploy})
+	if err := store.CreateAPIToken(token); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := types.NewAPIToken(uuid.New(), "ci", []string{types.ScopeRead})
+	if err := store.CreateAPIToken(other); err == nil {
+		t.Fatal("expected an error for a token of an unknown account")
+	}
+	tok, err := store.GetAPITokenByHash(types.HashAPIToken(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ID != token.ID || tok.AccountID != account.ID || len(tok.Scopes) != 2 || tok.Scopes[1] != types.ScopeDeploy {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+	tokens, err := store.GetAPITokens(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Fatalf("expected 1 token got %+v", tokens)
+	}
+	if err := store.DeleteAPIToken(uuid.New(), token.ID); err == nil {
+		t.Fatal("expected an error when revoking the token of another account")
+	}
+	if err := store.DeleteAPIToken(account.ID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetAPITokenByHash(types.HashAPIToken(secret)); err == nil {
+		t.Fatal("expected a revoked token to not be found")
+	}
+}
+
+func TestSQLiteStoreEndpointRoles(t *testing.T) {
+	testEndpointRoles(t, newTestSQLiteStore(t))
+}
+
+func testEndpointRoles(t *testing.T, store Backend) {
+	account := types.NewAccount("acme")
+	if err := store.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := types.NewEndpoint("roles", "go", nil)
+	endpoint.AccountID = account.ID
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := types.NewAPIToken(account.ID, "dev", []string{types.ScopeDeploy})
+	release, _ := types.NewAPIToken(account.ID, "release", []string{types.ScopePublish})
+	for _, token := range []*types.APIToken{dev, release} {
+		if err := store.CreateAPIToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.SetEndpointRole(types.NewEndpointRole(uuid.New(), dev.ID, types.RoleViewer)); err == nil {
+		t.Fatal("expected an error for a role on an unknown endpoint")
+	}
+	if err := store.SetEndpointRole(types.NewEndpointRole(endpoint.ID, dev.ID, types.RoleViewer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetEndpointRole(types.NewEndpointRole(endpoint.ID, release.ID, types.RoleReleaser)); err != nil {
+		t.Fatal(err)
+	}
+	// Setting the role again replaces the previous one.
+	if err := store.SetEndpointRole(types.NewEndpointRole(endpoint.ID, dev.ID, types.RoleDeveloper)); err != nil {
+		t.Fatal(err)
+	}
+	role, err := store.GetEndpointRole(endpoint.ID, dev.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.Role != types.RoleDeveloper {
+		t.Fatalf("expected role %s got %s", types.RoleDeveloper, role.Role)
+	}
+	roles, err := store.GetEndpointRoles(endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 || roles[0].TokenID != dev.ID || roles[1].Role != types.RoleReleaser {
+		t.Fatalf("unexpected roles: %+v", roles)
+	}
+
+	if err := store.DeleteAPIToken(account.ID, release.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetEndpointRole(endpoint.ID, release.ID); err == nil {
+		t.Fatal("expected the role of a revoked token to be deleted")
+	}
+	if err := store.DeleteEndpointRole(endpoint.ID, dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteEndpointRole(endpoint.ID, dev.ID); err == nil {
+		t.Fatal("expected an error when deleting an unknown role")
+	}
+	if err := store.SetEndpointRole(types.NewEndpointRole(endpoint.ID, dev.ID, types.RoleOwner)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteEndpoint(endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _ := store.GetEndpointRoles(endpoint.ID); len(roles) != 0 {
+		t.Fatalf("expected the roles of a deleted endpoint to be deleted got %d", len(roles))
+	}
+}
+
+func TestSQLiteStoreAudit(t *testing.T) {
+	testAuditStore(t, newTestSQLiteStore(t))
+}
+
+func testAuditStore(t *testing.T, store Backend) {
+	var (
+		accountID  = uuid.New()
+		endpointID = uuid.New()
+		deployID   = uuid.New()
+		start      = time.Now().UTC().Truncate(time.Millisecond)
+	)
+	events := []*types.AuditEvent{
+		{Action: types.AuditEndpointCreate, AccountID: accountID, EndpointID: endpointID, After: &types.AuditState{EnvKeys: []string{"FOO"}}},
+		{Action: types.AuditDeployCreate, AccountID: accountID, EndpointID: endpointID, TargetID: deployID},
+		{Action: types.AuditDeployPublish, AccountID: accountID, EndpointID: endpointID, TargetID: deployID,
+			Before: &types.AuditState{EnvKeys: []string{"FOO"}},
+			After:  &types.AuditState{ActiveDeploymentID: deployID, EnvKeys: []string{"FOO"}}},
+		{Action: types.AuditAccountCreate, TargetID: uuid.New()},
+	}
+	for i, event := range events {
+		event.ID = uuid.New()
+		event.Actor = types.ActorOperator
+		event.SourceIP = "192.0.2.1"
+		event.CreatedAT = start.Add(time.Duration(i) * time.Second)
+		if err := store.CreateAuditEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := store.GetAuditEvents(AuditFilter{}, Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].Action != types.AuditAccountCreate || all[3].Action != types.AuditEndpointCreate {
+		t.Fatalf("expected all events newest first got %d", len(all))
+	}
+	if all[0].EndpointID != uuid.Nil || all[0].Before != nil {
+		t.Fatalf("expected an event without endpoint and state got %+v", all[0])
+	}
+
+	filtered, err := store.GetAuditEvents(AuditFilter{EndpointID: endpointID}, Pagination{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 2 || filtered[0].Action != types.AuditDeployPublish {
+		t.Fatalf("expected the 2 newest events of the endpoint got %+v", filtered)
+	}
+	publish := filtered[0]
+	if publish.TargetID != deployID || publish.After.ActiveDeploymentID != deployID || publish.Before.ActiveDeploymentID != uuid.Nil || publish.After.EnvKeys[0] != "FOO" {
+		t.Fatalf("unexpected publish event: %+v", publish)
+	}
+	filtered, _ = store.GetAuditEvents(AuditFilter{EndpointID: endpointID}, Pagination{Limit: 2, Offset: 2})
+	if len(filtered) != 1 || filtered[0].Action != types.AuditEndpointCreate {
+		t.Fatalf("expected the oldest event of the endpoint got %+v", filtered)
+	}
+	filtered, _ = store.GetAuditEvents(AuditFilter{AccountID: accountID, Action: types.AuditDeployCreate}, Pagination{})
+	if len(filtered) != 1 || filtered[0].TargetID != deployID {
+		t.Fatalf("expected the deployment event got %+v", filtered)
+	}
+}
+
+func TestSQLiteStoreRateLimitsAndQuotas(t *testing.T) {
+	testRateLimitsAndQuotas(t, newTestSQLiteStore(t))
+}
+
+func testRateLimitsAndQuotas(t *testing.T, store Backend) {
+	account := types.NewAccount("acme")
+	account.Quota = types.Quota{MonthlyInvocations: 100}
+	if err := store.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	quota := types.Quota{MonthlyInvocations: 1000, MonthlyComputeTime: time.Hour}
+	if err := store.SetAccountQuota(account.ID, quota); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := store.GetAccount(account.ID); err != nil || a.Quota != quota {
+		t.Fatalf("expected quota %+v got %+v (%v)", quota, a, err)
+	}
+	if err := store.SetAccountQuota(uuid.New(), quota); err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+
+	endpoint := types.NewEndpoint("limited", "go", nil)
+	endpoint.AccountID = account.ID
+	endpoint.RateLimits.Endpoint = types.RateLimit{Rate: 100, Burst: 200}
+	if err := store.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	limits := types.RateLimits{Client: types.RateLimit{Rate: 0.5, Burst: 2}}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{RateLimits: &limits}); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := store.GetEndpoint(endpoint.ID); err != nil || e.RateLimits != limits {
+		t.Fatalf("expected rate limits %+v got %+v (%v)", limits, e, err)
+	}
+	concurrency := types.Concurrency{MaxConcurrent: 4, MaxQueue: 16, QueueTimeout: 5 * time.Second}
+	if err := store.UpdateEndpoint(endpoint.ID, UpdateEndpointParams{Concurrency: &concurrency}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := store.GetEndpoint(endpoint.ID)
+	if err != nil || e.Concurrency != concurrency || e.RateLimits != limits {
+		t.Fatalf("expected concurrency %+v and rate limits %+v got %+v (%v)", concurrency, limits, e, err)
+	}
+
+	month := types.MonthStart(time.Now())
+	records := map[time.Time]types.Usage{
+		month:                   {Invocations: 1, ComputeTime: time.Second},
+		month.Add(time.Hour):    {Invocations: 1, ComputeTime: 2 * time.Second},
+		month.AddDate(0, -1, 0): {Invocations: 1, ComputeTime: time.Hour},
+	}
+	for at, usage := range records {
+		if err := store.AddAccountUsage(account.ID, at, usage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The usage of an account outlives its endpoints.
+	if err := store.DeleteEndpoint(endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := store.GetAccountUsage(account.ID, month.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.Usage{Invocations: 2, ComputeTime: 3 * time.Second}
+	if usage != want {
+		t.Fatalf("expected usage %+v got %+v", want, usage)
+	}
+	if usage, _ := store.GetAccountUsage(uuid.New(), time.Time{}); usage != (types.Usage{}) {
+		t.Fatalf("expected no usage for an unknown account got %+v", usage)
+	}
+}
@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/anthdm/raptor/internal/config"
 	"github.com/anthdm/raptor/internal/types"
 	"github.com/google/uuid"
 )
@@ -9,18 +13,282 @@ type Store interface {
 	CreateEndpoint(*types.Endpoint) error
 	UpdateEndpoint(uuid.UUID, UpdateEndpointParams) error
 	GetEndpoint(uuid.UUID) (*types.Endpoint, error)
-	GetEndpoints() ([]types.Endpoint, error)
+	GetEndpointBySlug(string) (*types.Endpoint, error)
+	// GetEndpoints returns the endpoints of the account, or of all accounts
+	// when the id is uuid.Nil.
+	GetEndpoints(uuid.UUID) ([]types.Endpoint, error)
 	CreateDeployment(*types.Deployment) error
 	GetDeployment(uuid.UUID) (*types.Deployment, error)
+	GetDeploymentHistory(uuid.UUID, Pagination) ([]*types.DeploymentHistory, error)
+	// GetPublications returns the publications of the endpoint, oldest
+	// first.
+	GetPublications(uuid.UUID) ([]*types.Publication, error)
+	// SetTrafficSplit sets the traffic split of the endpoint, nil removes
+	// it.
+	SetTrafficSplit(uuid.UUID, *types.TrafficSplit) error
+	// DeleteEndpoint deletes the endpoint together with its deployments,
+	// publications, metrics, logs, secrets and domains.
+	DeleteEndpoint(uuid.UUID) error
+	// DeleteDeployment deletes the deployment together with its
+	// publications, metrics and logs. When it is the active deployment of
+	// its endpoint, the endpoint is left without an active deployment.
+	DeleteDeployment(uuid.UUID) error
 }
 
 type MetricStore interface {
-	CreateRuntimeMetric(*types.RuntimeMetric) error
-	GetRuntimeMetrics(uuid.UUID) ([]types.RuntimeMetric, error)
+	CreateRuntimeMetrics([]types.RuntimeMetric) error
+	GetRuntimeMetrics(uuid.UUID, MetricFilter) ([]types.RuntimeMetric, error)
+	// GetRuntimeMetricCounts counts the metrics of the endpoint that pass
+	// the filter, ignoring its limit, and the ones of them with a 5xx status.
+	GetRuntimeMetricCounts(uuid.UUID, MetricFilter) (types.MetricCounts, error)
+	// GetRuntimeMetricsSummary aggregates the metrics of the endpoint that
+	// pass the filter, ignoring its limit, in buckets of the given size over
+	// the time range of the filter, which needs both From and To.
+	GetRuntimeMetricsSummary(id uuid.UUID, filter MetricFilter, bucket time.Duration) (*types.MetricsSummary, error)
+	// AddAccountUsage adds the usage to the usage of the account in the
+	// month that starts at the given time. The usage of an account is kept
+	// when its endpoints are deleted.
+	AddAccountUsage(accountID uuid.UUID, month time.Time, usage types.Usage) error
+	// GetAccountUsage returns the usage of the account in the months that
+	// start at or after the given time.
+	GetAccountUsage(accountID uuid.UUID, since time.Time) (types.Usage, error)
+}
+
+// LogStore stores the lines guests print on stdout and stderr.
+type LogStore interface {
+	CreateRuntimeLogs([]types.RuntimeLog) error
+	GetRuntimeLogs(uuid.UUID, LogFilter) ([]types.RuntimeLog, error)
+	// DeleteRuntimeLogs deletes the logs of all endpoints that were printed
+	// before the given time.
+	DeleteRuntimeLogs(before time.Time) error
+}
+
+// SecretStore stores the encrypted secrets of the endpoints.
+type SecretStore interface {
+	// PutSecret creates the secret or replaces the value of the secret of
+	// the endpoint with the same name. The version, created and updated time
+	// of the given secret are set to the stored ones.
+	PutSecret(*types.Secret) error
+	// UpdateSecretValue replaces the encrypted value of an existing secret
+	// without changing its version, it is used to re-encrypt secrets with a
+	// new master key.
+	UpdateSecretValue(*types.Secret) error
+	// GetSecrets returns the secrets of the endpoint ordered by name.
+	GetSecrets(uuid.UUID) ([]*types.Secret, error)
+	DeleteSecret(endpointID uuid.UUID, name string) error
+}
+
+// DomainStore stores the custom domains claimed by the endpoints.
+type DomainStore interface {
+	// CreateDomain fails when the hostname and path prefix of the domain
+	// are verified, or claimed by the same endpoint. Expired claims of the
+	// hostname and path prefix are replaced.
+	CreateDomain(*types.Domain) error
+	GetDomain(uuid.UUID) (*types.Domain, error)
+	// GetDomains returns the domains of the endpoint, or of all endpoints
+	// when the id is uuid.Nil, ordered by hostname and path prefix.
+	GetDomains(uuid.UUID) ([]*types.Domain, error)
+	// VerifyDomain fails when another domain with the same hostname and
+	// path prefix is verified.
+	VerifyDomain(uuid.UUID) error
+	DeleteDomain(uuid.UUID) error
+}
+
+// AccountStore stores the accounts, their API tokens and the roles of the
+// tokens on endpoints.
+type AccountStore interface {
+	CreateAccount(*types.Account) error
+	GetAccount(uuid.UUID) (*types.Account, error)
+	SetAccountQuota(uuid.UUID, types.Quota) error
+	CreateAPIToken(*types.APIToken) error
+	// GetAPITokenByHash returns the token with the given hash, which is
+	// used to authenticate requests.
+	GetAPITokenByHash([]byte) (*types.APIToken, error)
+	// GetAPITokens returns the tokens of the account, oldest first.
+	GetAPITokens(uuid.UUID) ([]*types.APIToken, error)
+	// DeleteAPIToken deletes the token and its roles.
+	DeleteAPIToken(accountID, id uuid.UUID) error
+	// SetEndpointRole grants the token a role on the endpoint, replacing its
+	// previous role.
+	SetEndpointRole(*types.EndpointRole) error
+	GetEndpointRole(endpointID, tokenID uuid.UUID) (*types.EndpointRole, error)
+	// GetEndpointRoles returns the roles on the endpoint, oldest first.
+	GetEndpointRoles(uuid.UUID) ([]*types.EndpointRole, error)
+	DeleteEndpointRole(endpointID, tokenID uuid.UUID) error
 }
 
+// AuditStore stores the append-only audit log of the mutations of the
+// control plane.
+type AuditStore interface {
+	CreateAuditEvent(*types.AuditEvent) error
+	// GetAuditEvents returns the events that pass the filter, newest first.
+	GetAuditEvents(AuditFilter, Pagination) ([]*types.AuditEvent, error)
+}
+
+// AuditFilter filters the audit log, zero values match all events.
+type AuditFilter struct {
+	AccountID  uuid.UUID
+	EndpointID uuid.UUID
+	Action     string
+}
+
+// Match returns true when the given event passes the filter.
+func (f AuditFilter) Match(e *types.AuditEvent) bool {
+	if f.AccountID != uuid.Nil && e.AccountID != f.AccountID {
+		return false
+	}
+	if f.EndpointID != uuid.Nil && e.EndpointID != f.EndpointID {
+		return false
+	}
+	return f.Action == "" || e.Action == f.Action
+}
+
+// UpdateEndpointParams holds the fields of an endpoint that can be updated.
+// Zero values are left unchanged, a non nil empty Environment removes all
+// environment variables and a non nil RateLimits or Concurrency replaces the
+// rate limits or the concurrency limits. Setting ActiveDeployID records a
+// publication in the deployment history of the endpoint and removes its
+// traffic split, so all live traffic is served by the published deployment.
+//
+// SetEnvironment and UnsetEnvironment are merged into the current environment
+// of the endpoint atomically, they are ignored when Environment is set.
 type UpdateEndpointParams struct {
-	Environment       map[string]string
-	ActiveDeployID    uuid.UUID
-	DeploymentHistory *types.DeploymentHistory
+	Name             string
+	Slug             string
+	Environment      map[string]string
+	SetEnvironment   map[string]string
+	UnsetEnvironment []string
+	RateLimits       *types.RateLimits
+	Concurrency      *types.Concurrency
+	ActiveDeployID   uuid.UUID
+}
+
+// mergesEnvironment reports whether the update merges environment variables
+// into the current environment of the endpoint.
+func (p UpdateEndpointParams) mergesEnvironment() bool {
+	return p.Environment == nil && (len(p.SetEnvironment) > 0 || len(p.UnsetEnvironment) > 0)
+}
+
+// mergeEnvironment returns the current environment with the set variables of
+// the update added and the unset ones removed.
+func (p UpdateEndpointParams) mergeEnvironment(current map[string]string) map[string]string {
+	env := make(map[string]string, len(current)+len(p.SetEnvironment))
+	for k, v := range current {
+		env[k] = v
+	}
+	for k, v := range p.SetEnvironment {
+		env[k] = v
+	}
+	for _, k := range p.UnsetEnvironment {
+		delete(env, k)
+	}
+	return env
+}
+
+// MetricFilter filters the runtime metrics of an endpoint. Zero values are
+// ignored. Metrics are always returned newest first.
+type MetricFilter struct {
+	// From and To limit the metrics to the ones started in [From, To).
+	From         time.Time
+	To           time.Time
+	DeploymentID uuid.UUID
+	StatusCode   int
+	Limit        int
+}
+
+// Match returns true when the given metric passes the filter, ignoring the
+// limit.
+func (f MetricFilter) Match(m types.RuntimeMetric) bool {
+	if !f.From.IsZero() && m.StartTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !m.StartTime.Before(f.To) {
+		return false
+	}
+	if f.DeploymentID != uuid.Nil && m.DeploymentID != f.DeploymentID {
+		return false
+	}
+	if f.StatusCode != 0 && m.StatusCode != f.StatusCode {
+		return false
+	}
+	return true
+}
+
+// LogFilter filters the runtime logs of an endpoint. Zero values are ignored.
+// Logs are always returned oldest first. Without AfterSeq the newest Limit
+// logs are returned, with AfterSeq the oldest Limit logs following it, which
+// is used to follow the logs of an endpoint.
+type LogFilter struct {
+	// From and To limit the logs to the ones printed in [From, To).
+	From         time.Time
+	To           time.Time
+	DeploymentID uuid.UUID
+	RequestID    string
+	Stream       string
+	AfterSeq     int64
+	Limit        int
+}
+
+// Match returns true when the given log passes the filter, ignoring the
+// limit.
+func (f LogFilter) Match(l types.RuntimeLog) bool {
+	if !f.From.IsZero() && l.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !l.Time.Before(f.To) {
+		return false
+	}
+	if f.DeploymentID != uuid.Nil && l.DeploymentID != f.DeploymentID {
+		return false
+	}
+	if f.RequestID != "" && l.RequestID != f.RequestID {
+		return false
+	}
+	if f.Stream != "" && l.Stream != f.Stream {
+		return false
+	}
+	return l.Seq > f.AfterSeq
+}
+
+// Pagination limits the records returned by list queries. A zero Limit
+// returns all records.
+type Pagination struct {
+	Limit  int
+	Offset int
+}
+
+// Backend is implemented by every storage driver and serves as the Store,
+// the MetricStore, the LogStore, the SecretStore, the DomainStore, the
+// AccountStore and the AuditStore.
+type Backend interface {
+	Store
+	MetricStore
+	LogStore
+	SecretStore
+	DomainStore
+	AccountStore
+	AuditStore
+}
+
+// New returns the storage backend for the given driver. Supported drivers
+// are "postgres", "sqlite" and "memory".
+func New(driver string, cfg config.Storage) (Backend, error) {
+	switch driver {
+	case "postgres":
+		store, err := NewSQLStore(cfg.User, cfg.Password, cfg.Name, cfg.Host, cfg.Port, cfg.SSLMode)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "sqlite":
+		store, err := NewSQLiteStore(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("invalid storage driver: %s", driver)
+	}
 }
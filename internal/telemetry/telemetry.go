@@ -0,0 +1,127 @@
+// Package telemetry holds the Prometheus collectors that are exposed on the
+// /metrics endpoint of both the api server and the wasm server.
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "raptor"
+
+var (
+	// WasmRequests counts the requests served by the wasm server per
+	// endpoint, runtime and status code.
+	WasmRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "requests_total",
+		Help:      "Number of requests served by the wasm server.",
+	}, []string{"endpoint", "runtime", "code"})
+
+	// WasmRequestDuration observes the latency of the requests served by
+	// the wasm server per endpoint and runtime.
+	WasmRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the requests served by the wasm server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "runtime"})
+
+	// WasmInflightRequests is the number of requests that are waiting for
+	// a response of a runtime.
+	WasmInflightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "inflight_requests",
+		Help:      "Number of requests waiting for a response of a runtime.",
+	})
+
+	// WasmRejectedRequests counts the requests the wasm server rejected
+	// without invoking the endpoint per endpoint and reason.
+	WasmRejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "rejected_requests_total",
+		Help:      "Number of requests rejected by the rate limits, quotas and concurrency limits of the wasm server.",
+	}, []string{"endpoint", "reason"})
+
+	// WasmActiveInvocations is the number of invocations per endpoint that
+	// hold a slot of its concurrency limit.
+	WasmActiveInvocations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "active_invocations",
+		Help:      "Number of invocations holding a slot of the concurrency limit of their endpoint.",
+	}, []string{"endpoint"})
+
+	// WasmQueuedRequests is the number of requests per endpoint that wait
+	// in the queue of its concurrency limit.
+	WasmQueuedRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "wasm",
+		Name:      "queued_requests",
+		Help:      "Number of requests waiting for a slot of the concurrency limit of their endpoint.",
+	}, []string{"endpoint"})
+
+	// RuntimeActivations counts the activated runtime actors per runtime.
+	RuntimeActivations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "activations_total",
+		Help:      "Number of activated runtime actors.",
+	}, []string{"runtime"})
+
+	// InvokeErrors counts the failed invocations of user code per runtime.
+	InvokeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runtime",
+		Name:      "invoke_errors_total",
+		Help:      "Number of failed invocations.",
+	}, []string{"runtime"})
+
+	// CompileCacheHits counts the compilation cache lookups that hit.
+	CompileCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "compile_cache",
+		Name:      "hits_total",
+		Help:      "Number of compilation cache hits.",
+	})
+
+	// CompileCacheMisses counts the compilation cache lookups that missed.
+	CompileCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "compile_cache",
+		Name:      "misses_total",
+		Help:      "Number of compilation cache misses.",
+	})
+
+	// APIRequests counts the requests served by the api server per route,
+	// method and status code.
+	APIRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Number of requests served by the api server.",
+	}, []string{"route", "method", "code"})
+
+	// APIRequestDuration observes the latency of the requests served by the
+	// api server per route and method.
+	APIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the requests served by the api server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// Handler returns the HTTP handler that serves all metrics in the Prometheus
+// text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
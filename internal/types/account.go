@@ -0,0 +1,167 @@
+package types
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account is a user or an organization that owns endpoints.
+type Account struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Quota     Quota     `json:"quota"`
+	CreatedAT time.Time `json:"created_at"`
+}
+
+// Quota restricts the monthly usage of the endpoints of an account. Zero
+// values fall back to the defaults of the quota configuration.
+type Quota struct {
+	// MonthlyInvocations is the maximum number of invocations per calendar
+	// month.
+	MonthlyInvocations int64 `json:"monthly_invocations"`
+	// MonthlyComputeTime is the maximum total duration of the invocations
+	// per calendar month.
+	MonthlyComputeTime time.Duration `json:"monthly_compute_time"`
+}
+
+// WithDefaults returns the quota with all zero values replaced by the ones of
+// the given defaults.
+func (q Quota) WithDefaults(defaults Quota) Quota {
+	if q.MonthlyInvocations == 0 {
+		q.MonthlyInvocations = defaults.MonthlyInvocations
+	}
+	if q.MonthlyComputeTime == 0 {
+		q.MonthlyComputeTime = defaults.MonthlyComputeTime
+	}
+	return q
+}
+
+// Unlimited returns true when the quota does not limit the usage.
+func (q Quota) Unlimited() bool {
+	return q.MonthlyInvocations <= 0 && q.MonthlyComputeTime <= 0
+}
+
+// Exceeded returns true when the usage reached one of the limits of the
+// quota.
+func (q Quota) Exceeded(usage Usage) bool {
+	if q.MonthlyInvocations > 0 && usage.Invocations >= q.MonthlyInvocations {
+		return true
+	}
+	return q.MonthlyComputeTime > 0 && usage.ComputeTime >= q.MonthlyComputeTime
+}
+
+// Usage is the usage of the endpoints of an account. Every invocation counts,
+// previews and failed invocations included.
+type Usage struct {
+	Invocations int64         `json:"invocations"`
+	ComputeTime time.Duration `json:"compute_time"`
+}
+
+// MonthStart returns the start of the calendar month (UTC) of the given time,
+// from when the usage of the quotas is counted.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func NewAccount(name string) *Account {
+	return &Account{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedAT: time.Now(),
+	}
+}
+
+// The scopes of an API token. Every scope includes ScopeRead and ScopeAdmin
+// includes all scopes.
+const (
+	// ScopeRead allows reading the endpoints, deployments, metrics and logs.
+	ScopeRead = "read"
+	// ScopeDeploy allows creating and configuring endpoints and deploying
+	// code to them.
+	ScopeDeploy = "deploy"
+	// ScopePublish allows changing the live deployments of endpoints by
+	// publishing, rolling back and splitting traffic.
+	ScopePublish = "publish"
+	// ScopeAdmin allows everything, including deleting endpoints and
+	// managing domains and API tokens.
+	ScopeAdmin = "admin"
+)
+
+// Scopes holds all valid scopes.
+var Scopes = []string{ScopeRead, ScopeDeploy, ScopePublish, ScopeAdmin}
+
+// ValidateScopes returns an error when the scopes are empty or contain an
+// unknown scope.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least 1 scope is required (%s)", strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("invalid scope %q (%s)", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// apiTokenPrefix is prepended to every API token so leaked tokens are easy
+// to recognize.
+const apiTokenPrefix = "raptor_"
+
+// APIToken authenticates requests on behalf of an account. Only the hash of
+// the token is stored, the token itself is returned once when it is created.
+type APIToken struct {
+	ID        uuid.UUID `json:"id"`
+	AccountID uuid.UUID `json:"account_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	// Prefix is the start of the token, which identifies the token without
+	// revealing it.
+	Prefix    string    `json:"prefix"`
+	Hash      []byte    `json:"-"`
+	CreatedAT time.Time `json:"created_at"`
+}
+
+// NewAPIToken returns a new API token of the account and the token itself.
+func NewAPIToken(accountID uuid.UUID, name string, scopes []string) (*APIToken, string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(b)
+	return &APIToken{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		Name:      name,
+		Scopes:    scopes,
+		Prefix:    token[:len(apiTokenPrefix)+8],
+		Hash:      HashAPIToken(token),
+		CreatedAT: time.Now(),
+	}, token
+}
+
+// HashAPIToken returns the hash under which the token is stored. Tokens are
+// long random strings, so a fast unsalted hash is enough to protect them and
+// allows looking them up by their hash.
+func HashAPIToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// HasScope returns true when the token grants the given scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin || scope == ScopeRead {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeDeploy, false},
+		{[]string{ScopeDeploy}, ScopeRead, true},
+		{[]string{ScopeDeploy}, ScopePublish, false},
+		{[]string{ScopeDeploy, ScopePublish}, ScopePublish, true},
+		{[]string{ScopeAdmin}, ScopePublish, true},
+	}
+	for _, test := range tests {
+		token, _ := NewAPIToken(uuid.New(), "ci", test.scopes)
+		if got := token.HasScope(test.scope); got != test.want {
+			t.Fatalf("expected HasScope(%s) of %v to be %t", test.scope, test.scopes, test.want)
+		}
+	}
+	if err := ValidateScopes([]string{ScopeRead, "write"}); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+	if err := ValidateScopes(nil); err == nil {
+		t.Fatal("expected an error without scopes")
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	token, secret := NewAPIToken(uuid.New(), "ci", []string{ScopeRead})
+	if !strings.HasPrefix(secret, token.Prefix) {
+		t.Fatalf("expected token %s to start with prefix %s", secret, token.Prefix)
+	}
+	if !bytes.Equal(token.Hash, HashAPIToken(secret)) {
+		t.Fatal("expected the hash of the token to match")
+	}
+	if _, other := NewAPIToken(uuid.New(), "ci", []string{ScopeRead}); other == secret {
+		t.Fatal("expected tokens to be random")
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	quota := Quota{MonthlyInvocations: 100, MonthlyComputeTime: time.Minute}
+	tests := []struct {
+		quota Quota
+		usage Usage
+		want  bool
+	}{
+		{quota, Usage{Invocations: 99, ComputeTime: 59 * time.Second}, false},
+		{quota, Usage{Invocations: 100}, true},
+		{quota, Usage{ComputeTime: time.Minute}, true},
+		{Quota{MonthlyComputeTime: time.Minute}, Usage{Invocations: 1000}, false},
+		{Quota{}, Usage{Invocations: 1000, ComputeTime: time.Hour}, false},
+	}
+	for _, test := range tests {
+		if got := test.quota.Exceeded(test.usage); got != test.want {
+			t.Fatalf("expected Exceeded(%+v) of %+v to be %t", test.usage, test.quota, test.want)
+		}
+	}
+	defaults := Quota{MonthlyInvocations: 10, MonthlyComputeTime: time.Second}
+	if got := (Quota{MonthlyInvocations: 5}).WithDefaults(defaults); got.MonthlyInvocations != 5 || got.MonthlyComputeTime != time.Second {
+		t.Fatalf("unexpected quota with defaults: %+v", got)
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	want := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if got := MonthStart(now); !got.Equal(want) {
+		t.Fatalf("expected month start %s got %s", want, got)
+	}
+}
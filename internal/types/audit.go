@@ -0,0 +1,97 @@
+package types
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The actions recorded in the audit log.
+const (
+	AuditEndpointCreate   = "endpoint.create"
+	AuditEndpointUpdate   = "endpoint.update"
+	AuditEndpointDelete   = "endpoint.delete"
+	AuditEndpointRollback = "endpoint.rollback"
+	AuditDeployCreate     = "deployment.create"
+	AuditDeployDelete     = "deployment.delete"
+	AuditDeployPublish    = "deployment.publish"
+	AuditTrafficSet       = "traffic.set"
+	AuditTrafficDelete    = "traffic.delete"
+	AuditTrafficPromote   = "traffic.promote"
+	AuditCanaryPromote    = "canary.promote"
+	AuditCanaryAbort      = "canary.abort"
+	AuditSecretPut        = "secret.put"
+	AuditSecretDelete     = "secret.delete"
+	AuditSecretsRotate    = "secrets.rotate"
+	AuditDomainCreate     = "domain.create"
+	AuditDomainVerify     = "domain.verify"
+	AuditDomainDelete     = "domain.delete"
+	AuditRoleSet          = "role.set"
+	AuditRoleDelete       = "role.delete"
+	AuditAccountCreate    = "account.create"
+	AuditAccountQuota     = "account.quota"
+	AuditTokenCreate      = "token.create"
+	AuditTokenDelete      = "token.delete"
+)
+
+// The actors of audit events that are not made with the API token of an
+// account.
+const (
+	// ActorOperator made the request with the operator token.
+	ActorOperator = "operator"
+	// ActorAnonymous made the request while authorization was disabled.
+	ActorAnonymous = "anonymous"
+	// ActorSystem made the mutation without a request, like the automatic
+	// promotion of a canary.
+	ActorSystem = "system"
+)
+
+// AuditEvent records a mutation of the control plane: who did what to which
+// resource, and how the endpoint changed.
+type AuditEvent struct {
+	ID uuid.UUID `json:"id"`
+	// AccountID is the account that owns the mutated resource, uuid.Nil for
+	// resources without an account.
+	AccountID uuid.UUID `json:"account_id"`
+	// Actor is the prefix of the API token that made the request, or
+	// ActorOperator or ActorAnonymous.
+	Actor   string    `json:"actor"`
+	TokenID uuid.UUID `json:"token_id"`
+	Action  string    `json:"action"`
+	// EndpointID is the mutated endpoint, or the endpoint the mutated
+	// resource belongs to.
+	EndpointID uuid.UUID `json:"endpoint_id"`
+	// TargetID is the mutated deployment, domain, API token or account.
+	TargetID uuid.UUID `json:"target_id"`
+	// Detail describes the mutation, like the name of a secret.
+	Detail    string      `json:"detail,omitempty"`
+	Before    *AuditState `json:"before,omitempty"`
+	After     *AuditState `json:"after,omitempty"`
+	SourceIP  string      `json:"source_ip"`
+	CreatedAT time.Time   `json:"created_at"`
+}
+
+// AuditState is the state of an endpoint before or after a mutation. Only the
+// keys of the environment are recorded, the values can hold credentials.
+type AuditState struct {
+	ActiveDeploymentID uuid.UUID `json:"active_deployment_id"`
+	EnvKeys            []string  `json:"env_keys"`
+}
+
+// NewAuditState returns the state of the endpoint, or nil when the endpoint
+// is nil.
+func NewAuditState(endpoint *Endpoint) *AuditState {
+	if endpoint == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(endpoint.Environment))
+	for key := range endpoint.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &AuditState{
+		ActiveDeploymentID: endpoint.ActiveDeploymentID,
+		EnvKeys:            keys,
+	}
+}
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DomainVerificationLabel is the label that is prepended to the hostname of a
+// domain to get the name of the TXT record that verifies its ownership.
+const DomainVerificationLabel = "_raptor-challenge"
+
+// DomainClaimTTL is how long an unverified domain is kept. The unverified
+// claims of different endpoints on a domain coexist until one of them is
+// verified, expired claims are replaced when the domain is claimed again.
+const DomainClaimTTL = 7 * 24 * time.Hour
+
+// Domain is a hostname, optionally limited to the paths below a prefix, that
+// is claimed by an endpoint. Requests to a verified domain are served by the
+// live deployments of the endpoint.
+type Domain struct {
+	ID         uuid.UUID `json:"id"`
+	EndpointID uuid.UUID `json:"endpoint_id"`
+	Hostname   string    `json:"hostname"`
+	// PathPrefix limits the domain to the paths below it, all paths of the
+	// hostname are claimed when empty.
+	PathPrefix string `json:"path_prefix"`
+	// VerificationToken is the value of the TXT record that needs to be set
+	// to verify the ownership of the hostname.
+	VerificationToken string    `json:"verification_token"`
+	Verified          bool      `json:"verified"`
+	CreatedAT         time.Time `json:"created_at"`
+}
+
+// NewDomain returns a new unverified domain with a random verification
+// token. The hostname and the path prefix are normalized.
+func NewDomain(endpointID uuid.UUID, hostname, pathPrefix string) *Domain {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return &Domain{
+		ID:                uuid.New(),
+		EndpointID:        endpointID,
+		Hostname:          NormalizeHostname(hostname),
+		PathPrefix:        NormalizePathPrefix(pathPrefix),
+		VerificationToken: "raptor-verification=" + hex.EncodeToString(b),
+		CreatedAT:         time.Now(),
+	}
+}
+
+// VerificationRecord returns the name of the TXT record that verifies the
+// ownership of the domain.
+func (d *Domain) VerificationRecord() string {
+	return DomainVerificationLabel + "." + d.Hostname
+}
+
+// Expired returns true when the domain is an unverified claim that is older
+// than DomainClaimTTL.
+func (d *Domain) Expired(now time.Time) bool {
+	return !d.Verified && now.Sub(d.CreatedAT) > DomainClaimTTL
+}
+
+// Blocks returns true when the domain prevents the endpoint from claiming the
+// hostname and path prefix, which are normalized: when it is verified, or
+// when it is an unexpired claim of the same endpoint.
+func (d *Domain) Blocks(endpointID uuid.UUID, hostname, pathPrefix string, now time.Time) bool {
+	if d.Hostname != hostname || d.PathPrefix != pathPrefix {
+		return false
+	}
+	return d.Verified || (d.EndpointID == endpointID && !d.Expired(now))
+}
+
+// MatchPath returns true when the path is claimed by the domain.
+func (d *Domain) MatchPath(path string) bool {
+	if d.PathPrefix == "" || path == d.PathPrefix {
+		return true
+	}
+	return strings.HasPrefix(path, d.PathPrefix+"/")
+}
+
+// NormalizeHostname lower cases the hostname and strips the port and the
+// trailing dot, so it can be compared with the Host header of requests.
+func NormalizeHostname(hostname string) string {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+	return strings.TrimSuffix(strings.ToLower(hostname), ".")
+}
+
+// NormalizePathPrefix returns the path prefix with a leading and without a
+// trailing slash, the root path is normalized to an empty prefix.
+func NormalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// DomainTable routes requests to the endpoints by the verified domains they
+// claimed. A nil table does not route any request.
+type DomainTable struct {
+	// hosts holds the domains of each hostname ordered by the length of
+	// their path prefix, longest first.
+	hosts map[string][]*Domain
+}
+
+// NewDomainTable returns a routing table of the verified domains.
+func NewDomainTable(domains []*Domain) *DomainTable {
+	t := &DomainTable{hosts: make(map[string][]*Domain)}
+	for _, domain := range domains {
+		if !domain.Verified {
+			continue
+		}
+		t.hosts[domain.Hostname] = append(t.hosts[domain.Hostname], domain)
+	}
+	for _, list := range t.hosts {
+		sort.Slice(list, func(i, j int) bool {
+			return len(list[i].PathPrefix) > len(list[j].PathPrefix)
+		})
+	}
+	return t
+}
+
+// Match returns the domain with the longest path prefix that claims the given
+// host and path.
+func (t *DomainTable) Match(host, path string) (*Domain, bool) {
+	if t == nil {
+		return nil, false
+	}
+	for _, domain := range t.hosts[NormalizeHostname(host)] {
+		if domain.MatchPath(path) {
+			return domain, true
+		}
+	}
+	return nil, false
+}
+
+// Len returns the number of domains in the table.
+func (t *DomainTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	n := 0
+	for _, list := range t.hosts {
+		n += len(list)
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDomainTableMatch(t *testing.T) {
+	var (
+		site = NewDomain(uuid.New(), "Example.com.", "")
+		api  = NewDomain(uuid.New(), "example.com", "/api/")
+		v2   = NewDomain(uuid.New(), "example.com", "api/v2")
+		todo = NewDomain(uuid.New(), "todo.example.com", "")
+	)
+	site.Verified, api.Verified, v2.Verified = true, true, true
+	if site.Hostname != "example.com" || api.PathPrefix != "/api" || v2.PathPrefix != "/api/v2" {
+		t.Fatalf("expected normalized domains got %s %s %s", site.Hostname, api.PathPrefix, v2.PathPrefix)
+	}
+
+	table := NewDomainTable([]*Domain{site, api, v2, todo})
+	if table.Len() != 3 {
+		t.Fatalf("expected 3 verified domains in the table got %d", table.Len())
+	}
+	tests := []struct {
+		host, path string
+		want       *Domain
+	}{
+		{"example.com", "/", site},
+		{"EXAMPLE.com:8080", "/about", site},
+		{"example.com", "/api", api},
+		{"example.com", "/api/users", api},
+		{"example.com", "/apiary", site},
+		{"example.com", "/api/v2/users", v2},
+		{"todo.example.com", "/", nil},
+		{"other.com", "/", nil},
+	}
+	for _, test := range tests {
+		domain, ok := table.Match(test.host, test.path)
+		if ok != (test.want != nil) || (ok && domain.ID != test.want.ID) {
+			t.Fatalf("unexpected match for %s%s: %+v", test.host, test.path, domain)
+		}
+	}
+
+	var empty *DomainTable
+	if _, ok := empty.Match("example.com", "/"); ok {
+		t.Fatal("expected a nil table to not match")
+	}
+}
@@ -17,19 +17,40 @@ func ValidRuntime(runtime string) bool {
 }
 
 type Endpoint struct {
-	ID                 uuid.UUID            `json:"id"`
-	Name               string               `json:"name"`
-	Runtime            string               `json:"runtime"`
-	ActiveDeploymentID uuid.UUID            `json:"active_deployment_id"`
-	Environment        map[string]string    `json:"environment"`
-	DeploymentHistory  []*DeploymentHistory `json:"deployment_history"`
-	CreatedAT          time.Time            `json:"created_at"`
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Slug references the endpoint in URLs instead of its id, it is unique
+	// across all endpoints.
+	Slug string `json:"slug"`
+	// AccountID is the account that owns the endpoint, it is uuid.Nil for
+	// endpoints created without authorization.
+	AccountID          uuid.UUID         `json:"account_id"`
+	Runtime            string            `json:"runtime"`
+	ActiveDeploymentID uuid.UUID         `json:"active_deployment_id"`
+	Environment        map[string]string `json:"environment"`
+	Limits             Limits            `json:"limits"`
+	RateLimits         RateLimits        `json:"rate_limits"`
+	Concurrency        Concurrency       `json:"concurrency"`
+	// TrafficSplit routes the live traffic across multiple deployments, all
+	// live traffic is served by the active deployment when nil.
+	TrafficSplit      *TrafficSplit        `json:"traffic_split"`
+	DeploymentHistory []*DeploymentHistory `json:"deployment_history"`
+	CreatedAT         time.Time            `json:"created_at"`
 }
 
 func (e Endpoint) HasActiveDeploy() bool {
 	return e.ActiveDeploymentID.String() != "00000000-0000-0000-0000-000000000000"
 }
 
+// URLRef returns the reference of the endpoint in live URLs, which is its
+// slug or its id when it does not have one.
+func (e Endpoint) URLRef() string {
+	if e.Slug != "" {
+		return e.Slug
+	}
+	return e.ID.String()
+}
+
 func NewEndpoint(name string, runtime string, env map[string]string) *Endpoint {
 	if env == nil {
 		env = make(map[string]string)
@@ -45,7 +66,137 @@ func NewEndpoint(name string, runtime string, env map[string]string) *Endpoint {
 	}
 }
 
+// Limits restricts the resources a single invocation of an endpoint can use.
+// Zero values fall back to the defaults of the runtime configuration.
+type Limits struct {
+	// MaxMemoryPages is the maximum memory of the guest in 64KiB wasm pages.
+	MaxMemoryPages uint32 `json:"max_memory_pages"`
+	// Timeout is the maximum wall-clock time of an invocation.
+	Timeout time.Duration `json:"timeout"`
+	// MaxCalls is the maximum number of guest function calls of an
+	// invocation. It limits the calls, not the executed instructions.
+	MaxCalls uint64 `json:"max_calls"`
+}
+
+// WithDefaults returns the limits with all zero values replaced by the ones
+// of the given defaults.
+func (l Limits) WithDefaults(defaults Limits) Limits {
+	if l.MaxMemoryPages == 0 {
+		l.MaxMemoryPages = defaults.MaxMemoryPages
+	}
+	if l.Timeout == 0 {
+		l.Timeout = defaults.Timeout
+	}
+	if l.MaxCalls == 0 {
+		l.MaxCalls = defaults.MaxCalls
+	}
+	return l
+}
+
+// RateLimit is a token bucket that allows Rate requests per second on
+// average and bursts of up to Burst requests. A zero Rate does not limit the
+// requests.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited returns true when the rate limit does not limit the requests.
+func (l RateLimit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// RateLimits restricts the rate of the requests to the live and preview URLs
+// of an endpoint. Zero values fall back to the defaults of the rate limit
+// configuration.
+type RateLimits struct {
+	// Endpoint limits all requests to the endpoint.
+	Endpoint RateLimit `json:"endpoint"`
+	// Client limits the requests of each client IP to the endpoint.
+	Client RateLimit `json:"client"`
+}
+
+// WithDefaults returns the rate limits with all zero values replaced by the
+// ones of the given defaults.
+func (l RateLimits) WithDefaults(defaults RateLimits) RateLimits {
+	if l.Endpoint.Rate == 0 {
+		l.Endpoint.Rate = defaults.Endpoint.Rate
+	}
+	if l.Endpoint.Burst == 0 {
+		l.Endpoint.Burst = defaults.Endpoint.Burst
+	}
+	if l.Client.Rate == 0 {
+		l.Client.Rate = defaults.Client.Rate
+	}
+	if l.Client.Burst == 0 {
+		l.Client.Burst = defaults.Client.Burst
+	}
+	return l
+}
+
+// Concurrency restricts the number of invocations of an endpoint that run at
+// the same time. Requests over the limit wait in a bounded queue. Zero values
+// fall back to the defaults of the concurrency configuration.
+type Concurrency struct {
+	// MaxConcurrent is the maximum number of concurrent invocations, 0 does
+	// not limit them.
+	MaxConcurrent int `json:"max_concurrent"`
+	// MaxQueue is the maximum number of requests waiting for an invocation,
+	// requests are rejected when the queue is full.
+	MaxQueue int `json:"max_queue"`
+	// QueueTimeout is the maximum time a request waits in the queue.
+	QueueTimeout time.Duration `json:"queue_timeout"`
+}
+
+// WithDefaults returns the concurrency with all zero values replaced by the
+// ones of the given defaults.
+func (c Concurrency) WithDefaults(defaults Concurrency) Concurrency {
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = defaults.MaxConcurrent
+	}
+	if c.MaxQueue == 0 {
+		c.MaxQueue = defaults.MaxQueue
+	}
+	if c.QueueTimeout == 0 {
+		c.QueueTimeout = defaults.QueueTimeout
+	}
+	return c
+}
+
+// Unlimited returns true when the concurrency does not limit the
+// invocations.
+func (c Concurrency) Unlimited() bool {
+	return c.MaxConcurrent <= 0
+}
+
+// DeploymentHistory describes a deployment of an endpoint and when it was
+// LIVE on that endpoint.
 type DeploymentHistory struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAT time.Time `json:"created_at"`
+	ID   uuid.UUID `json:"id"`
+	Hash string    `json:"hash"`
+	// Active is true when this is the active deployment of the endpoint.
+	Active bool `json:"active"`
+	// PublishedAT is the last time the deployment was published LIVE.
+	PublishedAT *time.Time `json:"published_at"`
+	// UnpublishedAT is the time the deployment got replaced by another
+	// published deployment, nil when it is still active or never published.
+	UnpublishedAT *time.Time `json:"unpublished_at"`
+	CreatedAT     time.Time  `json:"created_at"`
+}
+
+// Publication records a deployment being published LIVE on its endpoint.
+type Publication struct {
+	ID           uuid.UUID `json:"id"`
+	EndpointID   uuid.UUID `json:"endpoint_id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	PublishedAT  time.Time `json:"published_at"`
+}
+
+func NewPublication(endpointID, deployID uuid.UUID) *Publication {
+	return &Publication{
+		ID:           uuid.New(),
+		EndpointID:   endpointID,
+		DeploymentID: deployID,
+		PublishedAT:  time.Now().UTC(),
+	}
 }
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// RuntimeLog is a single line a guest printed on stdout or stderr during an
+// invocation.
+type RuntimeLog struct {
+	// Seq increases with every stored log line, so it can be used as a
+	// cursor to follow the logs of an endpoint.
+	Seq          int64     `json:"seq"`
+	EndpointID   uuid.UUID `json:"endpoint_id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	RequestID    string    `json:"request_id"`
+	Stream       string    `json:"stream"`
+	Line         string    `json:"line"`
+	Time         time.Time `json:"time"`
+}
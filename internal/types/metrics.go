@@ -1,6 +1,9 @@
 package types
 
 import (
+	"fmt"
+	"net/http"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,3 +19,216 @@ type RuntimeMetric struct {
 	StartTime    time.Time     `json:"start_time"`
 	StatusCode   int           `json:"status_code"`
 }
+
+// MetricCounts holds the number of runtime metrics and the number of them
+// that responded with a 5xx status code.
+type MetricCounts struct {
+	Count  int `json:"count"`
+	Errors int `json:"errors"`
+}
+
+// IsError returns true when the invocation responded with a 5xx status code.
+func (m RuntimeMetric) IsError() bool {
+	return m.StatusCode >= http.StatusInternalServerError
+}
+
+// MetricsAggregate holds the rollup of a set of runtime metrics.
+type MetricsAggregate struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	// StatusRatios maps a status class (2xx, 3xx, 4xx or 5xx) to the ratio
+	// of requests that responded with a status code of that class.
+	StatusRatios      map[string]float64 `json:"status_ratios"`
+	RequestsPerSecond float64            `json:"requests_per_second"`
+}
+
+// MetricsBucket is the rollup of the runtime metrics that started within
+// [Start, Start+bucket).
+type MetricsBucket struct {
+	Start time.Time `json:"start"`
+	MetricsAggregate
+}
+
+// DeploymentMetricsSummary is the rollup of the runtime metrics of a single
+// deployment.
+type DeploymentMetricsSummary struct {
+	DeploymentID uuid.UUID        `json:"deployment_id"`
+	Total        MetricsAggregate `json:"total"`
+	Buckets      []MetricsBucket  `json:"buckets"`
+}
+
+// MetricsSummary is the rollup of the runtime metrics of an endpoint in the
+// time range [From, To), broken down by deployment.
+type MetricsSummary struct {
+	EndpointID  uuid.UUID                   `json:"endpoint_id"`
+	From        time.Time                   `json:"from"`
+	To          time.Time                   `json:"to"`
+	Bucket      time.Duration               `json:"bucket"`
+	Total       MetricsAggregate            `json:"total"`
+	Deployments []*DeploymentMetricsSummary `json:"deployments"`
+}
+
+// MetricsGroup is the rollup of the runtime metrics of one group of a
+// summary: a bucket of a deployment, a whole deployment (Bucket -1) or all
+// metrics of the endpoint (DeploymentID uuid.Nil and Bucket -1).
+type MetricsGroup struct {
+	DeploymentID uuid.UUID
+	Bucket       int
+	Count        int
+	// StatusCounts maps a status class to the number of requests that
+	// responded with a status code of that class.
+	StatusCounts map[string]int
+	P50          time.Duration
+	P90          time.Duration
+	P99          time.Duration
+}
+
+func (g MetricsGroup) aggregate(window time.Duration) MetricsAggregate {
+	agg := MetricsAggregate{
+		Count:        g.Count,
+		P50:          g.P50,
+		P90:          g.P90,
+		P99:          g.P99,
+		StatusRatios: map[string]float64{},
+	}
+	if g.Count == 0 {
+		return agg
+	}
+	for class, n := range g.StatusCounts {
+		if n > 0 {
+			agg.StatusRatios[class] = float64(n) / float64(g.Count)
+		}
+	}
+	if window > 0 {
+		agg.RequestsPerSecond = float64(g.Count) / window.Seconds()
+	}
+	return agg
+}
+
+// NewMetricsSummary assembles the summary of the metrics of an endpoint over
+// the time range [from, to) in buckets of the given size from the rollups of
+// its groups. Deployments are ordered by their number of requests, busiest
+// first.
+func NewMetricsSummary(endpointID uuid.UUID, from, to time.Time, bucket time.Duration, groups []MetricsGroup) *MetricsSummary {
+	summary := &MetricsSummary{
+		EndpointID:  endpointID,
+		From:        from,
+		To:          to,
+		Bucket:      bucket,
+		Total:       MetricsGroup{}.aggregate(0),
+		Deployments: []*DeploymentMetricsSummary{},
+	}
+	var (
+		numBuckets   = int((to.Sub(from) + bucket - 1) / bucket)
+		byDeployment = make(map[uuid.UUID]*DeploymentMetricsSummary)
+	)
+	deployment := func(id uuid.UUID) *DeploymentMetricsSummary {
+		if d, ok := byDeployment[id]; ok {
+			return d
+		}
+		d := &DeploymentMetricsSummary{
+			DeploymentID: id,
+			Total:        MetricsGroup{}.aggregate(0),
+			Buckets:      make([]MetricsBucket, numBuckets),
+		}
+		for i := range d.Buckets {
+			d.Buckets[i] = MetricsBucket{
+				Start:            from.Add(time.Duration(i) * bucket),
+				MetricsAggregate: MetricsGroup{}.aggregate(0),
+			}
+		}
+		byDeployment[id] = d
+		summary.Deployments = append(summary.Deployments, d)
+		return d
+	}
+	for _, g := range groups {
+		switch {
+		case g.DeploymentID == uuid.Nil:
+			summary.Total = g.aggregate(to.Sub(from))
+		case g.Bucket < 0:
+			deployment(g.DeploymentID).Total = g.aggregate(to.Sub(from))
+		case g.Bucket < numBuckets:
+			deployment(g.DeploymentID).Buckets[g.Bucket].MetricsAggregate = g.aggregate(bucket)
+		}
+	}
+	sort.SliceStable(summary.Deployments, func(i, j int) bool {
+		a, b := summary.Deployments[i], summary.Deployments[j]
+		if a.Total.Count != b.Total.Count {
+			return a.Total.Count > b.Total.Count
+		}
+		return a.DeploymentID.String() < b.DeploymentID.String()
+	})
+	return summary
+}
+
+// SummarizeMetrics aggregates the given metrics of an endpoint over the time
+// range [from, to) in buckets of the given size.
+func SummarizeMetrics(endpointID uuid.UUID, metrics []RuntimeMetric, from, to time.Time, bucket time.Duration) *MetricsSummary {
+	type groupKey struct {
+		deploymentID uuid.UUID
+		bucket       int
+	}
+	var (
+		byGroup = make(map[groupKey][]RuntimeMetric)
+		order   []groupKey
+	)
+	add := func(key groupKey, m RuntimeMetric) {
+		if _, ok := byGroup[key]; !ok {
+			order = append(order, key)
+		}
+		byGroup[key] = append(byGroup[key], m)
+	}
+	for _, m := range metrics {
+		if m.StartTime.Before(from) || !m.StartTime.Before(to) {
+			continue
+		}
+		add(groupKey{uuid.Nil, -1}, m)
+		add(groupKey{m.DeploymentID, -1}, m)
+		add(groupKey{m.DeploymentID, int(m.StartTime.Sub(from) / bucket)}, m)
+	}
+	groups := make([]MetricsGroup, 0, len(order))
+	for _, key := range order {
+		groups = append(groups, groupMetrics(key.deploymentID, key.bucket, byGroup[key]))
+	}
+	return NewMetricsSummary(endpointID, from, to, bucket, groups)
+}
+
+func groupMetrics(deploymentID uuid.UUID, bucket int, metrics []RuntimeMetric) MetricsGroup {
+	g := MetricsGroup{
+		DeploymentID: deploymentID,
+		Bucket:       bucket,
+		Count:        len(metrics),
+		StatusCounts: map[string]int{},
+	}
+	durations := make([]time.Duration, len(metrics))
+	for i, m := range metrics {
+		durations[i] = m.Duration
+		g.StatusCounts[StatusClass(m.StatusCode)]++
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	g.P50 = percentile(durations, 50)
+	g.P90 = percentile(durations, 90)
+	g.P99 = percentile(durations, 99)
+	return g
+}
+
+// percentile returns the nearest-rank percentile p of the given sorted
+// durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// StatusClass returns the class (1xx, 2xx, 3xx, 4xx or 5xx) of the given HTTP
+// status code.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSummarizeMetrics(t *testing.T) {
+	var (
+		endpointID = uuid.New()
+		deployA    = uuid.New()
+		deployB    = uuid.New()
+		from       = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		to         = from.Add(2 * time.Minute)
+		metrics    []RuntimeMetric
+	)
+	for i := 1; i <= 100; i++ {
+		status := 200
+		if i > 90 {
+			status = 500
+		}
+		metrics = append(metrics, RuntimeMetric{
+			EndpointID:   endpointID,
+			DeploymentID: deployA,
+			Duration:     time.Duration(i) * time.Millisecond,
+			StartTime:    from.Add(time.Duration(i) * time.Second),
+			StatusCode:   status,
+		})
+	}
+	metrics = append(metrics,
+		RuntimeMetric{DeploymentID: deployB, StartTime: from.Add(90 * time.Second), StatusCode: 404},
+		// Out of range metrics should be ignored.
+		RuntimeMetric{DeploymentID: deployB, StartTime: to, StatusCode: 200},
+	)
+
+	summary := SummarizeMetrics(endpointID, metrics, from, to, time.Minute)
+	if summary.Total.Count != 101 {
+		t.Fatalf("expected 101 metrics got %d", summary.Total.Count)
+	}
+	if len(summary.Deployments) != 2 {
+		t.Fatalf("expected 2 deployments got %d", len(summary.Deployments))
+	}
+
+	a := summary.Deployments[0]
+	if a.DeploymentID != deployA {
+		t.Fatalf("expected deployment %s got %s", deployA, a.DeploymentID)
+	}
+	if a.Total.P50 != 50*time.Millisecond || a.Total.P90 != 90*time.Millisecond || a.Total.P99 != 99*time.Millisecond {
+		t.Fatalf("unexpected percentiles: %+v", a.Total)
+	}
+	if a.Total.StatusRatios["5xx"] != 0.1 || a.Total.StatusRatios["2xx"] != 0.9 {
+		t.Fatalf("unexpected status ratios: %v", a.Total.StatusRatios)
+	}
+	if len(a.Buckets) != 2 {
+		t.Fatalf("expected 2 buckets got %d", len(a.Buckets))
+	}
+	if a.Buckets[0].Count != 59 || a.Buckets[1].Count != 41 {
+		t.Fatalf("unexpected bucket counts: %d %d", a.Buckets[0].Count, a.Buckets[1].Count)
+	}
+	if a.Buckets[1].Start != from.Add(time.Minute) {
+		t.Fatalf("unexpected bucket start: %s", a.Buckets[1].Start)
+	}
+
+	b := summary.Deployments[1]
+	if b.Total.Count != 1 || b.Total.StatusRatios["4xx"] != 1 {
+		t.Fatalf("unexpected summary for deployment b: %+v", b.Total)
+	}
+}
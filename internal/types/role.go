@@ -0,0 +1,63 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The roles an API token can have on an endpoint, from the least to the most
+// privileged. Every role includes the permissions of the roles before it.
+const (
+	// RoleViewer allows reading the endpoint, its deployments, metrics and
+	// logs.
+	RoleViewer = "viewer"
+	// RoleDeveloper allows creating deployments, which can be called with
+	// their preview URL.
+	RoleDeveloper = "developer"
+	// RoleReleaser allows changing what is served LIVE and how, by
+	// publishing, rolling back, splitting traffic and changing the
+	// environment and secrets.
+	RoleReleaser = "releaser"
+	// RoleOwner allows everything, including deleting the endpoint and
+	// managing its domains and roles.
+	RoleOwner = "owner"
+)
+
+// Roles holds all valid roles, from the least to the most privileged.
+var Roles = []string{RoleViewer, RoleDeveloper, RoleReleaser, RoleOwner}
+
+// ValidateRole returns an error when the role is unknown.
+func ValidateRole(role string) error {
+	if !slices.Contains(Roles, role) {
+		return fmt.Errorf("invalid role %q (%s)", role, strings.Join(Roles, ", "))
+	}
+	return nil
+}
+
+// RoleAllows returns true when the given role has the permissions of the
+// required role.
+func RoleAllows(role, required string) bool {
+	have, want := slices.Index(Roles, role), slices.Index(Roles, required)
+	return have >= 0 && want >= 0 && have >= want
+}
+
+// EndpointRole grants an API token a role on an endpoint.
+type EndpointRole struct {
+	EndpointID uuid.UUID `json:"endpoint_id"`
+	TokenID    uuid.UUID `json:"token_id"`
+	Role       string    `json:"role"`
+	CreatedAT  time.Time `json:"created_at"`
+}
+
+func NewEndpointRole(endpointID, tokenID uuid.UUID, role string) *EndpointRole {
+	return &EndpointRole{
+		EndpointID: endpointID,
+		TokenID:    tokenID,
+		Role:       role,
+		CreatedAT:  time.Now(),
+	}
+}
@@ -0,0 +1,27 @@
+package types
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleDeveloper, false},
+		{RoleDeveloper, RoleViewer, true},
+		{RoleDeveloper, RoleReleaser, false},
+		{RoleReleaser, RoleReleaser, true},
+		{RoleOwner, RoleReleaser, true},
+		{"admin", RoleViewer, false},
+		{RoleOwner, "admin", false},
+	}
+	for _, test := range tests {
+		if got := RoleAllows(test.role, test.required); got != test.want {
+			t.Fatalf("expected RoleAllows(%s, %s) to be %t", test.role, test.required, test.want)
+		}
+	}
+	if err := ValidateRole("admin"); err == nil {
+		t.Fatal("expected an error for an unknown role")
+	}
+}
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Secret is an environment variable of an endpoint whose value is encrypted
+// at rest. The value is never returned by the API, only its name and
+// metadata.
+type Secret struct {
+	EndpointID uuid.UUID `json:"endpoint_id"`
+	Name       string    `json:"name"`
+	// Value is the encrypted value of the secret.
+	Value []byte `json:"-"`
+	// Version is incremented every time the value of the secret is set.
+	Version   int       `json:"version"`
+	CreatedAT time.Time `json:"created_at"`
+	UpdatedAT time.Time `json:"updated_at"`
+}
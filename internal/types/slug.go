@@ -0,0 +1,53 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxSlugLength is the maximum length of the slug of an endpoint.
+const MaxSlugLength = 63
+
+var (
+	slugRegexp    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ValidateSlug returns an error when the slug is not made of lower case
+// letters and digits separated by single dashes. Slugs that parse as a UUID
+// are rejected, so an endpoint can be referenced by its id or its slug.
+func ValidateSlug(slug string) error {
+	if len(slug) == 0 || len(slug) > MaxSlugLength {
+		return fmt.Errorf("slug should be between 1 and %d characters long", MaxSlugLength)
+	}
+	if !slugRegexp.MatchString(slug) {
+		return fmt.Errorf("invalid slug %q, only lower case letters, digits and single dashes are allowed", slug)
+	}
+	if _, err := uuid.Parse(slug); err == nil {
+		return fmt.Errorf("invalid slug %q, slugs can not be a UUID", slug)
+	}
+	return nil
+}
+
+// Slugify derives a slug from the name of an endpoint. Names without any
+// letter or digit result in the slug "endpoint".
+func Slugify(name string) string {
+	slug := slugSeparator.ReplaceAllString(strings.ToLower(name), "-")
+	slug = TruncateSlug(strings.Trim(slug, "-"), MaxSlugLength)
+	if ValidateSlug(slug) != nil {
+		return "endpoint"
+	}
+	return slug
+}
+
+// TruncateSlug shortens the slug to at most n characters without leaving a
+// trailing dash.
+func TruncateSlug(slug string, n int) string {
+	if len(slug) <= n {
+		return slug
+	}
+	return strings.TrimRight(slug[:n], "-")
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Catfact parser":          "catfact-parser",
+		"  My API (v2) -- beta! ": "my-api-v2-beta",
+		"über_func":               "ber-func",
+		"!!!":                     "endpoint",
+		strings.Repeat("a", 70):   strings.Repeat("a", MaxSlugLength),
+		uuid.NewString():          "endpoint",
+	}
+	for name, want := range tests {
+		if got := Slugify(name); got != want {
+			t.Fatalf("expected slug %q for %q got %q", want, name, got)
+		}
+	}
+}
+
+func TestValidateSlug(t *testing.T) {
+	for _, slug := range []string{"api", "my-api-2"} {
+		if err := ValidateSlug(slug); err != nil {
+			t.Fatalf("expected %q to be valid: %s", slug, err)
+		}
+	}
+	for _, slug := range []string{"", "My-API", "my--api", "-api", "api-", "my_api", uuid.NewString(), strings.Repeat("a", 64)} {
+		if err := ValidateSlug(slug); err == nil {
+			t.Fatalf("expected %q to be invalid", slug)
+		}
+	}
+}
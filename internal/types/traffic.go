@@ -0,0 +1,113 @@
+package types
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrafficBuckets is the number of buckets the live traffic of an endpoint is
+// divided in, the weights of a traffic split are percentages.
+const TrafficBuckets = 100
+
+// TrafficSplit routes the live traffic of an endpoint across multiple
+// deployments by weight. Each client is assigned to a bucket, so it keeps
+// being served by the same deployment as long as the weights do not change.
+type TrafficSplit struct {
+	Routes []TrafficRoute `json:"routes"`
+	// StickyHeader is the name of the request header whose value assigns a
+	// client to a bucket, e.g. a user id. Clients without the header are
+	// assigned to a random bucket that is kept in a cookie.
+	StickyHeader string `json:"sticky_header,omitempty"`
+	// Canary promotes or aborts a canary deployment automatically, nil when
+	// the split is managed by hand.
+	Canary    *CanaryPolicy `json:"canary,omitempty"`
+	CreatedAT time.Time     `json:"created_at"`
+}
+
+// TrafficRoute routes the given percentage of the live traffic to a
+// deployment.
+type TrafficRoute struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Weight       int       `json:"weight"`
+}
+
+// Route returns the deployment that serves the clients of the given bucket.
+func (s *TrafficSplit) Route(bucket int) uuid.UUID {
+	var total int
+	for _, route := range s.Routes {
+		total += route.Weight
+		if bucket < total {
+			return route.DeploymentID
+		}
+	}
+	return s.Routes[len(s.Routes)-1].DeploymentID
+}
+
+// RoutesTo returns true when the split routes traffic to the given deployment.
+func (s *TrafficSplit) RoutesTo(deployID uuid.UUID) bool {
+	for _, route := range s.Routes {
+		if route.DeploymentID == deployID && route.Weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TrafficBucket returns the bucket of the clients with the given sticky key.
+func TrafficBucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % TrafficBuckets)
+}
+
+// CanaryPolicy decides when the canary deployment of a traffic split is
+// promoted to the active deployment of its endpoint, or aborted, based on
+// the ratio of its requests that responded with a 5xx status code.
+type CanaryPolicy struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	// MaxErrorRate is the ratio of 5xx responses in [0, 1] above which the
+	// canary is aborted.
+	MaxErrorRate float64 `json:"max_error_rate"`
+	// MinRequests is the number of requests the canary needs to serve
+	// before it is promoted or aborted.
+	MinRequests int `json:"min_requests"`
+	// Duration is how long the canary needs to serve traffic before it is
+	// promoted.
+	Duration time.Duration `json:"duration"`
+}
+
+type CanaryDecision int
+
+const (
+	CanaryWait CanaryDecision = iota
+	CanaryPromote
+	CanaryAbort
+)
+
+func (d CanaryDecision) String() string {
+	switch d {
+	case CanaryPromote:
+		return "promote"
+	case CanaryAbort:
+		return "abort"
+	}
+	return "wait"
+}
+
+// Evaluate decides on the canary given the counts of the requests it served
+// since the given start of the split.
+func (p *CanaryPolicy) Evaluate(counts MetricCounts, start, now time.Time) (CanaryDecision, float64) {
+	if counts.Count == 0 || counts.Count < p.MinRequests {
+		return CanaryWait, 0
+	}
+	errorRate := float64(counts.Errors) / float64(counts.Count)
+	if errorRate > p.MaxErrorRate {
+		return CanaryAbort, errorRate
+	}
+	if now.Sub(start) >= p.Duration {
+		return CanaryPromote, errorRate
+	}
+	return CanaryWait, errorRate
+}
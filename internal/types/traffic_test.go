@@ -0,0 +1,60 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTrafficSplitRoute(t *testing.T) {
+	stable, canary := uuid.New(), uuid.New()
+	split := &TrafficSplit{Routes: []TrafficRoute{
+		{DeploymentID: stable, Weight: 95},
+		{DeploymentID: canary, Weight: 5},
+	}}
+	counts := make(map[uuid.UUID]int)
+	for bucket := 0; bucket < TrafficBuckets; bucket++ {
+		counts[split.Route(bucket)]++
+	}
+	if counts[stable] != 95 || counts[canary] != 5 {
+		t.Fatalf("expected a 95/5 split got %d/%d", counts[stable], counts[canary])
+	}
+	if !split.RoutesTo(canary) || split.RoutesTo(uuid.New()) {
+		t.Fatal("expected the split to only route to its deployments")
+	}
+	if TrafficBucket("user-1") != TrafficBucket("user-1") {
+		t.Fatal("expected the bucket of a key to be stable")
+	}
+}
+
+func TestCanaryPolicyEvaluate(t *testing.T) {
+	var (
+		canary = uuid.New()
+		start  = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		policy = &CanaryPolicy{
+			DeploymentID: canary,
+			MaxErrorRate: 0.1,
+			MinRequests:  10,
+			Duration:     time.Minute,
+		}
+	)
+	testCases := []struct {
+		ok, failed int
+		elapsed    time.Duration
+		expected   CanaryDecision
+	}{
+		{5, 0, 2 * time.Minute, CanaryWait},
+		{20, 0, 30 * time.Second, CanaryWait},
+		{20, 0, 2 * time.Minute, CanaryPromote},
+		{18, 2, 2 * time.Minute, CanaryPromote},
+		{15, 5, 30 * time.Second, CanaryAbort},
+	}
+	for _, tc := range testCases {
+		counts := MetricCounts{Count: tc.ok + tc.failed, Errors: tc.failed}
+		decision, _ := policy.Evaluate(counts, start, start.Add(tc.elapsed))
+		if decision != tc.expected {
+			t.Errorf("expected %s for %d/%d after %s got %s", tc.expected, tc.ok, tc.failed, tc.elapsed, decision)
+		}
+	}
+}
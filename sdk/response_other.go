@@ -0,0 +1,17 @@
+//go:build !wasip1
+
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anthdm/raptor/proto"
+)
+
+// writeResponse prints the response with the line protocol, the body followed
+// by the status code, when the handler does not run in the wasm runtime.
+func writeResponse(resp *proto.HTTPResponse) {
+	fmt.Println(strings.TrimRight(string(resp.Response), "\n"))
+	fmt.Println(resp.StatusCode)
+}
@@ -0,0 +1,28 @@
+//go:build wasip1
+
+package run
+
+import (
+	"log"
+	"unsafe"
+
+	"github.com/anthdm/raptor/proto"
+	prot "google.golang.org/protobuf/proto"
+)
+
+//go:wasmimport raptor write_response
+func hostWriteResponse(ptr unsafe.Pointer, size uint32)
+
+// writeResponse hands the response to the host with the write_response host
+// function, so everything the handler prints on stdout is left for logging.
+func writeResponse(resp *proto.HTTPResponse) {
+	b, err := prot.Marshal(resp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(b) == 0 {
+		hostWriteResponse(nil, 0)
+		return
+	}
+	hostWriteResponse(unsafe.Pointer(&b[0]), uint32(len(b)))
+}
@@ -2,12 +2,10 @@ package run
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
 
 	"github.com/anthdm/raptor/proto"
 	// _ "github.com/stealthrocket/net/http"
@@ -36,7 +34,10 @@ func Handle(h http.Handler) {
 		log.Fatal(err)
 	}
 
-	w := &ResponseWriter{}
+	w := &ResponseWriter{
+		header:     http.Header{},
+		statusCode: http.StatusOK,
+	}
 	r, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
 	if err != nil {
 		log.Fatal(err)
@@ -45,18 +46,26 @@ func Handle(h http.Handler) {
 		r.Header[k] = v.Fields
 	}
 	h.ServeHTTP(w, r) // execute the user's handler
-	out := strings.TrimRight(w.buffer.String(), "\n")
-	fmt.Println(out)
-	fmt.Println(w.statusCode)
+
+	header := make(map[string]*proto.HeaderFields, len(w.header))
+	for k, v := range w.header {
+		header[k] = &proto.HeaderFields{Fields: v}
+	}
+	writeResponse(&proto.HTTPResponse{
+		Response:   w.buffer.Bytes(),
+		StatusCode: int32(w.statusCode),
+		Header:     header,
+	})
 }
 
 type ResponseWriter struct {
 	buffer     bytes.Buffer
+	header     http.Header
 	statusCode int
 }
 
 func (w *ResponseWriter) Header() http.Header {
-	return http.Header{}
+	return w.header
 }
 
 func (w *ResponseWriter) Write(b []byte) (n int, err error) {